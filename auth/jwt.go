@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+// tokenLeeway tolerates the clock skew between the token issuer and this service.
+const tokenLeeway = 30 * time.Second
+
+// JWTConfig configures the bearer tokens. HS256 tokens are verified with Secret, RS256 tokens with
+// PublicKey, a PEM encoded RSA public key. Issuer and Audience are checked when set.
+type JWTConfig struct {
+	Algorithm string
+	Secret    string
+	PublicKey []byte
+	Issuer    string
+	Audience  string
+}
+
+// Claims are the claims of a bearer token, the subject and expiry are required.
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// JWTVerifier turns a signed bearer token into the principal it was issued for.
+type JWTVerifier struct {
+	key    interface{}
+	parser *jwt.Parser
+}
+
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	var key interface{}
+	switch config.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		if len(config.Secret) < 32 {
+			return nil, errors.New("jwt secret must be at least 32 characters")
+		}
+		key = []byte(config.Secret)
+	case jwt.SigningMethodRS256.Alg():
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(config.PublicKey)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid jwt public key: %v", err))
+		}
+		key = publicKey
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported jwt algorithm: %s", config.Algorithm))
+	}
+
+	options := []jwt.ParserOption{
+		// only the configured algorithm, so an RS256 public key can't be used as an HS256 secret
+		jwt.WithValidMethods([]string{config.Algorithm}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(tokenLeeway),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	return &JWTVerifier{key: key, parser: jwt.NewParser(options...)}, nil
+}
+
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	claims := new(Claims)
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	if !validRole(claims.Role) {
+		return nil, errors.New(fmt.Sprintf("token has an unknown role: %q", claims.Role))
+	}
+
+	return &Principal{Subject: claims.Subject, Role: claims.Role}, nil
+}
+
+func (v *JWTVerifier) keyFunc(*jwt.Token) (interface{}, error) {
+	return v.key, nil
+}
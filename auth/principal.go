@@ -0,0 +1,65 @@
+package auth
+
+import "errors"
+
+// ErrInvalidAPIKey is returned for API keys that are malformed, unknown, revoked or don't match their hash.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// Roles of the authenticated callers. Admins manage sales, products and webhooks, customers shop and
+// integrations call the routes their API key has the scopes for.
+const (
+	RoleAdmin       = "admin"
+	RoleCustomer    = "customer"
+	RoleIntegration = "integration"
+)
+
+// Scopes of the API keys, admins have all of them.
+const (
+	ScopeSalesRead  = "sales:read"
+	ScopeSalesWrite = "sales:write"
+	ScopeOrdersRead = "orders:read"
+)
+
+// Principal is the authenticated caller of a request. The subject of a customer is its customer id.
+type Principal struct {
+	Subject string
+	Role    string
+	Scopes  []string
+}
+
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.IsAdmin() {
+		return true
+	}
+
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(RoleAdmin)
+}
+
+func (p *Principal) IsCustomer() bool {
+	return p.HasRole(RoleCustomer)
+}
+
+// validRole reports whether a token may carry the role, integrations authenticate with API keys only.
+func validRole(role string) bool {
+	return role == RoleAdmin || role == RoleCustomer
+}
@@ -1,29 +1,89 @@
 package config
 
 import (
+	"context"
+	"flash_sale_management/auth"
 	"flash_sale_management/controller"
 	_ "flash_sale_management/docs"
+	"flash_sale_management/middleware"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/swagger"
+	"github.com/gofiber/websocket/v2"
 	"github.com/spf13/viper"
 	"strconv"
 )
 
-func Handlers(controller controller.SalesController) *fiber.App {
-	app := fiber.New()
-	app.Use(cors.New())
+func Handlers(salesController controller.SalesController, productController controller.ProductController, reservationController controller.ReservationController, orderController controller.OrderController, notificationController controller.NotificationController, webhookController controller.WebhookController, apiKeyController controller.APIKeyController, authenticate fiber.Handler, idempotency fiber.Handler, rateLimits *middleware.RateLimits) *fiber.App {
+	// behind a load balancer the client ip is read from server.proxyHeader, e.g. X-Forwarded-For
+	app := fiber.New(fiber.Config{
+		ProxyHeader:  viper.GetString("server.proxyHeader"),
+		ErrorHandler: middleware.ErrorHandler,
+	})
+	// browsers only let clients read the paging headers when they are exposed
+	app.Use(cors.New(cors.Config{ExposeHeaders: controller.TotalCountHeader + ", " + controller.NextCursorHeader}))
+	// database and redis work of a request is cancelled after server.requestTimeout
+	app.Use(middleware.Deadline(viper.GetDuration("server.requestTimeout")))
+
+	// protected routes run authenticate first, then the role check
+	admin := middleware.RequireRole(auth.RoleAdmin)
+	customer := middleware.RequireRole(auth.RoleCustomer)
+	salesReader := middleware.RequireScope(auth.ScopeSalesRead)
+	salesWriter := middleware.RequireScope(auth.ScopeSalesWrite)
+	// customers read their own orders
+	ordersReader := middleware.RequireScope(auth.ScopeOrdersRead, auth.RoleCustomer)
 
 	// sale
-	app.Post("/flash-sales", controller.CreateFlashSale)
-	app.Put("/flash-sales", controller.UpdateFlashSale)
-	app.Get("/flash-sales", controller.GetFlashSales)
-	app.Get("/flash-sales/:id", controller.GetFlashSale)
-	app.Delete("/flash-sales/:id", controller.DeleteFlashSale)
+	app.Post("/flash-sales", authenticate, salesWriter, salesController.CreateFlashSale)
+	app.Put("/flash-sales", authenticate, salesWriter, salesController.UpdateFlashSale)
+	app.Get("/flash-sales", salesController.GetFlashSales)
+	app.Get("/flash-sales/:id", salesController.GetFlashSale)
+	app.Delete("/flash-sales/:id", authenticate, salesWriter, salesController.DeleteFlashSale)
+	app.Get("/flash-sales/:id/stats", authenticate, salesReader, salesController.GetFlashSaleStats)
+	app.Get("/flash-sales/:id/stream", salesController.StreamFlashSale)
+
+	// waiting room
+	app.Post("/flash-sales/:id/queue", authenticate, customer, rateLimits.For("queue"), salesController.JoinWaitingRoom)
+	app.Get("/flash-sales/:id/queue/:token", salesController.GetWaitingRoomStatus)
 
 	// buy product
-	app.Post("/flash-sales/:id/buy", controller.BuyProduct)
+	app.Post("/flash-sales/:id/buy", authenticate, customer, rateLimits.For("buy"), idempotency, salesController.BuyProduct)
+
+	// reservation (two phase checkout)
+	app.Post("/flash-sales/:id/reserve", authenticate, customer, rateLimits.For("reserve"), idempotency, reservationController.Reserve)
+	app.Get("/reservations/:id", authenticate, reservationController.GetReservation)
+	app.Post("/reservations/:id/confirm", authenticate, customer, rateLimits.For("confirm"), idempotency, reservationController.ConfirmReservation)
+	app.Post("/reservations/:id/cancel", authenticate, customer, reservationController.CancelReservation)
+
+	// order
+	app.Get("/orders", authenticate, ordersReader, orderController.GetOrders)
+	app.Get("/orders/:id", authenticate, ordersReader, orderController.GetOrder)
+	app.Post("/orders/:id/cancel", authenticate, customer, orderController.CancelOrder)
+	app.Post("/orders/:id/refund", authenticate, admin, orderController.RefundOrder)
+
+	// sale notifications
+	app.Get("/notifications", notificationController.RequireWebsocket, websocket.New(notificationController.Notifications))
+
+	// webhooks
+	app.Post("/webhooks", authenticate, admin, webhookController.CreateWebhook)
+	app.Get("/webhooks", authenticate, admin, webhookController.GetWebhooks)
+	app.Get("/webhooks/:id", authenticate, admin, webhookController.GetWebhook)
+	app.Delete("/webhooks/:id", authenticate, admin, webhookController.DeleteWebhook)
+	app.Get("/webhooks/:id/deliveries", authenticate, admin, webhookController.GetWebhookDeliveries)
+	app.Post("/webhooks/:id/deliveries/:deliveryId/redeliver", authenticate, admin, webhookController.RedeliverWebhook)
+
+	// api keys of back-office integrations
+	app.Post("/api-keys", authenticate, admin, apiKeyController.CreateAPIKey)
+	app.Get("/api-keys", authenticate, admin, apiKeyController.GetAPIKeys)
+	app.Delete("/api-keys/:id", authenticate, admin, apiKeyController.RevokeAPIKey)
+
+	// product
+	app.Post("/products", authenticate, admin, productController.CreateProduct)
+	app.Put("/products", authenticate, admin, productController.UpdateProduct)
+	app.Get("/products", productController.GetProducts)
+	app.Get("/products/:id", productController.GetProduct)
+	app.Delete("/products/:id", authenticate, admin, productController.DeleteProduct)
 
 	// swagger init
 	app.Get("/swagger/*", swagger.HandlerDefault)
@@ -34,7 +94,13 @@ func Handlers(controller controller.SalesController) *fiber.App {
 func StartServer() {
 	LoadConfig()
 	
-	app := GetApplication()
+	app, workers := GetApplication()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, worker := range workers {
+		go worker.Start(ctx)
+	}
 
 	port := strconv.Itoa(viper.Get("server.port").(int))
 	log.Fatal(app.Listen(":" + port))
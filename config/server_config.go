@@ -2,8 +2,14 @@ package config
 
 import (
 	"context"
+	"flash_sale_management/auth"
 	"flash_sale_management/controller"
 	"flash_sale_management/entity"
+	"flash_sale_management/events"
+	"flash_sale_management/hub"
+	"flash_sale_management/middleware"
+	"flash_sale_management/queue"
+	"flash_sale_management/ratelimit"
 	"flash_sale_management/repository"
 	"flash_sale_management/service"
 	"fmt"
@@ -13,10 +19,12 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
+	"net/http"
+	"os"
 	"time"
 )
 
-func GetApplication() *fiber.App {
+func GetApplication() (*fiber.App, []service.Worker) {
 
 	// redis connection
 	redisUri := viper.GetString("redis.connectionUri")
@@ -34,17 +42,33 @@ func GetApplication() *fiber.App {
 
 	// postgres connection
 	uri := viper.GetString("database.connectionUri")
-	db, err := gorm.Open(postgres.Open(uri), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(uri), &gorm.Config{TranslateError: true})
 
 	if err != nil {
 		panic(err)
 	}
 
-	err = db.AutoMigrate(&entity.Product{}, &entity.Sale{}, &entity.SaleLog{})
+	err = db.AutoMigrate(&entity.Product{}, &entity.Sale{}, &entity.SaleLog{}, &entity.CustomerPurchase{}, &entity.Reservation{}, &entity.OutboxEvent{}, &entity.WebhookSubscription{}, &entity.WebhookDelivery{}, &entity.APIKey{})
 	if err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
+	backfilled, err := repository.BackfillSaleLogSales(db)
+	if err != nil {
+		log.Fatalf("failed to backfill sale logs: %v", err)
+	}
+	if backfilled > 0 {
+		log.Printf("%d sale logs linked to their sales", backfilled)
+	}
+
+	backfilled, err = repository.BackfillSaleInitialStock(db)
+	if err != nil {
+		log.Fatalf("failed to backfill sale initial stock: %v", err)
+	}
+	if backfilled > 0 {
+		log.Printf("%d sales got their initial stock", backfilled)
+	}
+
 	debug := viper.GetBool("debug")
 	if debug {
 		db.Debug()
@@ -53,29 +77,173 @@ func GetApplication() *fiber.App {
 	// redis service
 	redisService := service.NewRedisService(client)
 
+	// transactions, shared by the product, log and sale services
+	unitOfWork := repository.NewUnitOfWork(db)
+
 	// product service
 	productRepository := repository.NewProductRepository(db)
-	productService := service.NewProductService(productRepository, &redisService)
+	productService := service.NewProductService(productRepository, &redisService, unitOfWork)
+
+	// sale repository, shared by the log and sale services
+	saleRepository := repository.NewSaleRepository(db)
+
+	// outbox, written with the changes and published by the relay
+	outboxRepository := repository.NewOutboxRepository(db)
 
 	// log service
 	logRepository := repository.NewSaleLogRepository(db)
-	logService := service.NewSaleLogService(logRepository)
+	logService := service.NewSaleLogService(logRepository, saleRepository, productService, &redisService, unitOfWork, outboxRepository)
 
 	// sale service
-	saleRepository := repository.NewSaleRepository(db)
-	salesService := service.NewSalesService(saleRepository, productService, logService, &redisService)
+	waitingRoom := service.NewWaitingRoom(queue.NewRedisStore(client, viper.GetDuration("waitingRoom.ttl")))
+	salesService := service.NewSalesService(saleRepository, productService, logService, &redisService, unitOfWork, waitingRoom, outboxRepository)
+
+	// stats service
+	statsTTL := viper.GetDuration("stats.cacheTTL")
+	if statsTTL <= 0 {
+		statsTTL = 10 * time.Second
+	}
+	statsService := service.NewSaleStatsService(logRepository, saleRepository, &redisService, statsTTL)
+
+	// live sale stock and notifications, fed by the changes of every instance
+	saleStream := service.NewSaleStream(client)
+	saleHub := hub.NewHub(viper.GetInt("notifications.bufferSize"))
+	saleNotifier := service.NewSaleNotifier(saleHub, viper.GetInt("notifications.lowStock"))
+	saleStream.Listen(saleNotifier.Notify)
+
+	// webhooks, fed by the outbox relay next to the outbox publisher
+	webhookRepository := repository.NewWebhookRepository(db)
+	webhookService := service.NewWebhookService(webhookRepository)
+
+	// reservation service
+	reservationTTL := viper.GetDuration("reservation.ttl")
+	if reservationTTL <= 0 {
+		reservationTTL = 10 * time.Minute
+	}
+	reservationRepository := repository.NewReservationRepository(db)
+	reservationService := service.NewReservationService(reservationRepository, salesService, reservationTTL)
+
+	// background workers
+	schedulerInterval := viper.GetDuration("scheduler.interval")
+	if schedulerInterval <= 0 {
+		schedulerInterval = 5 * time.Second
+	}
+	expiryInterval := viper.GetDuration("reservation.expiryInterval")
+	if expiryInterval <= 0 {
+		expiryInterval = 10 * time.Second
+	}
+	outboxInterval := viper.GetDuration("outbox.interval")
+	if outboxInterval <= 0 {
+		outboxInterval = time.Second
+	}
+	outboxBatchSize := viper.GetInt("outbox.batchSize")
+	if outboxBatchSize <= 0 {
+		outboxBatchSize = 100
+	}
+	webhookInterval := viper.GetDuration("webhooks.interval")
+	if webhookInterval <= 0 {
+		webhookInterval = time.Second
+	}
+	webhookBatchSize := viper.GetInt("webhooks.batchSize")
+	if webhookBatchSize <= 0 {
+		webhookBatchSize = 50
+	}
+	webhookMaxAttempts := viper.GetInt("webhooks.maxAttempts")
+	if webhookMaxAttempts <= 0 {
+		webhookMaxAttempts = 8
+	}
+	webhookTimeout := viper.GetDuration("webhooks.timeout")
+	if webhookTimeout <= 0 {
+		webhookTimeout = 5 * time.Second
+	}
+	workers := []service.Worker{
+		service.NewSaleScheduler(salesService, schedulerInterval, viper.GetDuration("notifications.startingLead")),
+		service.NewReservationExpirer(reservationService, expiryInterval),
+		saleStream,
+		service.NewOutboxRelay(outboxRepository, events.NewMultiPublisher(outboxPublisher(client), &webhookService), outboxInterval, outboxBatchSize),
+		service.NewWebhookDispatcher(webhookRepository, &http.Client{Timeout: webhookTimeout}, webhookInterval, webhookBatchSize, webhookMaxAttempts),
+	}
+
+	addTestProducts(context.Background(), productService)
+
+	verifier, err := auth.NewJWTVerifier(jwtConfig())
+	if err != nil {
+		log.Fatalf("failed to configure authentication: %v", err)
+	}
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(db))
+
+	idempotency := middleware.Idempotency(&redisService,
+		viper.GetDuration("idempotency.lockTimeout"), viper.GetDuration("idempotency.ttl"))
 
-	addTestProducts(productService)
+	app := Handlers(controller.New(salesService, statsService, saleStream), controller.NewProductController(productService),
+		controller.NewReservationController(reservationService), controller.NewOrderController(logService),
+		controller.NewNotificationController(saleHub), controller.NewWebhookController(webhookService), controller.NewAPIKeyController(apiKeyService),
+		middleware.Authenticate(verifier, &apiKeyService), idempotency, middleware.NewRateLimits(ratelimit.NewRedisLimiter(client), rateLimitRules()))
 
-	app := Handlers(controller.New(salesService))
+	return app, workers
+}
+
+// jwtConfig reads the bearer token settings, HS256 reads the secret from AUTH_SECRET and RS256 the PEM public key
+// from auth.publicKeyFile.
+func jwtConfig() auth.JWTConfig {
+	config := auth.JWTConfig{
+		Algorithm: viper.GetString("auth.algorithm"),
+		Secret:    viper.GetString("auth.secret"),
+		Issuer:    viper.GetString("auth.issuer"),
+		Audience:  viper.GetString("auth.audience"),
+	}
+
+	if config.Algorithm == "HS256" && config.Secret == "" {
+		log.Fatalf("the jwt secret is missing, set the AUTH_SECRET environment variable")
+	}
+
+	if file := viper.GetString("auth.publicKeyFile"); file != "" {
+		publicKey, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("failed to read jwt public key: %v", err)
+		}
+		config.PublicKey = publicKey
+	}
 
-	return app
+	return config
 }
 
-func addTestProducts(productService service.ProductService) {
+// rateLimitRules reads the rate limit rules of the routes, a route without rules is not limited.
+func rateLimitRules() map[string][]ratelimit.Rule {
+	var routes map[string][]ratelimit.Rule
+	if err := viper.UnmarshalKey("rateLimits", &routes); err != nil {
+		log.Fatalf("failed to read rate limits: %v", err)
+	}
+
+	for route, rules := range routes {
+		for _, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				log.Fatalf("invalid rate limit of %s: %v", route, err)
+			}
+		}
+	}
+
+	return routes
+}
+
+// outboxPublisher picks the publisher of the outbox events, "memory" keeps them in the process.
+func outboxPublisher(client *redis.Client) events.Publisher {
+	if viper.GetString("outbox.publisher") == "memory" {
+		return events.NewMemoryPublisher()
+	}
+
+	return events.NewRedisStreamPublisher(client, viper.GetString("outbox.stream"), viper.GetInt64("outbox.maxLen"))
+}
+
+func addTestProducts(ctx context.Context, productService service.ProductService) {
+	// seed only an empty catalog, products are managed through the /products api
+	products, err := productService.FindProducts(ctx)
+	if err != nil || len(*products) > 0 {
+		return
+	}
+
 	//test product
 	product := entity.Product{
-		ID:        1,
 		Name:      "Iphone 16",
 		Price:     50.000,
 		Stock:     10,
@@ -84,13 +252,15 @@ func addTestProducts(productService service.ProductService) {
 	}
 
 	product2 := entity.Product{
-		ID:        2,
 		Name:      "Iphone 17",
 		Price:     100.000,
 		Stock:     20,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	productService.CreateProduct(product)
-	productService.CreateProduct(product2)
+	for _, p := range []entity.Product{product, product2} {
+		if _, err := productService.CreateProduct(ctx, p); err != nil {
+			log.Printf("error creating test product: %v", err)
+		}
+	}
 }
@@ -26,4 +26,9 @@ func LoadConfig() {
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatalf("Error reading config file, %s", err)
 	}
+
+	// secrets aren't committed, they come from the environment and override the config file
+	if err := viper.BindEnv("auth.secret", "AUTH_SECRET"); err != nil {
+		log.Fatalf("Error binding environment variables, %s", err)
+	}
 }
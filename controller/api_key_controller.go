@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"flash_sale_management/dto/request"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/service"
+	"flash_sale_management/utils"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+)
+
+type APIKeyController struct {
+	apiKeyService service.APIKeyService
+}
+
+func NewAPIKeyController(apiKeyService service.APIKeyService) APIKeyController {
+	controller := APIKeyController{apiKeyService: apiKeyService}
+	return controller
+}
+
+// CreateAPIKey godoc
+//
+//	@Summary		Create API Key
+//	@Description	The key is only returned by this call, integrations send it in the X-API-Key header.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Param			request body request.CreateAPIKeyRequest true "Request Body"
+//	@Success		201 {object} response.CreatedAPIKeyResponse "Created"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api-keys [post]
+func (a *APIKeyController) CreateAPIKey(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	apiKeyRequest := new(request.CreateAPIKeyRequest)
+
+	if err := c.BodyParser(apiKeyRequest); err != nil {
+		return badRequest("error parsing body", err)
+	}
+
+	apiKey, key, err := a.apiKeyService.CreateAPIKey(c.UserContext(), *apiKeyRequest)
+	if err != nil {
+		return err
+	}
+
+	apiKeyResponse := (&response.CreatedAPIKeyResponse{}).FromEntity(apiKey, key)
+	return c.Status(http.StatusCreated).JSON(apiKeyResponse)
+}
+
+// GetAPIKeys godoc
+//
+//	@Summary		Get All API Keys
+//	@Tags			API Keys
+//	@Produce		json
+//	@Success		200 {object} []response.APIKeyResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api-keys [get]
+func (a *APIKeyController) GetAPIKeys(c *fiber.Ctx) error {
+	apiKeys, err := a.apiKeyService.FindAPIKeys(c.UserContext())
+	if err != nil {
+		utils.CreateLogMessage("error getting all api keys", err)
+		return err
+	}
+
+	apiKeyResponses := make([]response.APIKeyResponse, 0, len(*apiKeys))
+	for _, apiKey := range *apiKeys {
+		apiKeyResponses = append(apiKeyResponses, (&response.APIKeyResponse{}).FromEntity(&apiKey))
+	}
+
+	return c.Status(http.StatusOK).JSON(apiKeyResponses)
+}
+
+// RevokeAPIKey godoc
+//
+//	@Summary		Revoke API Key
+//	@Tags			API Keys
+//	@Produce		json
+//	@Param			id path int true "API Key ID"
+//	@Success		200 {object} response.APIKeyResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api-keys/{id} [delete]
+func (a *APIKeyController) RevokeAPIKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+	apiKeyID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	apiKey, err := a.apiKeyService.RevokeAPIKey(c.UserContext(), apiKeyID)
+	if err != nil {
+		return err
+	}
+
+	apiKeyResponse := (&response.APIKeyResponse{}).FromEntity(apiKey)
+	return c.Status(http.StatusOK).JSON(apiKeyResponse)
+}
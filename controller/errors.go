@@ -0,0 +1,14 @@
+package controller
+
+import (
+	"flash_sale_management/utils"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+)
+
+// badRequest answers a body, query or path parameter that can't be parsed with 400 Bad Request.
+func badRequest(message string, err error) error {
+	utils.CreateLogMessage(message, err)
+	return fiber.NewError(http.StatusBadRequest, fmt.Sprintf("%s: %v", message, err))
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"flash_sale_management/dto/request"
+	"flash_sale_management/hub"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/websocket/v2"
+	"net/http"
+	"time"
+)
+
+const (
+	// notificationWriteWait is how long a write to a client may take before it is disconnected.
+	notificationWriteWait = 10 * time.Second
+	// notificationPing keeps idle connections open and notices gone clients.
+	notificationPing = 30 * time.Second
+)
+
+type NotificationController struct {
+	hub *hub.Hub
+}
+
+func NewNotificationController(hub *hub.Hub) NotificationController {
+	controller := NotificationController{hub: hub}
+	return controller
+}
+
+// RequireWebsocket answers requests that aren't websocket upgrades with 426 Upgrade Required.
+func (n *NotificationController) RequireWebsocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.NewError(http.StatusUpgradeRequired, "websocket upgrade required")
+	}
+
+	return c.Next()
+}
+
+// Notifications serves a websocket client. The client sends
+// {"action": "subscribe", "saleIds": [1, 2]} or "unsubscribe" and receives the starting, started, low_stock,
+// sold_out and ended events of its sales. A client that doesn't keep up with its events is disconnected.
+func (n *NotificationController) Notifications(conn *websocket.Conn) {
+	client := n.hub.Register()
+	defer n.hub.Unregister(client)
+
+	// the reader unregisters the client when the connection is closed, which stops the writer
+	go func() {
+		defer n.hub.Unregister(client)
+
+		for {
+			var message request.NotificationRequest
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+
+			if err := message.Validate(); err != nil {
+				log.Errorf("invalid notification message: %v", err)
+				continue
+			}
+
+			for _, saleID := range message.SaleIDs {
+				if message.Action == "subscribe" {
+					n.hub.Subscribe(client, saleID)
+				} else {
+					n.hub.Unsubscribe(client, saleID)
+				}
+			}
+		}
+	}()
+
+	ping := time.NewTicker(notificationPing)
+	defer ping.Stop()
+
+	events := client.Events()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if client.Dropped() {
+					closeMessage := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow")
+					_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(notificationWriteWait))
+				}
+				return
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(notificationWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(notificationWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"flash_sale_management/dto/request"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/middleware"
+	"flash_sale_management/service"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+)
+
+type OrderController struct {
+	saleLogService service.SaleLogService
+}
+
+func NewOrderController(saleLogService service.SaleLogService) OrderController {
+	controller := OrderController{saleLogService: saleLogService}
+	return controller
+}
+
+// GetOrders godoc
+//
+//	@Summary		Get Orders
+//	@Tags			Orders
+//	@Produce		json
+//	@Param			saleId query int false "Flash Sale ID"
+//	@Param			productId query int false "Product ID"
+//	@Param			customerId query string false "Customer ID, customers always get their own orders"
+//	@Param			status query string false "Order status" Enums(placed, cancelled, refunded)
+//	@Param			from query string false "Created at or after (2006-01-02T15:04)"
+//	@Param			to query string false "Created before (2006-01-02T15:04)"
+//	@Param			sort query string false "Sort order, default -createdAt" Enums(createdAt, -createdAt, totalPrice, -totalPrice)
+//	@Param			limit query int false "Page size, default 20, at most 100"
+//	@Param			cursor query string false "nextCursor of the previous page"
+//	@Success		200 {object} response.OrderPageResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Security		APIKeyAuth
+//	@Router			/orders [get]
+func (o *OrderController) GetOrders(c *fiber.Ctx) error {
+	orderQuery := new(request.OrderQuery)
+
+	if err := c.QueryParser(orderQuery); err != nil {
+		return badRequest("error parsing query", err)
+	}
+
+	// customers only see their own orders
+	if principal := middleware.Principal(c); principal.IsCustomer() {
+		orderQuery.CustomerID = principal.Subject
+	}
+
+	orders, nextCursor, err := o.saleLogService.FindOrders(c.UserContext(), *orderQuery)
+	if err != nil {
+		return err
+	}
+
+	pageResponse := (&response.OrderPageResponse{}).FromEntities(*orders, nextCursor)
+	return c.Status(http.StatusOK).JSON(pageResponse)
+}
+
+// GetOrder godoc
+//
+//	@Summary		Get Order
+//	@Tags			Orders
+//	@Produce		json
+//	@Param			id path int true "Order ID"
+//	@Success		200 {object} response.BuyProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Security		APIKeyAuth
+//	@Router			/orders/{id} [get]
+func (o *OrderController) GetOrder(c *fiber.Ctx) error {
+	id := c.Params("id")
+	orderID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	order, err := o.saleLogService.FindSaleLog(c.UserContext(), orderID)
+	if err != nil {
+		return err
+	}
+
+	if !ownedBy(c, order.CustomerID) {
+		return fiber.NewError(http.StatusNotFound, fmt.Sprintf("order not found. id: %d", orderID))
+	}
+
+	orderResponse := (&response.BuyProductResponse{}).FromEntity(*order)
+	return c.Status(http.StatusOK).JSON(orderResponse)
+}
+
+// CancelOrder godoc
+//
+//	@Summary		Cancel Order
+//	@Tags			Orders
+//	@Produce		json
+//	@Param			id path int true "Order ID"
+//	@Success		200 {object} response.BuyProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/orders/{id}/cancel [post]
+func (o *OrderController) CancelOrder(c *fiber.Ctx) error {
+	cancelRequest := request.CancelOrderRequest{CustomerID: middleware.Principal(c).Subject}
+
+	id := c.Params("id")
+	orderID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	order, err := o.saleLogService.CancelOrder(c.UserContext(), orderID, cancelRequest)
+	if err != nil {
+		return err
+	}
+
+	orderResponse := (&response.BuyProductResponse{}).FromEntity(*order)
+	return c.Status(http.StatusOK).JSON(orderResponse)
+}
+
+// RefundOrder godoc
+//
+//	@Summary		Refund Order
+//	@Tags			Orders
+//	@Produce		json
+//	@Param			id path int true "Order ID"
+//	@Success		200 {object} response.BuyProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/orders/{id}/refund [post]
+func (o *OrderController) RefundOrder(c *fiber.Ctx) error {
+	id := c.Params("id")
+	orderID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	order, err := o.saleLogService.RefundOrder(c.UserContext(), orderID)
+	if err != nil {
+		return err
+	}
+
+	orderResponse := (&response.BuyProductResponse{}).FromEntity(*order)
+	return c.Status(http.StatusOK).JSON(orderResponse)
+}
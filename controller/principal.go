@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"flash_sale_management/auth"
+	"flash_sale_management/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ownedBy reports whether the caller may see a resource of the customer, admins and integrations with the
+// orders:read scope see every customer's. Resources of other customers are answered as not found,
+// so their ids can't be probed.
+func ownedBy(c *fiber.Ctx, customerID string) bool {
+	principal := middleware.Principal(c)
+	return principal != nil && (principal.HasScope(auth.ScopeOrdersRead) || principal.Subject == customerID)
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"flash_sale_management/dto/request"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/service"
+	"flash_sale_management/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"net/http"
+	"strconv"
+)
+
+type ProductController struct {
+	productService service.ProductService
+}
+
+func NewProductController(productService service.ProductService) ProductController {
+	controller := ProductController{productService: productService}
+	return controller
+}
+
+// CreateProduct godoc
+//
+//	@Summary		Create Product
+//	@Tags			Products
+//	@Accept			json
+//	@Produce		json
+//	@Param			request body request.CreateProductRequest true "Request Body"
+//	@Success		201 {object} response.ProductResponse "Created"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/products [post]
+func (p *ProductController) CreateProduct(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	productRequest := new(request.CreateProductRequest)
+
+	if err := c.BodyParser(productRequest); err != nil {
+		return badRequest("error parsing body", err)
+	}
+
+	product, err := p.productService.SaveProduct(c.UserContext(), *productRequest)
+	if err != nil {
+		return err
+	}
+
+	productResponse := (&response.ProductResponse{}).FromEntity(product)
+	return c.Status(http.StatusCreated).JSON(productResponse)
+}
+
+// UpdateProduct godoc
+//
+//	@Summary		Update Product Price and Stock
+//	@Tags			Products
+//	@Accept			json
+//	@Produce		json
+//	@Param			request body request.UpdateProductRequest true "Request Body"
+//	@Success		200 {object} response.ProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/products [put]
+func (p *ProductController) UpdateProduct(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	productRequest := new(request.UpdateProductRequest)
+
+	if err := c.BodyParser(productRequest); err != nil {
+		return badRequest("error parsing body", err)
+	}
+
+	product, err := p.productService.UpdateProductDetails(c.UserContext(), *productRequest)
+	if err != nil {
+		return err
+	}
+
+	productResponse := (&response.ProductResponse{}).FromEntity(product)
+	return c.Status(http.StatusOK).JSON(productResponse)
+}
+
+// GetProduct godoc
+//
+//	@Summary		Get Product
+//	@Tags			Products
+//	@Produce		json
+//	@Param			id path int true "Product ID"
+//	@Success		200 {object} response.ProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Router			/products/{id} [get]
+func (p *ProductController) GetProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+	productID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	product, err := p.productService.GetProduct(c.UserContext(), productID)
+	if err != nil {
+		return err
+	}
+
+	productResponse := (&response.ProductResponse{}).FromEntity(product)
+	return c.Status(http.StatusOK).JSON(productResponse)
+}
+
+// GetProducts godoc
+//
+//	@Summary		Get All Products
+//	@Tags			Products
+//	@Produce		json
+//	@Success		200 {object} []response.ProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Router			/products [get]
+func (p *ProductController) GetProducts(c *fiber.Ctx) error {
+	products, err := p.productService.FindProducts(c.UserContext())
+	if err != nil {
+		utils.CreateLogMessage("error getting all products", err)
+		return err
+	}
+
+	productResponses := make([]response.ProductResponse, 0, len(*products))
+	for _, product := range *products {
+		productResponses = append(productResponses, (&response.ProductResponse{}).FromEntity(&product))
+	}
+
+	return c.Status(http.StatusOK).JSON(productResponses)
+}
+
+// DeleteProduct godoc
+//
+//	@Summary		Delete Product
+//	@Tags			Products
+//	@Produce		json
+//	@Param			id path int true "Product ID"
+//	@Success  		200 "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/products/{id} [delete]
+func (p *ProductController) DeleteProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+	productID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	err = p.productService.DeleteProduct(c.UserContext(), productID)
+	if err != nil {
+		log.Errorf(err.Error())
+		return err
+	}
+
+	return c.SendStatus(200)
+}
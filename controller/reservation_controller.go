@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"flash_sale_management/dto/request"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/middleware"
+	"flash_sale_management/service"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+)
+
+type ReservationController struct {
+	reservationService service.ReservationService
+}
+
+func NewReservationController(reservationService service.ReservationService) ReservationController {
+	controller := ReservationController{reservationService: reservationService}
+	return controller
+}
+
+// Reserve godoc
+//
+//	@Summary		Reserve Flash Sale Stock
+//	@Tags			Reservations
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path int true "Flash Sale ID"
+//	@Param			Idempotency-Key header string false "Retries with the same key replay the first outcome"
+//	@Param			X-Admission-Token header string false "Queue token, required for waiting room sales"
+//	@Param			request body request.BuyProductRequest true "Request Body"
+//	@Success		201 {object} response.ReservationResponse "Created"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		409 {object} response.ProblemResponse "Sold out, sale not started or ended, or a request with the same idempotency key in progress"
+//	@Failure		422 {object} response.ProblemResponse "Purchase limit per order or customer exceeded, or the idempotency key was used with another body"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Failure		429 {object} response.ProblemResponse "Too many requests, see Retry-After"
+//	@Security		BearerAuth
+//	@Router			/flash-sales/{id}/reserve [post]
+func (r *ReservationController) Reserve(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	reserveRequest := new(request.BuyProductRequest)
+
+	if err := parseOptionalBody(c, reserveRequest); err != nil {
+		return err
+	}
+	reserveRequest.CustomerID = middleware.Principal(c).Subject
+	reserveRequest.AdmissionToken = c.Get(AdmissionTokenHeader)
+	reserveRequest.IdempotencyKey = c.Get(middleware.IdempotencyHeader)
+
+	id := c.Params("id")
+	saleID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	reservation, err := r.reservationService.Reserve(c.UserContext(), saleID, *reserveRequest)
+	if err != nil {
+		return err
+	}
+
+	reservationResponse := (&response.ReservationResponse{}).FromEntity(reservation)
+	return c.Status(http.StatusCreated).JSON(reservationResponse)
+}
+
+// GetReservation godoc
+//
+//	@Summary		Get Reservation
+//	@Tags			Reservations
+//	@Produce		json
+//	@Param			id path int true "Reservation ID"
+//	@Success		200 {object} response.ReservationResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Security		BearerAuth
+//	@Router			/reservations/{id} [get]
+func (r *ReservationController) GetReservation(c *fiber.Ctx) error {
+	id := c.Params("id")
+	reservationID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	reservation, err := r.reservationService.FindReservation(c.UserContext(), reservationID)
+	if err != nil {
+		return err
+	}
+
+	if !ownedBy(c, reservation.CustomerID) {
+		return fiber.NewError(http.StatusNotFound, fmt.Sprintf("reservation not found. id: %d", reservationID))
+	}
+
+	reservationResponse := (&response.ReservationResponse{}).FromEntity(reservation)
+	return c.Status(http.StatusOK).JSON(reservationResponse)
+}
+
+// ConfirmReservation godoc
+//
+//	@Summary		Confirm Reservation
+//	@Tags			Reservations
+//	@Produce		json
+//	@Param			id path int true "Reservation ID"
+//	@Param			Idempotency-Key header string false "Retries with the same key replay the first outcome"
+//	@Success		200 {object} response.BuyProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		409 {object} response.ProblemResponse "Sold out, sale not started or ended, or a request with the same idempotency key in progress"
+//	@Failure		422 {object} response.ProblemResponse "The idempotency key was used with another body"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Failure		429 {object} response.ProblemResponse "Too many requests, see Retry-After"
+//	@Security		BearerAuth
+//	@Router			/reservations/{id}/confirm [post]
+func (r *ReservationController) ConfirmReservation(c *fiber.Ctx) error {
+	reservationRequest := request.ReservationRequest{CustomerID: middleware.Principal(c).Subject}
+
+	id := c.Params("id")
+	reservationID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	order, err := r.reservationService.ConfirmReservation(c.UserContext(), reservationID, reservationRequest)
+	if err != nil {
+		return err
+	}
+
+	buyResponse := (&response.BuyProductResponse{}).FromEntity(*order)
+	return c.Status(http.StatusOK).JSON(buyResponse)
+}
+
+// CancelReservation godoc
+//
+//	@Summary		Cancel Reservation
+//	@Tags			Reservations
+//	@Produce		json
+//	@Param			id path int true "Reservation ID"
+//	@Success		200 {object} response.ReservationResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/reservations/{id}/cancel [post]
+func (r *ReservationController) CancelReservation(c *fiber.Ctx) error {
+	reservationRequest := request.ReservationRequest{CustomerID: middleware.Principal(c).Subject}
+
+	id := c.Params("id")
+	reservationID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	reservation, err := r.reservationService.CancelReservation(c.UserContext(), reservationID, reservationRequest)
+	if err != nil {
+		return err
+	}
+
+	reservationResponse := (&response.ReservationResponse{}).FromEntity(reservation)
+	return c.Status(http.StatusOK).JSON(reservationResponse)
+}
@@ -1,22 +1,40 @@
 package controller
 
 import (
+	"bufio"
+	"encoding/json"
 	"flash_sale_management/dto/request"
 	"flash_sale_management/dto/response"
+	"flash_sale_management/middleware"
 	"flash_sale_management/service"
-	"flash_sale_management/utils"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+// AdmissionTokenHeader carries the waiting room token on buy requests.
+const AdmissionTokenHeader = "X-Admission-Token"
+
+// Paging headers of GET /flash-sales, the body stays a plain array of sales.
+const (
+	TotalCountHeader = "X-Total-Count"
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+// saleStreamHeartbeat is how often an idle stream sends a comment, so proxies keep it open and gone clients are noticed.
+const saleStreamHeartbeat = 15 * time.Second
+
 type SalesController struct {
 	salesService service.SalesService
+	statsService service.SaleStatsService
+	saleStream   *service.SaleStream
 }
 
-func New(salesService service.SalesService) SalesController {
-	controller := SalesController{salesService: salesService}
+func New(salesService service.SalesService, statsService service.SaleStatsService, saleStream *service.SaleStream) SalesController {
+	controller := SalesController{salesService: salesService, statsService: statsService, saleStream: saleStream}
 	return controller
 }
 
@@ -28,28 +46,31 @@ func New(salesService service.SalesService) SalesController {
 //	@Produce		json
 //	@Param			request body request.CreateSaleRequest true "Request Body"
 //	@Success		201 {object} response.SaleResponse "Created"
-//	@Failure		400 {string} string "Bad Request"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/flash-sales [post]
 func (s *SalesController) CreateFlashSale(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	saleRequest := new(request.CreateSaleRequest)
 
 	if err := c.BodyParser(saleRequest); err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("error parsing body", err))
+		return badRequest("error parsing body", err)
 	}
 
-	sale, err := s.salesService.CreateSale(*saleRequest)
+	sale, err := s.salesService.CreateSale(c.UserContext(), *saleRequest)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).SendString(err.Error())
+		return err
 	}
 
-	sale, err = s.salesService.SaveSale(sale)
+	sale, err = s.salesService.SaveSale(c.UserContext(), sale)
 	if err == nil {
 		saleResponse := (&response.SaleResponse{}).FromEntity(sale)
 		return c.Status(http.StatusCreated).JSON(saleResponse)
 	} else {
-		return c.Status(http.StatusBadRequest).SendString(err.Error())
+		return err
 	}
 }
 
@@ -61,23 +82,26 @@ func (s *SalesController) CreateFlashSale(c *fiber.Ctx) error {
 //	@Produce		json
 //	@Param			request body request.UpdateSaleRequest true "Request Body"
 //	@Success		200 {object} response.SaleResponse "Ok"
-//	@Failure		400 {string} string "Bad Request"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/flash-sales [put]
 func (s *SalesController) UpdateFlashSale(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	saleRequest := new(request.UpdateSaleRequest)
 
 	if err := c.BodyParser(saleRequest); err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("error parsing body", err))
+		return badRequest("error parsing body", err)
 	}
 
-	updatedSale, err := s.salesService.UpdateSale(*saleRequest)
+	updatedSale, err := s.salesService.UpdateSale(c.UserContext(), *saleRequest)
 	if err == nil {
 		saleResponse := (&response.SaleResponse{}).FromEntity(updatedSale)
 		return c.Status(http.StatusOK).JSON(saleResponse)
 	} else {
-		return c.Status(http.StatusBadRequest).SendString(err.Error())
+		return err
 	}
 }
 
@@ -88,22 +112,22 @@ func (s *SalesController) UpdateFlashSale(c *fiber.Ctx) error {
 //	@Produce		json
 //	@Param			id path int true "Flash Sale ID"
 //	@Success		200 {object} response.SaleResponse "Ok"
-//	@Failure		400 {string} string "Bad Request"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
 //	@Router			/flash-sales/{id} [get]
 func (s *SalesController) GetFlashSale(c *fiber.Ctx) error {
 	id := c.Params("id")
 	saleID, err := strconv.Atoi(id)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("wrong parameter. convert failed", err))
+		return badRequest("wrong parameter. convert failed", err)
 	}
 
-	sales, err := s.salesService.FindSale(saleID)
+	sales, err := s.salesService.FindSale(c.UserContext(), saleID)
 	if err == nil {
 		saleResponse := (&response.SaleResponse{}).FromEntity(sales)
 		return c.Status(http.StatusOK).JSON(saleResponse)
 	} else {
-		return c.Status(http.StatusBadRequest).SendString(err.Error())
+		return err
 	}
 }
 
@@ -112,28 +136,38 @@ func (s *SalesController) GetFlashSale(c *fiber.Ctx) error {
 //	@Summary		Get Flash All Sale
 //	@Tags			Sales
 //	@Produce		json
+//	@Param			status query string false "Sale status" Enums(upcoming, active, ended, sold_out)
+//	@Param			productId query int false "Product ID"
+//	@Param			from query string false "Running at or after (2006-01-02T15:04)"
+//	@Param			to query string false "Running before (2006-01-02T15:04)"
+//	@Param			sort query string false "Sort order, default startTime" Enums(startTime, -startTime, endTime, -endTime, discount, -discount, createdAt, -createdAt)
+//	@Param			limit query int false "Page size, default 20, at most 100"
+//	@Param			cursor query string false "X-Next-Cursor of the previous page"
 //	@Success		200 {object} []response.SaleResponse "Ok"
-//	@Failure		400 {string} string "Bad Request"
+//	@Header			200 {integer} X-Total-Count "Sales matching the filters"
+//	@Header			200 {string} X-Next-Cursor "Cursor of the next page, missing on the last page"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
 //	@Router			/flash-sales [get]
 func (s *SalesController) GetFlashSales(c *fiber.Ctx) error {
-	sales, err := s.salesService.FindSales()
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("error getting all sales", err))
+	saleQuery := new(request.SaleQuery)
+
+	if err := c.QueryParser(saleQuery); err != nil {
+		return badRequest("error parsing query", err)
 	}
 
-	var saleResponses []response.SaleResponse
-	for _, sale := range *sales {
-		if sale.ID == 0 {
-			continue
-		}
+	page, err := s.salesService.FindSalePage(c.UserContext(), *saleQuery)
+	if err != nil {
+		return err
+	}
 
-		saleResponse := (&response.SaleResponse{}).FromEntity(&sale)
-		saleResponses = append(saleResponses, saleResponse)
+	saleResponses := make([]response.SaleResponse, 0, len(page.Sales))
+	for _, sale := range page.Sales {
+		saleResponses = append(saleResponses, (&response.SaleResponse{}).FromEntity(&sale))
 	}
 
-	if saleResponses == nil || len(saleResponses) == 0 {
-		return c.Status(http.StatusOK).JSON("sales not found")
+	c.Set(TotalCountHeader, strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		c.Set(NextCursorHeader, page.NextCursor)
 	}
 
 	return c.Status(http.StatusOK).JSON(saleResponses)
@@ -146,52 +180,241 @@ func (s *SalesController) GetFlashSales(c *fiber.Ctx) error {
 //	@Produce		json
 //	@Param			id path int true "Flash Sale ID"
 //	@Success  		200 "Ok"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/flash-sales/{id} [delete]
 func (s *SalesController) DeleteFlashSale(c *fiber.Ctx) error {
 	id := c.Params("id")
 	saleID, err := strconv.Atoi(id)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("wrong parameter. convert failed", err))
+		return badRequest("wrong parameter. convert failed", err)
 	}
 
-	err = s.salesService.DeleteSale(saleID)
+	err = s.salesService.DeleteSale(c.UserContext(), saleID)
 	if err != nil {
 		log.Errorf(err.Error())
-		return c.Status(http.StatusBadRequest).SendString(err.Error())
+		return err
 	}
 
 	return c.SendStatus(200)
 }
 
+// JoinWaitingRoom godoc
+//
+//	@Summary		Join Flash Sale Waiting Room
+//	@Tags			Sales
+//	@Produce		json
+//	@Param			id path int true "Flash Sale ID"
+//	@Success		201 {object} response.QueueStatusResponse "Created"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Failure		429 {object} response.ProblemResponse "Too many requests, see Retry-After"
+//	@Security		BearerAuth
+//	@Router			/flash-sales/{id}/queue [post]
+func (s *SalesController) JoinWaitingRoom(c *fiber.Ctx) error {
+	id := c.Params("id")
+	saleID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	// the ticket is issued to the caller, only they can buy with it
+	status, err := s.salesService.JoinWaitingRoom(c.UserContext(), saleID, middleware.Principal(c).Subject)
+	if err != nil {
+		return err
+	}
+
+	statusResponse := (&response.QueueStatusResponse{}).FromStatus(status)
+	return c.Status(http.StatusCreated).JSON(statusResponse)
+}
+
+// GetWaitingRoomStatus godoc
+//
+//	@Summary		Get Waiting Room Position
+//	@Tags			Sales
+//	@Produce		json
+//	@Param			id path int true "Flash Sale ID"
+//	@Param			token path string true "Queue Token"
+//	@Success		200 {object} response.QueueStatusResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Router			/flash-sales/{id}/queue/{token} [get]
+func (s *SalesController) GetWaitingRoomStatus(c *fiber.Ctx) error {
+	id := c.Params("id")
+	saleID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	status, err := s.salesService.GetWaitingRoomStatus(c.UserContext(), saleID, c.Params("token"))
+	if err != nil {
+		return err
+	}
+
+	statusResponse := (&response.QueueStatusResponse{}).FromStatus(status)
+	return c.Status(http.StatusOK).JSON(statusResponse)
+}
+
+// GetFlashSaleStats godoc
+//
+//	@Summary		Get Flash Sale Stats
+//	@Tags			Sales
+//	@Produce		json
+//	@Param			id path int true "Flash Sale ID"
+//	@Success		200 {object} response.SaleStatsResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Security		APIKeyAuth
+//	@Router			/flash-sales/{id}/stats [get]
+func (s *SalesController) GetFlashSaleStats(c *fiber.Ctx) error {
+	id := c.Params("id")
+	saleID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	stats, err := s.statsService.GetSaleStats(c.UserContext(), saleID)
+	if err != nil {
+		return err
+	}
+
+	statsResponse := (&response.SaleStatsResponse{}).FromStats(stats)
+	return c.Status(http.StatusOK).JSON(statsResponse)
+}
+
+// StreamFlashSale godoc
+//
+//	@Summary		Stream Flash Sale Stock
+//	@Description	Server-Sent Events of the sale stock, active flag and countdown, sent on connect and on every change.
+//	@Tags			Sales
+//	@Produce		text/event-stream
+//	@Param			id path int true "Flash Sale ID"
+//	@Success		200 {object} response.SaleStreamResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Router			/flash-sales/{id}/stream [get]
+func (s *SalesController) StreamFlashSale(c *fiber.Ctx) error {
+	id := c.Params("id")
+	saleID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	sale, err := s.salesService.FindSale(c.UserContext(), saleID)
+	if err != nil {
+		return err
+	}
+
+	current := service.NewSaleEvent(sale)
+	events, unsubscribe := s.saleStream.Subscribe(saleID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		heartbeat := time.NewTicker(saleStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		if writeSaleEvent(w, current) != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok || writeSaleEvent(w, event) != nil || event.Deleted {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := w.WriteString(": heartbeat\n\n"); err != nil || w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeSaleEvent sends the event and flushes it, an error means the client is gone.
+func writeSaleEvent(w *bufio.Writer, event service.SaleEvent) error {
+	data, err := json.Marshal((&response.SaleStreamResponse{}).FromEvent(event, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: sale\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
 // BuyProduct ShowAccount godoc
 //
 //	@Summary		Buy Product
 //	@Tags			Sales
+//	@Accept			json
 //	@Produce		json
-//	@Success  		200 "Ok"
+//	@Param			id path int true "Flash Sale ID"
+//	@Param			Idempotency-Key header string false "Retries with the same key replay the first outcome"
+//	@Param			X-Admission-Token header string false "Queue token, required for waiting room sales"
+//	@Param			request body request.BuyProductRequest true "Request Body"
+//	@Success		200 {object} response.BuyProductResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		409 {object} response.ProblemResponse "Sold out, sale not started or ended, or a request with the same idempotency key in progress"
+//	@Failure		422 {object} response.ProblemResponse "Purchase limit per order or customer exceeded, or the idempotency key was used with another body"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Failure		429 {object} response.ProblemResponse "Too many requests, see Retry-After"
+//	@Security		BearerAuth
 //	@Router			/flash-sales/{id}/buy [post]
 func (s *SalesController) BuyProduct(c *fiber.Ctx) error {
-	// wait for transaction and race condition testing
-	w8 := c.Query("wait", "1")
+	c.Accepts("application/json")
+	buyRequest := new(request.BuyProductRequest)
+
+	if err := parseOptionalBody(c, buyRequest); err != nil {
+		return err
+	}
+	buyRequest.CustomerID = middleware.Principal(c).Subject
+	buyRequest.IdempotencyKey = c.Get(middleware.IdempotencyHeader)
+	buyRequest.AdmissionToken = c.Get(AdmissionTokenHeader)
 
 	id := c.Params("id")
 	saleID, err := strconv.Atoi(id)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("wrong parameter. convert failed", err))
+		return badRequest("wrong parameter. convert failed", err)
 	}
 
-	wait, err := strconv.Atoi(w8)
+	buy, err := s.salesService.Buy(c.UserContext(), saleID, *buyRequest)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			SendString(utils.CreateLogMessage("wrong parameter. convert failed", err))
+		return err
 	}
 
-	buy, err := s.salesService.Buy(saleID, wait)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	buyResponse := (&response.BuyProductResponse{}).FromEntity(*buy)
+	return c.Status(http.StatusOK).JSON(buyResponse)
+}
+
+// parseOptionalBody parses the body into out when there is one, an empty body keeps the defaults of out.
+func parseOptionalBody(c *fiber.Ctx, out interface{}) error {
+	if len(c.Body()) == 0 {
+		return nil
+	}
+
+	if err := c.BodyParser(out); err != nil {
+		return badRequest("error parsing body", err)
 	}
 
-	return c.Status(http.StatusOK).JSON(buy)
+	return nil
 }
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"flash_sale_management/dto/request"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/service"
+	"flash_sale_management/utils"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+)
+
+type WebhookController struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookController(webhookService service.WebhookService) WebhookController {
+	controller := WebhookController{webhookService: webhookService}
+	return controller
+}
+
+// CreateWebhook godoc
+//
+//	@Summary		Subscribe a Webhook to Sale and Order Events
+//	@Description	Deliveries are POSTed with the X-Webhook-Signature header, sha256= and the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" with the secret.
+//	@Tags			Webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			request body request.CreateWebhookRequest true "Request Body"
+//	@Success		201 {object} response.WebhookResponse "Created"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/webhooks [post]
+func (w *WebhookController) CreateWebhook(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	webhookRequest := new(request.CreateWebhookRequest)
+
+	if err := c.BodyParser(webhookRequest); err != nil {
+		return badRequest("error parsing body", err)
+	}
+
+	subscription, err := w.webhookService.CreateSubscription(c.UserContext(), *webhookRequest)
+	if err != nil {
+		return err
+	}
+
+	webhookResponse := (&response.WebhookResponse{}).FromEntity(subscription)
+	return c.Status(http.StatusCreated).JSON(webhookResponse)
+}
+
+// GetWebhooks godoc
+//
+//	@Summary		Get All Webhooks
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Success		200 {object} []response.WebhookResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/webhooks [get]
+func (w *WebhookController) GetWebhooks(c *fiber.Ctx) error {
+	subscriptions, err := w.webhookService.FindSubscriptions(c.UserContext())
+	if err != nil {
+		utils.CreateLogMessage("error getting all webhooks", err)
+		return err
+	}
+
+	webhookResponses := make([]response.WebhookResponse, 0, len(*subscriptions))
+	for _, subscription := range *subscriptions {
+		webhookResponses = append(webhookResponses, (&response.WebhookResponse{}).FromEntity(&subscription))
+	}
+
+	return c.Status(http.StatusOK).JSON(webhookResponses)
+}
+
+// GetWebhook godoc
+//
+//	@Summary		Get Webhook
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id path int true "Webhook ID"
+//	@Success		200 {object} response.WebhookResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/webhooks/{id} [get]
+func (w *WebhookController) GetWebhook(c *fiber.Ctx) error {
+	id := c.Params("id")
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	subscription, err := w.webhookService.FindSubscription(c.UserContext(), webhookID)
+	if err != nil {
+		return err
+	}
+
+	webhookResponse := (&response.WebhookResponse{}).FromEntity(subscription)
+	return c.Status(http.StatusOK).JSON(webhookResponse)
+}
+
+// DeleteWebhook godoc
+//
+//	@Summary		Delete Webhook and its Deliveries
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id path int true "Webhook ID"
+//	@Success  		200 "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/webhooks/{id} [delete]
+func (w *WebhookController) DeleteWebhook(c *fiber.Ctx) error {
+	id := c.Params("id")
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	if err := w.webhookService.DeleteSubscription(c.UserContext(), webhookID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(http.StatusOK)
+}
+
+// GetWebhookDeliveries godoc
+//
+//	@Summary		Get the Latest Deliveries of a Webhook
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id path int true "Webhook ID"
+//	@Success		200 {object} []response.WebhookDeliveryResponse "Ok"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/webhooks/{id}/deliveries [get]
+func (w *WebhookController) GetWebhookDeliveries(c *fiber.Ctx) error {
+	id := c.Params("id")
+	webhookID, err := strconv.Atoi(id)
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	deliveries, err := w.webhookService.FindDeliveries(c.UserContext(), webhookID)
+	if err != nil {
+		return err
+	}
+
+	deliveryResponses := make([]response.WebhookDeliveryResponse, 0, len(*deliveries))
+	for _, delivery := range *deliveries {
+		deliveryResponses = append(deliveryResponses, (&response.WebhookDeliveryResponse{}).FromEntity(&delivery))
+	}
+
+	return c.Status(http.StatusOK).JSON(deliveryResponses)
+}
+
+// RedeliverWebhook godoc
+//
+//	@Summary		Send a Webhook Delivery Again
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id path int true "Webhook ID"
+//	@Param			deliveryId path int true "Delivery ID"
+//	@Success		202 {object} response.WebhookDeliveryResponse "Accepted"
+//	@Failure		400 {object} response.ProblemResponse "Bad Request"
+//	@Failure		404 {object} response.ProblemResponse "Not Found"
+//	@Failure		401 {object} response.ProblemResponse "Unauthorized"
+//	@Failure		403 {object} response.ProblemResponse "Forbidden"
+//	@Security		BearerAuth
+//	@Router			/webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func (w *WebhookController) RedeliverWebhook(c *fiber.Ctx) error {
+	webhookID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	deliveryID, err := strconv.Atoi(c.Params("deliveryId"))
+	if err != nil {
+		return badRequest("wrong parameter. convert failed", err)
+	}
+
+	delivery, err := w.webhookService.Redeliver(c.UserContext(), webhookID, deliveryID)
+	if err != nil {
+		return err
+	}
+
+	deliveryResponse := (&response.WebhookDeliveryResponse{}).FromEntity(delivery)
+	return c.Status(http.StatusAccepted).JSON(deliveryResponse)
+}
@@ -2,16 +2,36 @@ package request
 
 import (
 	"github.com/go-playground/validator/v10"
+	"reflect"
+	"strings"
 )
 
-var validate = validator.New()
+var validate = newValidator()
+
+// newValidator reports fields by their json or query name, which is what clients send.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "query"} {
+			if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+	return v
+}
 
 type CreateSaleRequest struct {
-	ProductID int     `json:"product_id" validate:"required"`
-	SaleStock int     `json:"saleStock" validate:"required,gt=1"`
-	Discount  float64 `json:"discount" validate:"required,gt=1"`
-	StartTime string  `json:"startTime" validate:"required"`
-	EndTime   string  `json:"endTime" validate:"required"`
+	ProductID      int     `json:"product_id" validate:"required"`
+	SaleStock      int     `json:"saleStock" validate:"required,gt=1"`
+	Discount       float64 `json:"discount" validate:"required,gt=1"`
+	StartTime      string  `json:"startTime" validate:"required"`
+	EndTime        string  `json:"endTime" validate:"required"`
+	MaxPerCustomer int     `json:"maxPerCustomer" validate:"gte=0"`
+	MaxPerOrder    int     `json:"maxPerOrder" validate:"gte=0"`
+	WaitingRoom    bool    `json:"waitingRoom"`
+	AdmissionRate  int     `json:"admissionRate" validate:"gte=0"` // admitted buyers per second
 }
 
 func (req *CreateSaleRequest) Validate() error {
@@ -19,14 +39,140 @@ func (req *CreateSaleRequest) Validate() error {
 }
 
 type UpdateSaleRequest struct {
-	ID        int     `json:"id" validate:"required"`
-	Discount  float64 `json:"discount"`
-	SaleStock int     `json:"saleStock"`
-	StartTime string  `json:"startTime"`
-	EndTime   string  `json:"endTime"`
-	Active    bool    `json:"active"`
+	ID             int     `json:"id" validate:"required"`
+	Discount       float64 `json:"discount"`
+	SaleStock      int     `json:"saleStock"`
+	StartTime      string  `json:"startTime"`
+	EndTime        string  `json:"endTime"`
+	Active         *bool   `json:"active"` // a missing active keeps the sale running or stopped
+	MaxPerCustomer *int    `json:"maxPerCustomer" validate:"omitempty,gte=0"`
+	MaxPerOrder    *int    `json:"maxPerOrder" validate:"omitempty,gte=0"`
+	WaitingRoom    *bool   `json:"waitingRoom"`
+	AdmissionRate  *int    `json:"admissionRate" validate:"omitempty,gte=0"`
 }
 
 func (req *UpdateSaleRequest) Validate() error {
 	return validate.Struct(req)
 }
+
+type BuyProductRequest struct {
+	CustomerID     string `json:"-" validate:"required,max=64"` // the authenticated subject
+	Quantity       int    `json:"quantity" validate:"gte=0"`
+	IdempotencyKey string `json:"-" validate:"max=128"` // from the Idempotency-Key header
+	AdmissionToken string `json:"-"`                    // from the X-Admission-Token header
+}
+
+func (req *BuyProductRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+// GetQuantity returns the requested quantity, a missing quantity buys a single unit.
+func (req *BuyProductRequest) GetQuantity() int {
+	if req.Quantity == 0 {
+		return 1
+	}
+
+	return req.Quantity
+}
+
+type ReservationRequest struct {
+	CustomerID string `json:"-" validate:"required,max=64"` // the authenticated subject
+}
+
+func (req *ReservationRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+type CancelOrderRequest struct {
+	CustomerID string `json:"-" validate:"required,max=64"` // the authenticated subject
+}
+
+func (req *CancelOrderRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+// OrderQuery are the filters of GET /orders. Times use the sale time layout (2006-01-02T15:04),
+// Sort is createdAt or totalPrice, prefixed with - for descending order.
+type OrderQuery struct {
+	SaleID     int    `query:"saleId" validate:"gte=0"`
+	ProductID  int    `query:"productId" validate:"gte=0"`
+	CustomerID string `query:"customerId" validate:"max=64"`
+	Status     string `query:"status" validate:"omitempty,oneof=placed cancelled refunded"`
+	From       string `query:"from"`
+	To         string `query:"to"`
+	Sort       string `query:"sort" validate:"omitempty,oneof=createdAt -createdAt totalPrice -totalPrice"`
+	Limit      int    `query:"limit" validate:"gte=0,lte=100"`
+	Cursor     string `query:"cursor"`
+}
+
+func (req *OrderQuery) Validate() error {
+	return validate.Struct(req)
+}
+
+// SaleQuery are the filters of GET /flash-sales. From and To use the sale time layout (2006-01-02T15:04) and match
+// the sales running at some point between them. Sort is startTime, endTime, discount or createdAt, prefixed with -
+// for descending order.
+type SaleQuery struct {
+	Status    string `query:"status" validate:"omitempty,oneof=upcoming active ended sold_out"`
+	ProductID int    `query:"productId" validate:"gte=0"`
+	From      string `query:"from"`
+	To        string `query:"to"`
+	Sort      string `query:"sort" validate:"omitempty,oneof=startTime -startTime endTime -endTime discount -discount createdAt -createdAt"`
+	Limit     int    `query:"limit" validate:"gte=0,lte=100"`
+	Cursor    string `query:"cursor"`
+}
+
+func (req *SaleQuery) Validate() error {
+	return validate.Struct(req)
+}
+
+type CreateProductRequest struct {
+	Name  string  `json:"name" validate:"required,max=255"`
+	Price float64 `json:"price" validate:"required,gt=0"`
+	Stock int     `json:"stock" validate:"gte=0"`
+}
+
+func (req *CreateProductRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+type UpdateProductRequest struct {
+	ID    int     `json:"id" validate:"required"`
+	Name  string  `json:"name" validate:"max=255"`
+	Price float64 `json:"price" validate:"gte=0"`
+	Stock *int    `json:"stock" validate:"omitempty,gte=0"`
+}
+
+func (req *UpdateProductRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+// NotificationRequest is a message of a notifications websocket client.
+type NotificationRequest struct {
+	Action  string `json:"action" validate:"oneof=subscribe unsubscribe"`
+	SaleIDs []int  `json:"saleIds" validate:"required,max=50"`
+}
+
+func (req *NotificationRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+// CreateWebhookRequest subscribes URL to the given event types. Secret signs the deliveries.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,startswith=http,max=2048"`
+	Secret string   `json:"secret" validate:"required,min=16,max=128"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=SalePurchased SaleCreated SaleUpdated SaleDeleted SaleSoldOut OrderCancelled OrderRefunded"`
+}
+
+func (req *CreateWebhookRequest) Validate() error {
+	return validate.Struct(req)
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=sales:read sales:write orders:read"`
+}
+
+func (req *CreateAPIKeyRequest) Validate() error {
+	return validate.Struct(req)
+}
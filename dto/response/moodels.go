@@ -2,43 +2,320 @@ package response
 
 import (
 	"flash_sale_management/entity"
+	"flash_sale_management/queue"
+	"flash_sale_management/service"
+	"math"
 	"time"
 )
 
 type SaleResponse struct {
-	ProductID int       `json:"product_id"`
-	SaleStock int       `json:"saleStock"`
-	Discount  float64   `json:"discount"`
-	StartTime time.Time `json:"startTime"`
-	EndTime   time.Time `json:"endTime"`
-	Active    bool      `json:"active"`
+	ID             int       `json:"id"`
+	ProductID      int       `json:"product_id"`
+	SaleStock      int       `json:"saleStock"`
+	Discount       float64   `json:"discount"`
+	StartTime      time.Time `json:"startTime"`
+	EndTime        time.Time `json:"endTime"`
+	Active         bool      `json:"active"`
+	MaxPerCustomer int       `json:"maxPerCustomer"`
+	MaxPerOrder    int       `json:"maxPerOrder"`
+	WaitingRoom    bool      `json:"waitingRoom"`
+	AdmissionRate  int       `json:"admissionRate"`
 }
 
 func (c *SaleResponse) FromEntity(sale *entity.Sale) SaleResponse {
 	return SaleResponse{
-		ProductID: sale.ProductID,
-		SaleStock: sale.SaleStock,
-		Discount:  sale.Discount,
-		StartTime: sale.StartTime,
-		EndTime:   sale.EndTime,
-		Active:    sale.Active,
+		ID:             sale.ID,
+		ProductID:      sale.ProductID,
+		SaleStock:      sale.SaleStock,
+		Discount:       sale.Discount,
+		StartTime:      sale.StartTime,
+		EndTime:        sale.EndTime,
+		Active:         sale.Active,
+		MaxPerCustomer: sale.MaxPerCustomer,
+		MaxPerOrder:    sale.MaxPerOrder,
+		WaitingRoom:    sale.WaitingRoom,
+		AdmissionRate:  sale.AdmissionRate,
 	}
 }
 
+type ReservationResponse struct {
+	ID         int       `json:"id"`
+	SaleID     int       `json:"saleId"`
+	ProductID  int       `json:"product_id"`
+	CustomerID string    `json:"customerId"`
+	Quantity   int       `json:"quantity"`
+	Status     string    `json:"status"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	OrderID    *int      `json:"orderId,omitempty"`
+}
+
+func (c *ReservationResponse) FromEntity(reservation *entity.Reservation) ReservationResponse {
+	return ReservationResponse{
+		ID:         reservation.ID,
+		SaleID:     reservation.SaleID,
+		ProductID:  reservation.ProductID,
+		CustomerID: reservation.CustomerID,
+		Quantity:   reservation.Quantity,
+		Status:     reservation.Status,
+		ExpiresAt:  reservation.ExpiresAt,
+		OrderID:    reservation.SaleLogID,
+	}
+}
+
+type QueueStatusResponse struct {
+	Token                string `json:"token"`
+	Position             int64  `json:"position"`
+	Admitted             bool   `json:"admitted"`
+	EstimatedWaitSeconds int64  `json:"estimatedWaitSeconds"`
+}
+
+func (c *QueueStatusResponse) FromStatus(status *queue.Status) QueueStatusResponse {
+	return QueueStatusResponse{
+		Token:                status.Token,
+		Position:             status.Position,
+		Admitted:             status.Admitted,
+		EstimatedWaitSeconds: int64(math.Ceil(status.EstimatedWait.Seconds())),
+	}
+}
+
+type SaleStreamResponse struct {
+	SaleID          int   `json:"saleId"`
+	SaleStock       int   `json:"saleStock"`
+	Active          bool  `json:"active"`
+	Deleted         bool  `json:"deleted"`
+	StartsInSeconds int64 `json:"startsInSeconds"`
+	EndsInSeconds   int64 `json:"endsInSeconds"`
+}
+
+// FromEvent counts down to the start and end of the sale from now, 0 once they have passed.
+func (c *SaleStreamResponse) FromEvent(event service.SaleEvent, now time.Time) SaleStreamResponse {
+	streamResponse := SaleStreamResponse{
+		SaleID:    event.SaleID,
+		SaleStock: event.SaleStock,
+		Active:    event.Active,
+		Deleted:   event.Deleted,
+	}
+	if event.Deleted {
+		return streamResponse
+	}
+
+	if startsIn := event.StartTime.Sub(now); startsIn > 0 {
+		streamResponse.StartsInSeconds = int64(math.Ceil(startsIn.Seconds()))
+	}
+	if endsIn := event.EndTime.Sub(now); endsIn > 0 {
+		streamResponse.EndsInSeconds = int64(math.Ceil(endsIn.Seconds()))
+	}
+
+	return streamResponse
+}
+
+type SaleStatsResponse struct {
+	SaleID               int                          `json:"saleId"`
+	UnitsSold            int64                        `json:"unitsSold"`
+	Revenue              float64                      `json:"revenue"`
+	DiscountGiven        float64                      `json:"discountGiven"`
+	SellThrough          float64                      `json:"sellThrough"`
+	TimeToSellOutSeconds *int64                       `json:"timeToSellOutSeconds"`
+	UniqueCustomers      int64                        `json:"uniqueCustomers"`
+	PurchasesPerMinute   []PurchasesPerMinuteResponse `json:"purchasesPerMinute"`
+}
+
+type PurchasesPerMinuteResponse struct {
+	Minute    time.Time `json:"minute"`
+	Purchases int64     `json:"purchases"`
+	Units     int64     `json:"units"`
+}
+
+func (c *SaleStatsResponse) FromStats(stats *service.SaleStats) SaleStatsResponse {
+	perMinute := make([]PurchasesPerMinuteResponse, 0, len(stats.PerMinute))
+	for _, minute := range stats.PerMinute {
+		perMinute = append(perMinute, PurchasesPerMinuteResponse{
+			Minute:    minute.Minute,
+			Purchases: minute.Purchases,
+			Units:     minute.Units,
+		})
+	}
+
+	statsResponse := SaleStatsResponse{
+		SaleID:             stats.SaleID,
+		UnitsSold:          stats.UnitsSold,
+		Revenue:            stats.Revenue,
+		DiscountGiven:      stats.DiscountGiven,
+		SellThrough:        stats.SellThrough,
+		UniqueCustomers:    stats.UniqueCustomers,
+		PurchasesPerMinute: perMinute,
+	}
+	if stats.TimeToSellOut != nil {
+		seconds := int64(stats.TimeToSellOut.Seconds())
+		statsResponse.TimeToSellOutSeconds = &seconds
+	}
+
+	return statsResponse
+}
+
 type BuyProductResponse struct {
+	ID                    int       `json:"id"`
+	SaleID                *int      `json:"saleId"`
 	ProductID             int       `json:"product_id"`
+	CustomerID            string    `json:"customerId"`
 	RemainingSaleStock    int       `json:"RemainingSaleStock"`
 	RemainingProductStock int       `json:"remainingProductStock"`
+	Quantity              int       `json:"quantity"`
+	OriginalPrice         float64   `json:"originalPrice"`
+	Discount              float64   `json:"discount"`
 	Price                 float64   `json:"price"`
+	TotalPrice            float64   `json:"totalPrice"`
+	Status                string    `json:"status"`
 	BuyTime               time.Time `json:"time"`
 }
 
 func (c *BuyProductResponse) FromEntity(log entity.SaleLog) BuyProductResponse {
 	return BuyProductResponse{
+		ID:                    log.ID,
+		SaleID:                log.SaleID,
 		ProductID:             log.ProductID,
+		CustomerID:            log.CustomerID,
 		RemainingSaleStock:    log.RemainingSaleStock,
 		RemainingProductStock: log.RemainingProductStock,
+		Quantity:              log.Quantity,
+		OriginalPrice:         log.OriginalPrice,
+		Discount:              log.Discount,
 		Price:                 log.Price,
+		TotalPrice:            log.TotalPrice,
+		Status:                log.Status,
 		BuyTime:               log.CreatedAt,
 	}
 }
+
+type OrderPageResponse struct {
+	Orders     []BuyProductResponse `json:"orders"`
+	NextCursor string               `json:"nextCursor,omitempty"`
+}
+
+func (c *OrderPageResponse) FromEntities(orders []entity.SaleLog, nextCursor string) OrderPageResponse {
+	orderResponses := make([]BuyProductResponse, 0, len(orders))
+	for _, order := range orders {
+		orderResponses = append(orderResponses, (&BuyProductResponse{}).FromEntity(order))
+	}
+
+	return OrderPageResponse{Orders: orderResponses, NextCursor: nextCursor}
+}
+
+type ProductResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Price     float64   `json:"price"`
+	Stock     int       `json:"stock"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (c *ProductResponse) FromEntity(product *entity.Product) ProductResponse {
+	return ProductResponse{
+		ID:        product.ID,
+		Name:      product.Name,
+		Price:     product.Price,
+		Stock:     product.Stock,
+		CreatedAt: product.CreatedAt,
+		UpdatedAt: product.UpdatedAt,
+	}
+}
+
+// WebhookResponse leaves out the secret, it is only known to the subscriber.
+type WebhookResponse struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (c *WebhookResponse) FromEntity(subscription *entity.WebhookSubscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Events:    subscription.Events(),
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+	}
+}
+
+type WebhookDeliveryResponse struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscriptionId"`
+	EventID        int        `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+func (c *WebhookDeliveryResponse) FromEntity(delivery *entity.WebhookDelivery) WebhookDeliveryResponse {
+	deliveryResponse := WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		SubscriptionID: delivery.SubscriptionID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+
+	// only a pending delivery is attempted again
+	if delivery.Status == entity.WebhookDeliveryPending {
+		deliveryResponse.NextAttemptAt = &delivery.NextAttemptAt
+	}
+
+	return deliveryResponse
+}
+
+type APIKeyResponse struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (c *APIKeyResponse) FromEntity(apiKey *entity.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.ScopeList(),
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+// CreatedAPIKeyResponse is the only response with the key itself, it can't be read again.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func (c *CreatedAPIKeyResponse) FromEntity(apiKey *entity.APIKey, key string) CreatedAPIKeyResponse {
+	return CreatedAPIKeyResponse{APIKeyResponse: (&APIKeyResponse{}).FromEntity(apiKey), Key: key}
+}
+
+// ProblemResponse is the problem details (RFC 7807) body of every error response. Code is stable and meant for
+// clients to switch on, Detail is for humans.
+type ProblemResponse struct {
+	Type     string               `json:"type"`
+	Title    string               `json:"title"`
+	Status   int                  `json:"status"`
+	Code     string               `json:"code"`
+	Detail   string               `json:"detail,omitempty"`
+	Instance string               `json:"instance,omitempty"`
+	Errors   []service.FieldError `json:"errors,omitempty"`
+}
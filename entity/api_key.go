@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"flash_sale_management/dto/request"
+	"strings"
+	"time"
+)
+
+// APIKey authenticates a back-office integration. Only the SHA-256 Hash of the key is stored, Prefix is the
+// public part of the key it is looked up by. Scopes is a comma separated list.
+type APIKey struct {
+	ID         int        `gorm:"primaryKey;autoIncrement"`
+	Name       string     `gorm:"type:varchar(100);not null"`
+	Prefix     string     `gorm:"type:varchar(16);not null;uniqueIndex"`
+	Hash       string     `gorm:"type:varchar(64);not null"`
+	Scopes     string     `gorm:"type:varchar(255);not null"`
+	LastUsedAt *time.Time `gorm:"type:timestamp"`
+	RevokedAt  *time.Time `gorm:"type:timestamp"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+}
+
+func (k *APIKey) FromDto(request request.CreateAPIKeyRequest) *APIKey {
+	k.Name = request.Name
+	k.Scopes = strings.Join(request.Scopes, ",")
+
+	return k
+}
+
+func (k *APIKey) ScopeList() []string {
+	return strings.Split(k.Scopes, ",")
+}
+
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// CustomerPurchase counts the units a customer bought from a sale, used to enforce Sale.MaxPerCustomer.
+type CustomerPurchase struct {
+	SaleID     int       `gorm:"primaryKey;autoIncrement:false"`
+	CustomerID string    `gorm:"primaryKey;type:varchar(64)"`
+	Quantity   int       `gorm:"type:int;not null;check:quantity >= 0"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// Domain event types written to the outbox.
+const (
+	SalePurchased = "SalePurchased"
+	SaleCreated   = "SaleCreated"
+	SaleUpdated   = "SaleUpdated"
+	SaleDeleted   = "SaleDeleted"
+	SaleSoldOut   = "SaleSoldOut"
+
+	// the order statuses already use the plain names
+	OrderCancelledEvent = "OrderCancelled"
+	OrderRefundedEvent  = "OrderRefunded"
+)
+
+// OutboxEvent is a domain event written in the transaction of the change it describes.
+// The relay publishes it and retries at NextAttemptAt until PublishedAt is set.
+type OutboxEvent struct {
+	ID            int        `gorm:"primaryKey;autoIncrement"`
+	Type          string     `gorm:"type:varchar(32);not null"`
+	SaleID        int        `gorm:"type:int;not null"`
+	Payload       string     `gorm:"type:jsonb;not null"`
+	Attempts      int        `gorm:"type:int;not null;default:0"`
+	LastError     string     `gorm:"type:text"`
+	NextAttemptAt time.Time  `gorm:"type:timestamp;not null;index:idx_outbox_events_pending,where:published_at IS NULL"`
+	PublishedAt   *time.Time `gorm:"type:timestamp"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"flash_sale_management/dto/request"
 	"time"
 )
 
@@ -12,3 +13,27 @@ type Product struct {
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
+
+func (product *Product) FromDto(request request.CreateProductRequest) *Product {
+	product.Name = request.Name
+	product.Price = request.Price
+	product.Stock = request.Stock
+
+	return product
+}
+
+func (product *Product) FromUpdateDto(request request.UpdateProductRequest) *Product {
+	if request.Name != "" {
+		product.Name = request.Name
+	}
+
+	if request.Price > 0 {
+		product.Price = request.Price
+	}
+
+	if request.Stock != nil {
+		product.Stock = *request.Stock
+	}
+
+	return product
+}
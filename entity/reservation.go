@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+const (
+	ReservationHeld      = "held"
+	ReservationConfirmed = "confirmed"
+	ReservationCancelled = "cancelled"
+	ReservationExpired   = "expired"
+)
+
+// Reservation holds Quantity units of a sale's stock for a customer until ExpiresAt.
+// Confirming turns it into an order (SaleLog), cancelled and expired reservations give the units back to the sale.
+type Reservation struct {
+	ID         int       `gorm:"primaryKey;autoIncrement"`
+	SaleID     int       `gorm:"type:int;not null;index"`
+	ProductID  int       `gorm:"type:int;not null"`
+	CustomerID string    `gorm:"type:varchar(64);not null;index"`
+	Quantity   int       `gorm:"type:int;not null"`
+	Status     string    `gorm:"type:varchar(16);not null;default:held;index:idx_reservations_status_expires_at,priority:1"`
+	ExpiresAt  time.Time `gorm:"type:timestamp;not null;index:idx_reservations_status_expires_at,priority:2"`
+	SaleLogID  *int      `gorm:"type:int"`
+	// IdempotencyKey is the customer's Idempotency-Key, a retried reserve returns the reservation it made
+	IdempotencyKey *string   `gorm:"type:varchar(200);uniqueIndex"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+// IsExpired reports whether a held reservation ran out of time.
+func (r *Reservation) IsExpired(now time.Time) bool {
+	return r.Status == ReservationHeld && !now.Before(r.ExpiresAt)
+}
@@ -9,21 +9,37 @@ import (
 )
 
 type Sale struct {
-	ID        int       `gorm:"primaryKey;autoIncrement"`
-	ProductID int       `gorm:"type:int;not null"`
-	SaleStock int       `gorm:"type:int;not null"`
-	Discount  float64   `gorm:"type:decimal(10,2);not null"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoCreateTime"`
-	StartTime time.Time `gorm:"type:timestamp;not null"`
-	EndTime   time.Time `gorm:"type:timestamp;not null"`
-	Active    bool      `gorm:"default:false"`
+	ID        int      `gorm:"primaryKey;autoIncrement"`
+	ProductID int      `gorm:"type:int;not null"`
+	Product   *Product `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-"` // products with sales can't be deleted
+	SaleStock int      `gorm:"type:int;not null"`
+	// InitialStock is the stock the sale offered, sold and held units included. A new sale stock moves it along.
+	InitialStock   int       `gorm:"type:int;not null;default:0"`
+	Discount       float64   `gorm:"type:decimal(10,2);not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoCreateTime"`
+	StartTime      time.Time `gorm:"type:timestamp;not null"`
+	EndTime        time.Time `gorm:"type:timestamp;not null"`
+	Active         bool      `gorm:"default:false"`
+	MaxPerCustomer int       `gorm:"type:int;not null;default:0"` // 0 means unlimited
+	MaxPerOrder    int       `gorm:"type:int;not null;default:0"` // 0 means unlimited
+	// ActivatedAt is set on the first activation, the scheduler never re-activates a sale that was switched off by hand.
+	// It is cleared when the scheduler switches a sale off for selling out, so restocked sales are switched on again.
+	ActivatedAt *time.Time `gorm:"type:timestamp"`
+	// WaitingRoom sales only accept buyers admitted from the queue, AdmissionRate of them per second
+	WaitingRoom   bool `gorm:"default:false"`
+	AdmissionRate int  `gorm:"type:int;not null;default:0"`
 }
 
 func (sale *Sale) FromDto(request request.CreateSaleRequest) (*Sale, error) {
 	sale.ProductID = request.ProductID
 	sale.SaleStock = request.SaleStock
+	sale.InitialStock = request.SaleStock
 	sale.Discount = request.Discount
+	sale.MaxPerCustomer = request.MaxPerCustomer
+	sale.MaxPerOrder = request.MaxPerOrder
+	sale.WaitingRoom = request.WaitingRoom
+	sale.AdmissionRate = request.AdmissionRate
 
 	sTime, err := formatTime(request.StartTime)
 	if err != nil {
@@ -50,6 +66,7 @@ func (sale *Sale) FromDto(request request.CreateSaleRequest) (*Sale, error) {
 
 func (sale *Sale) FromUpdateDto(request request.UpdateSaleRequest) (*Sale, error) {
 	if request.SaleStock > 0 {
+		sale.InitialStock += request.SaleStock - sale.SaleStock
 		sale.SaleStock = request.SaleStock
 	}
 
@@ -57,6 +74,22 @@ func (sale *Sale) FromUpdateDto(request request.UpdateSaleRequest) (*Sale, error
 		sale.Discount = request.Discount
 	}
 
+	if request.MaxPerCustomer != nil {
+		sale.MaxPerCustomer = *request.MaxPerCustomer
+	}
+
+	if request.MaxPerOrder != nil {
+		sale.MaxPerOrder = *request.MaxPerOrder
+	}
+
+	if request.WaitingRoom != nil {
+		sale.WaitingRoom = *request.WaitingRoom
+	}
+
+	if request.AdmissionRate != nil {
+		sale.AdmissionRate = *request.AdmissionRate
+	}
+
 	if request.StartTime != "" {
 		t, err := formatTime(request.StartTime)
 		if err != nil {
@@ -75,8 +108,13 @@ func (sale *Sale) FromUpdateDto(request request.UpdateSaleRequest) (*Sale, error
 		sale.EndTime = *t
 	}
 
-	if request.Active != sale.Active {
-		sale.Active = request.Active
+	if request.Active != nil {
+		sale.Active = *request.Active
+	}
+
+	if sale.Active && sale.ActivatedAt == nil {
+		now := time.Now()
+		sale.ActivatedAt = &now
 	}
 
 	return sale, nil
@@ -2,11 +2,27 @@ package entity
 
 import "time"
 
+const (
+	OrderPlaced    = "placed"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
 type SaleLog struct {
 	ID                    int       `gorm:"primaryKey;autoIncrement"`
-	ProductID             int       `gorm:"type:int;not null"`
+	SaleID                *int      `gorm:"type:int;index:idx_sale_logs_sale_created_at,priority:1"`         // nil for old orders the backfill could not attribute
+	Sale                  *Sale     `gorm:"foreignKey:SaleID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"` // sales with orders can't be deleted
+	ProductID             int       `gorm:"type:int;not null;index:idx_sale_logs_product_created_at,priority:1"`
+	CustomerID            string    `gorm:"type:varchar(64);index"`
 	RemainingSaleStock    int       `gorm:"type:int;not null"`
 	RemainingProductStock int       `gorm:"type:int;not null"`
-	Price                 float64   `gorm:"type:decimal(10,2);not null"`
-	CreatedAt             time.Time `gorm:"autoCreateTime"`
+	Quantity              int       `gorm:"type:int;not null;default:1"`
+	OriginalPrice         float64   `gorm:"type:decimal(10,2);not null;default:0"` // unit price before the discount
+	Discount              float64   `gorm:"type:decimal(10,2);not null;default:0"` // discount percentage of the sale
+	Price                 float64   `gorm:"type:decimal(10,2);not null"`           // discounted unit price
+	TotalPrice            float64   `gorm:"type:decimal(10,2);not null;default:0"`
+	IdempotencyKey        *string   `gorm:"type:varchar(200);uniqueIndex"`
+	Status                string    `gorm:"type:varchar(16);not null;default:placed;index"` // placed, cancelled or refunded
+	CreatedAt             time.Time `gorm:"autoCreateTime;index;index:idx_sale_logs_product_created_at,priority:2;index:idx_sale_logs_sale_created_at,priority:2"`
+	UpdatedAt             time.Time `gorm:"autoUpdateTime"`
 }
@@ -0,0 +1,65 @@
+package entity
+
+import (
+	"flash_sale_management/dto/request"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookSubscription receives the events of EventTypes, a comma separated list, at URL.
+// Deliveries are signed with Secret.
+type WebhookSubscription struct {
+	ID         int       `gorm:"primaryKey;autoIncrement"`
+	URL        string    `gorm:"type:varchar(2048);not null"`
+	Secret     string    `gorm:"type:varchar(128);not null"`
+	EventTypes string    `gorm:"type:varchar(512);not null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (w *WebhookSubscription) FromDto(request request.CreateWebhookRequest) *WebhookSubscription {
+	w.URL = request.URL
+	w.Secret = request.Secret
+	w.EventTypes = strings.Join(request.Events, ",")
+
+	return w
+}
+
+func (w *WebhookSubscription) Events() []string {
+	return strings.Split(w.EventTypes, ",")
+}
+
+func (w *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, subscribed := range w.Events() {
+		if subscribed == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery is one event sent to one subscription. Body is sent unchanged on every attempt,
+// failed attempts are retried at NextAttemptAt until the delivery is delivered or gives up as failed.
+type WebhookDelivery struct {
+	ID             int                  `gorm:"primaryKey;autoIncrement"`
+	SubscriptionID int                  `gorm:"type:int;not null;uniqueIndex:idx_webhook_deliveries_subscription_event,priority:1"`
+	Subscription   *WebhookSubscription `gorm:"foreignKey:SubscriptionID;constraint:OnDelete:CASCADE"`
+	EventID        int                  `gorm:"type:int;not null;uniqueIndex:idx_webhook_deliveries_subscription_event,priority:2"`
+	EventType      string               `gorm:"type:varchar(32);not null"`
+	Body           string               `gorm:"type:text;not null"`
+	Status         string               `gorm:"type:varchar(16);not null;default:pending"`
+	Attempts       int                  `gorm:"type:int;not null;default:0"`
+	NextAttemptAt  time.Time            `gorm:"type:timestamp;not null;index:idx_webhook_deliveries_pending,where:status = 'pending'"`
+	ResponseStatus int                  `gorm:"type:int;not null;default:0"`
+	LastError      string               `gorm:"type:text"`
+	DeliveredAt    *time.Time           `gorm:"type:timestamp"`
+	CreatedAt      time.Time            `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time            `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher keeps the published messages in memory, for tests and local runs without a broker.
+type MemoryPublisher struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, message Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// Messages returns a copy of the messages published so far.
+func (p *MemoryPublisher) Messages() []Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]Message(nil), p.messages...)
+}
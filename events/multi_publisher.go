@@ -0,0 +1,27 @@
+package events
+
+import (
+	"context"
+	"errors"
+)
+
+// MultiPublisher hands every message to all of its publishers. A message one of them rejected is published
+// to all of them again on the retry, so the publishers need to tolerate duplicates, as consumers already do.
+type MultiPublisher struct {
+	publishers []Publisher
+}
+
+func NewMultiPublisher(publishers ...Publisher) *MultiPublisher {
+	return &MultiPublisher{publishers: publishers}
+}
+
+func (p *MultiPublisher) Publish(ctx context.Context, message Message) error {
+	var errs []error
+	for _, publisher := range p.publishers {
+		if err := publisher.Publish(ctx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
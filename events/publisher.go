@@ -0,0 +1,22 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Message is a domain event handed to downstream systems. ID is unique per event and grows with the order the
+// changes of a sale were made, consumers use it to drop duplicates and to put late deliveries back in order.
+type Message struct {
+	ID         int             `json:"id"`
+	Type       string          `json:"type"`
+	SaleID     int             `json:"saleId"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurredAt"`
+}
+
+// Publisher delivers messages to a broker. A returned error makes the relay try the message again later.
+type Publisher interface {
+	Publish(ctx context.Context, message Message) error
+}
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// RedisStreamPublisher appends messages to a redis stream, consumers read it with their own consumer groups.
+// The stream is trimmed to about maxLen entries, 0 keeps every entry.
+type RedisStreamPublisher struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamPublisher(client *redis.Client, stream string, maxLen int64) *RedisStreamPublisher {
+	return &RedisStreamPublisher{client: client, stream: stream, maxLen: maxLen}
+}
+
+func (p *RedisStreamPublisher) Publish(ctx context.Context, message Message) error {
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: map[string]interface{}{
+			"id":         strconv.Itoa(message.ID),
+			"type":       message.Type,
+			"saleId":     strconv.Itoa(message.SaleID),
+			"payload":    string(message.Payload),
+			"occurredAt": message.OccurredAt.Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
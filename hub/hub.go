@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// Notification types sent to the subscribers of a sale.
+const (
+	SaleStarting = "starting"
+	SaleStarted  = "started"
+	SaleLowStock = "low_stock"
+	SaleSoldOut  = "sold_out"
+	SaleEnded    = "ended"
+)
+
+type Event struct {
+	Type      string    `json:"type"`
+	SaleID    int       `json:"saleId"`
+	SaleStock int       `json:"saleStock"`
+	Time      time.Time `json:"time"`
+}
+
+// Client is a connection subscribed to any number of sales.
+type Client struct {
+	events  chan Event
+	sales   map[int]struct{}
+	closed  bool
+	dropped bool
+}
+
+// Events is closed when the client is unregistered or dropped for being too slow.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Dropped reports whether the client was disconnected because it didn't keep up with its events.
+// Only valid once Events is closed.
+func (c *Client) Dropped() bool {
+	return c.dropped
+}
+
+// Hub delivers sale notifications to the clients subscribed to the sale.
+// Publishing never waits for a client: one whose buffer is full is dropped, it can reconnect and subscribe again.
+type Hub struct {
+	mutex         sync.Mutex
+	subscriptions map[int]map[*Client]struct{}
+	bufferSize    int
+}
+
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+
+	return &Hub{subscriptions: make(map[int]map[*Client]struct{}), bufferSize: bufferSize}
+}
+
+func (h *Hub) Register() *Client {
+	return &Client{events: make(chan Event, h.bufferSize), sales: make(map[int]struct{})}
+}
+
+func (h *Hub) Subscribe(client *Client, saleID int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if client.closed {
+		return
+	}
+
+	if h.subscriptions[saleID] == nil {
+		h.subscriptions[saleID] = make(map[*Client]struct{})
+	}
+	h.subscriptions[saleID][client] = struct{}{}
+	client.sales[saleID] = struct{}{}
+}
+
+func (h *Hub) Unsubscribe(client *Client, saleID int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.unsubscribe(client, saleID)
+}
+
+// Unregister removes the client from all its sales and closes its events, it can be called more than once.
+func (h *Hub) Unregister(client *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.close(client)
+}
+
+func (h *Hub) Publish(event Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.subscriptions[event.SaleID] {
+		select {
+		case client.events <- event:
+		default:
+			client.dropped = true
+			h.close(client)
+		}
+	}
+}
+
+func (h *Hub) close(client *Client) {
+	if client.closed {
+		return
+	}
+
+	for saleID := range client.sales {
+		h.unsubscribe(client, saleID)
+	}
+	client.closed = true
+	close(client.events)
+}
+
+func (h *Hub) unsubscribe(client *Client, saleID int) {
+	delete(client.sales, saleID)
+	delete(h.subscriptions[saleID], client)
+	if len(h.subscriptions[saleID]) == 0 {
+		delete(h.subscriptions, saleID)
+	}
+}
@@ -4,6 +4,16 @@ import "flash_sale_management/config"
 
 // @contact.name   Flash Sale Management
 // @contact.email  jerdem.akyildiz@gmail.com
+
+// @securityDefinitions.apikey	BearerAuth
+// @in							header
+// @name						Authorization
+// @description				"Bearer " followed by a JWT with the sub and role (admin or customer) claims
+
+// @securityDefinitions.apikey	APIKeyAuth
+// @in							header
+// @name						X-API-Key
+// @description				API key of a back-office integration, created by an admin
 func main() {
 	config.StartServer()
 }
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/auth"
+	"flash_sale_management/utils"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strings"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+const principalLocal = "principal"
+
+// TokenVerifier resolves the principal of a bearer token.
+type TokenVerifier interface {
+	Verify(token string) (*auth.Principal, error)
+}
+
+// APIKeyResolver resolves the principal of an API key.
+type APIKeyResolver interface {
+	Resolve(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// Authenticate lets only requests with a valid "Authorization: Bearer <token>" or X-API-Key header through,
+// the others are answered with 401 Unauthorized. The principal is available with Principal.
+// API keys that can't be looked up are answered by the error handler instead of with 401.
+func Authenticate(verifier TokenVerifier, apiKeys APIKeyResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if key := c.Get(APIKeyHeader); key != "" {
+			principal, err := apiKeys.Resolve(c.UserContext(), key)
+			if errors.Is(err, auth.ErrInvalidAPIKey) {
+				return unauthorized(c, "invalid api key")
+			}
+			if err != nil {
+				// the key couldn't be checked, the error handler answers it with 500 or 503
+				return err
+			}
+
+			c.Locals(principalLocal, principal)
+			return c.Next()
+		}
+
+		token, ok := bearerToken(c.Get(fiber.HeaderAuthorization))
+		if !ok {
+			return unauthorized(c, "missing bearer token or api key")
+		}
+
+		principal, err := verifier.Verify(token)
+		if err != nil {
+			utils.CreateLogMessage("invalid bearer token", err)
+			return unauthorized(c, "invalid bearer token")
+		}
+
+		c.Locals(principalLocal, principal)
+		return c.Next()
+	}
+}
+
+// RequireRole answers requests of principals without one of the roles with 403 Forbidden.
+// It runs after Authenticate.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := Principal(c)
+		if principal == nil {
+			return unauthorized(c, "missing bearer token or api key")
+		}
+
+		if !principal.HasRole(roles...) {
+			return fiber.NewError(http.StatusForbidden, "forbidden")
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireScope answers requests of principals without the scope, or one of the roles, with 403 Forbidden.
+// Admins have every scope. It runs after Authenticate.
+func RequireScope(scope string, roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := Principal(c)
+		if principal == nil {
+			return unauthorized(c, "missing bearer token or api key")
+		}
+
+		if !principal.HasScope(scope) && !principal.HasRole(roles...) {
+			return fiber.NewError(http.StatusForbidden, "forbidden")
+		}
+
+		return c.Next()
+	}
+}
+
+// Principal returns the authenticated caller, nil on routes without authentication.
+func Principal(c *fiber.Ctx) *auth.Principal {
+	principal, _ := c.Locals(principalLocal).(*auth.Principal)
+	return principal
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+func unauthorized(c *fiber.Ctx, message string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+	return fiber.NewError(http.StatusUnauthorized, message)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// Deadline gives every request timeout to finish. Handlers pass c.UserContext() down to the services, so when
+// the deadline passes the database and redis calls still running are cancelled and the request is answered
+// with 503. A timeout of zero leaves requests unbounded.
+func Deadline(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/utils"
+	"net/http"
+	"strings"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// kindStatuses maps the service error kinds to their status code.
+var kindStatuses = map[string]int{
+	service.KindNotFound:        http.StatusNotFound,
+	service.KindValidation:      http.StatusBadRequest,
+	service.KindConflict:        http.StatusConflict,
+	service.KindSoldOut:         http.StatusConflict,
+	service.KindSaleNotStarted:  http.StatusConflict,
+	service.KindSaleEnded:       http.StatusConflict,
+	service.KindSaleInactive:    http.StatusConflict,
+	service.KindLimitExceeded:   http.StatusUnprocessableEntity,
+	service.KindAdmissionDenied: http.StatusForbidden,
+}
+
+// ErrorHandler is the fiber error handler, it answers every error returned by a handler with a problem details body.
+// Errors without a kind are answered with 500 and a generic detail, so database and redis errors don't leak.
+// Requests that ran out of time are answered with 503.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	problem := newProblem(err)
+	problem.Instance = c.Path()
+
+	return c.Status(problem.Status).JSON(problem, ProblemContentType)
+}
+
+func newProblem(err error) response.ProblemResponse {
+	var fiberError *fiber.Error
+	if errors.As(err, &fiberError) {
+		return problem(fiberError.Code, statusCode(fiberError.Code), fiberError.Message)
+	}
+
+	if serviceError := service.AsError(err); serviceError != nil {
+		status, ok := kindStatuses[serviceError.Kind]
+		if !ok {
+			status = http.StatusBadRequest
+		}
+
+		result := problem(status, serviceError.Kind, serviceError.Error())
+		result.Errors = serviceError.Fields
+		return result
+	}
+
+	// the request's deadline passed while the database or redis was still working on it
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warnf("request deadline exceeded: %v", err)
+		return problem(http.StatusServiceUnavailable, statusCode(http.StatusServiceUnavailable), "the request took too long, please try again")
+	}
+
+	log.Errorf("unhandled error: %v", err)
+	return problem(http.StatusInternalServerError, statusCode(http.StatusInternalServerError), "something went wrong, please try again later")
+}
+
+func problem(status int, code string, detail string) response.ProblemResponse {
+	return response.ProblemResponse{
+		Type:   "about:blank",
+		Title:  utils.StatusMessage(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// statusCode makes the error code of errors without a kind from their status, e.g. too_many_requests.
+func statusCode(status int) string {
+	return strings.ToLower(strings.ReplaceAll(utils.StatusMessage(status), " ", "_"))
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flash_sale_management/service"
+	"flash_sale_management/utils"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"time"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+const IdempotencyReplayedHeader = "Idempotent-Replayed"
+const IdempotencyKey = "KEY_IDEMPOTENCY:%s:%s:%s"
+
+const idempotencyProcessing = "processing"
+const idempotencyCompleted = "completed"
+
+type idempotencyRecord struct {
+	State       string `json:"state"`
+	BodyHash    string `json:"bodyHash"` // a key is bound to the body of the request that claimed it
+	StatusCode  int    `json:"statusCode,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotency replays the stored outcome of the first request for retries with the same Idempotency-Key header.
+// While the first request is still running, duplicates are answered with 409 Conflict, and a key reused with a
+// different body is answered with 422 Unprocessable Entity. Only 2xx and 4xx outcomes are stored, after a server
+// error or a timeout the key is freed so a retry is processed again. A timed out request may still have committed,
+// the handlers keep the key in the database too, so the retry settles to the committed order or reservation.
+// lockTimeout bounds how long an unfinished request blocks its key, ttl is how long outcomes are kept.
+func Idempotency(redisService service.RedisServiceInterface, lockTimeout time.Duration, ttl time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyHeader)
+		if key == "" {
+			return c.Next()
+		}
+
+		// keys are chosen by the clients, so they are only unique per caller
+		if principal := Principal(c); principal != nil {
+			key = principal.Subject + ":" + key
+		}
+		redisKey := fmt.Sprintf(IdempotencyKey, c.Method(), c.Path(), key)
+		bodyHash := hashBody(c.Body())
+		ctx := c.UserContext()
+
+		claimed, err := redisService.SetNX(ctx, redisKey, idempotencyRecord{State: idempotencyProcessing, BodyHash: bodyHash}, lockTimeout)
+		if err != nil {
+			utils.CreateLogMessage("error claiming idempotency key", err)
+			return err
+		}
+
+		if !claimed {
+			return replay(c, redisService, redisKey, bodyHash)
+		}
+
+		handlerErr := c.Next()
+
+		// the key is settled even when the request ran out of time
+		ctx = context.WithoutCancel(ctx)
+
+		// the commit may have finished before the deadline passed, the retry finds it by the key in the database
+		if errors.Is(handlerErr, context.DeadlineExceeded) {
+			_ = redisService.Delete(ctx, redisKey)
+			return handlerErr
+		}
+
+		if handlerErr != nil {
+			if err := c.App().Config().ErrorHandler(c, handlerErr); err != nil {
+				_ = redisService.Delete(ctx, redisKey)
+				return err
+			}
+		}
+
+		if c.Response().StatusCode() >= http.StatusInternalServerError {
+			_ = redisService.Delete(ctx, redisKey)
+			return nil
+		}
+
+		record := idempotencyRecord{
+			State:       idempotencyCompleted,
+			BodyHash:    bodyHash,
+			StatusCode:  c.Response().StatusCode(),
+			ContentType: string(c.Response().Header.ContentType()),
+			Body:        c.Response().Body(),
+		}
+		if err := redisService.SetWithTTL(ctx, redisKey, record, ttl); err != nil {
+			utils.CreateLogMessage("error storing idempotent response", err)
+		}
+
+		return nil
+	}
+}
+
+func replay(c *fiber.Ctx, redisService service.RedisServiceInterface, redisKey string, bodyHash string) error {
+	cached, err := redisService.Get(c.UserContext(), redisKey)
+	if err != nil {
+		// the key expired between SetNX and Get, the caller can simply retry
+		return fiber.NewError(http.StatusConflict, "request with this idempotency key is in progress")
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(cached), &record); err != nil {
+		utils.CreateLogMessage("error reading idempotent response", err)
+		return err
+	}
+
+	if record.BodyHash != bodyHash {
+		return fiber.NewError(http.StatusUnprocessableEntity, "idempotency key was already used with a different request body")
+	}
+
+	if record.State == idempotencyProcessing {
+		return fiber.NewError(http.StatusConflict, "request with this idempotency key is in progress")
+	}
+
+	c.Set(IdempotencyReplayedHeader, "true")
+	if record.ContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ContentType)
+	}
+
+	return c.Status(record.StatusCode).Send(record.Body)
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"flash_sale_management/ratelimit"
+	"flash_sale_management/utils"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const RateLimitKey = "KEY_RATE_LIMIT:%s:%s"
+
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimits holds the rate limit rules of the routes, by route name.
+type RateLimits struct {
+	limiter ratelimit.Limiter
+	routes  map[string][]ratelimit.Rule
+}
+
+func NewRateLimits(limiter ratelimit.Limiter, routes map[string][]ratelimit.Rule) *RateLimits {
+	return &RateLimits{limiter: limiter, routes: routes}
+}
+
+// For limits the requests of the named route and answers the ones over a limit with 429 Too Many Requests.
+// Rules by customer only count authenticated requests, so it runs after Authenticate. The limits are
+// reported in the X-RateLimit-* headers, Reset and Retry-After in seconds. When the limiter is unavailable
+// requests are let through.
+func (r *RateLimits) For(route string) fiber.Handler {
+	rules := r.routes[route]
+
+	return func(c *fiber.Ctx) error {
+		if len(rules) == 0 {
+			return c.Next()
+		}
+
+		decision, err := r.limiter.Allow(c.UserContext(), rateLimitChecks(c, route, rules), time.Now())
+		if err != nil {
+			utils.CreateLogMessage("error checking rate limit", err)
+			return c.Next()
+		}
+
+		if decision.Limit > 0 {
+			c.Set(RateLimitLimitHeader, strconv.Itoa(decision.Limit))
+			c.Set(RateLimitRemainingHeader, strconv.Itoa(decision.Remaining))
+			c.Set(RateLimitResetHeader, strconv.Itoa(seconds(decision.Reset)))
+		}
+
+		if !decision.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(decision.RetryAfter)))
+			return fiber.NewError(http.StatusTooManyRequests, "too many requests")
+		}
+
+		return c.Next()
+	}
+}
+
+// rateLimitChecks keys the rules by the parts of the request, rules with a part the request doesn't have are skipped.
+func rateLimitChecks(c *fiber.Ctx, route string, rules []ratelimit.Rule) []ratelimit.Check {
+	checks := make([]ratelimit.Check, 0, len(rules))
+
+	for _, rule := range rules {
+		parts := make([]string, 0, len(rule.By))
+		for _, part := range rule.By {
+			value := rateLimitPart(c, part)
+			if value == "" {
+				break
+			}
+			parts = append(parts, part+"="+value)
+		}
+
+		if len(parts) < len(rule.By) {
+			continue
+		}
+
+		checks = append(checks, ratelimit.Check{
+			Key:    fmt.Sprintf(RateLimitKey, route, strings.Join(parts, ",")),
+			Limit:  rule.Limit,
+			Window: rule.Window,
+		})
+	}
+
+	return checks
+}
+
+func rateLimitPart(c *fiber.Ctx, part string) string {
+	switch part {
+	case ratelimit.ByIP:
+		return c.IP()
+	case ratelimit.ByCustomer:
+		if principal := Principal(c); principal != nil {
+			return principal.Subject
+		}
+	case ratelimit.BySale:
+		return c.Params("id")
+	}
+
+	return ""
+}
+
+// seconds rounds up, so clients don't retry before the limit allows them.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+type MemoryStore struct {
+	mutex      sync.Mutex
+	sequences  map[int]int64
+	tickets    map[int]map[string]Ticket
+	used       map[int]map[string]bool
+	admissions map[int]*admission
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sequences:  map[int]int64{},
+		tickets:    map[int]map[string]Ticket{},
+		used:       map[int]map[string]bool{},
+		admissions: map[int]*admission{},
+	}
+}
+
+func (s *MemoryStore) Join(ctx context.Context, saleID int, customerID string) (*Ticket, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sequences[saleID]++
+	ticket := Ticket{Token: newToken(), Sequence: s.sequences[saleID], CustomerID: customerID}
+
+	if s.tickets[saleID] == nil {
+		s.tickets[saleID] = map[string]Ticket{}
+	}
+	s.tickets[saleID][ticket.Token] = ticket
+
+	return &ticket, nil
+}
+
+func (s *MemoryStore) Find(ctx context.Context, saleID int, token string) (*Ticket, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ticket, ok := s.tickets[saleID][token]
+	if !ok {
+		return nil, ErrTicketNotFound
+	}
+
+	return &ticket, nil
+}
+
+func (s *MemoryStore) Consume(ctx context.Context, saleID int, token string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.used[saleID] == nil {
+		s.used[saleID] = map[string]bool{}
+	}
+
+	if s.used[saleID][token] {
+		return false, nil
+	}
+	s.used[saleID][token] = true
+
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, saleID int, token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.used[saleID], token)
+
+	return nil
+}
+
+func (s *MemoryStore) Advance(ctx context.Context, saleID int, rate int, second int64) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.admissions[saleID] == nil {
+		s.admissions[saleID] = newAdmission()
+	}
+	s.admissions[saleID].advance(s.sequences[saleID], int64(rate), second)
+
+	return s.admissions[saleID].Admitted, nil
+}
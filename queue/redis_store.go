@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SequenceKey = "KEY_QUEUE_SEQUENCE:%d"
+const TicketsKey = "KEY_QUEUE_TICKETS:%d"
+const UsedTicketsKey = "KEY_QUEUE_USED:%d"
+const AdmissionKey = "KEY_QUEUE_ADMISSION:%d"
+
+// advanceScript is admission.advance on the admission hash, KEYS[1] is the sequence and KEYS[2] the admission.
+// ARGV: rate, second, ttl in milliseconds. Returns the number of admitted tickets.
+var advanceScript = redis.NewScript(`
+local state = redis.call('HMGET', KEYS[2], 'admitted', 'seen', 'second', 'used')
+local admitted = tonumber(state[1]) or 0
+local seen = tonumber(state[2]) or 0
+local second = tonumber(state[3]) or -1
+local used = tonumber(state[4]) or 0
+local joined = tonumber(redis.call('GET', KEYS[1])) or 0
+local rate = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+
+if now > second then
+	local granted = (now - second - 1) * rate
+	if second >= 0 then
+		granted = granted + math.max(rate - used, 0)
+	end
+	admitted = math.min(seen, admitted + granted)
+	second = now
+	used = 0
+end
+
+if now >= 0 then
+	local taken = math.min(rate - used, joined - admitted)
+	if taken > 0 then
+		admitted = admitted + taken
+		used = used + taken
+	end
+end
+
+redis.call('HSET', KEYS[2], 'admitted', admitted, 'seen', joined, 'second', second, 'used', used)
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return admitted
+`)
+
+// RedisStore shares the waiting rooms between all application instances.
+// Keys expire after ttl without new joins.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+// Join stores the ticket as "<sequence>:<customer id>" in the tickets hash.
+func (s *RedisStore) Join(ctx context.Context, saleID int, customerID string) (*Ticket, error) {
+	sequence, err := s.client.Incr(ctx, fmt.Sprintf(SequenceKey, saleID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := Ticket{Token: newToken(), Sequence: sequence, CustomerID: customerID}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, fmt.Sprintf(TicketsKey, saleID), ticket.Token, fmt.Sprintf("%d:%s", ticket.Sequence, ticket.CustomerID))
+		pipe.Expire(ctx, fmt.Sprintf(SequenceKey, saleID), s.ttl)
+		pipe.Expire(ctx, fmt.Sprintf(TicketsKey, saleID), s.ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+func (s *RedisStore) Find(ctx context.Context, saleID int, token string) (*Ticket, error) {
+	value, err := s.client.HGet(ctx, fmt.Sprintf(TicketsKey, saleID), token).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTicketNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, customerID, _ := strings.Cut(value, ":")
+	parsed, err := strconv.ParseInt(sequence, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ticket{Token: token, Sequence: parsed, CustomerID: customerID}, nil
+}
+
+func (s *RedisStore) Consume(ctx context.Context, saleID int, token string) (bool, error) {
+	key := fmt.Sprintf(UsedTicketsKey, saleID)
+
+	added, err := s.client.SAdd(ctx, key, token).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.client.Expire(ctx, key, s.ttl).Err(); err != nil {
+		return false, err
+	}
+
+	return added == 1, nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, saleID int, token string) error {
+	return s.client.SRem(ctx, fmt.Sprintf(UsedTicketsKey, saleID), token).Err()
+}
+
+func (s *RedisStore) Advance(ctx context.Context, saleID int, rate int, second int64) (int64, error) {
+	keys := []string{fmt.Sprintf(SequenceKey, saleID), fmt.Sprintf(AdmissionKey, saleID)}
+
+	return advanceScript.Run(ctx, s.client, keys, rate, second, s.ttl.Milliseconds()).Int64()
+}
@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var ErrTicketNotFound = errors.New("queue ticket not found")
+
+// Ticket is a place in the waiting room of a sale, Sequence is the 1-based join order.
+// Only the customer the ticket was issued to can buy with it.
+type Ticket struct {
+	Token      string
+	Sequence   int64
+	CustomerID string
+}
+
+// Status is the position of a ticket in the waiting room. Admitted tickets have position 0.
+type Status struct {
+	Token         string
+	Position      int64
+	Admitted      bool
+	EstimatedWait time.Duration
+}
+
+// Store keeps the waiting room state of sales.
+type Store interface {
+	// Join appends a new ticket of the customer to the waiting room of the sale.
+	Join(ctx context.Context, saleID int, customerID string) (*Ticket, error)
+	// Find returns ErrTicketNotFound for unknown tokens.
+	Find(ctx context.Context, saleID int, token string) (*Ticket, error)
+	// Consume marks the ticket as used and reports false when it was already used.
+	Consume(ctx context.Context, saleID int, token string) (bool, error)
+	// Release makes a consumed ticket usable again, e.g. after a failed purchase.
+	Release(ctx context.Context, saleID int, token string) error
+	// Advance admits up to rate tickets in every second of the sale until second, the 0-based second since the
+	// sale start (-1 before it), and returns the number of admitted tickets.
+	Advance(ctx context.Context, saleID int, rate int, second int64) (int64, error)
+}
+
+// admission is the progress of a waiting room. Seen is the number of tickets at the last advance and Used the
+// admissions of its Second. Seconds nobody asked about only admit the tickets that were already waiting, so
+// capacity of idle seconds isn't handed to later joiners.
+type admission struct {
+	Admitted int64
+	Seen     int64
+	Second   int64
+	Used     int64
+}
+
+func newAdmission() *admission {
+	return &admission{Second: -1}
+}
+
+// advance moves the admission to second with joined tickets in the waiting room.
+func (a *admission) advance(joined int64, rate int64, second int64) {
+	if second > a.Second {
+		granted := (second - a.Second - 1) * rate
+		if a.Second >= 0 {
+			granted += max(rate-a.Used, 0)
+		}
+		a.Admitted = min(a.Seen, a.Admitted+granted)
+		a.Second = second
+		a.Used = 0
+	}
+
+	// the batch of the current second admits whoever is waiting, in join order
+	if second >= 0 {
+		if taken := min(rate-a.Used, joined-a.Admitted); taken > 0 {
+			a.Admitted += taken
+			a.Used += taken
+		}
+	}
+
+	a.Seen = joined
+}
+
+func newToken() string {
+	return uuid.NewString()
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Parts a rule can key its counters by.
+const (
+	ByIP       = "ip"
+	ByCustomer = "customer"
+	BySale     = "sale"
+)
+
+// Rule allows Limit requests per Window for every distinct combination of the By parts of a request,
+// e.g. by [customer, sale] counts the requests of each customer to each sale.
+type Rule struct {
+	By     []string
+	Limit  int
+	Window time.Duration
+}
+
+func (r Rule) Validate() error {
+	if r.Limit <= 0 || r.Window <= 0 {
+		return errors.New(fmt.Sprintf("rate limit needs a positive limit and window, got %d per %s", r.Limit, r.Window))
+	}
+
+	if len(r.By) == 0 {
+		return errors.New("rate limit needs at least one part to count by")
+	}
+
+	for _, part := range r.By {
+		if part != ByIP && part != ByCustomer && part != BySale {
+			return errors.New(fmt.Sprintf("unknown rate limit part: %s", part))
+		}
+	}
+
+	return nil
+}
+
+// Check is a rule applied to the counter of one key.
+type Check struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// Decision is the outcome of the checks of a request. Limit, Remaining and Reset describe the check closest to
+// its limit, or the one that denied the request. RetryAfter is set when the request was denied.
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter counts a request against all of its checks at once. A request denied by one check is not counted
+// by the others.
+type Limiter interface {
+	Allow(ctx context.Context, checks []Check, now time.Time) (*Decision, error)
+}
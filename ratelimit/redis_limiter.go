@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// slidingWindowScript keeps the request times of the last window in a sorted set per key and adds ARGV[2] at
+// ARGV[1] (ms) to every set when all of them are below their limit. ARGV holds the window (ms) and limit of
+// every key after that. Returns whether the request was allowed, then per key the requests in the window before
+// it, the ms until the oldest of them leaves the window and the ms until the key allows a request again.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local allowed = 1
+local result = {}
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[i * 2 + 1])
+	local limit = tonumber(ARGV[i * 2 + 2])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	local reset = window
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+	local retry = 0
+	if count >= limit then
+		allowed = 0
+		local freeing = redis.call('ZRANGE', key, count - limit, count - limit, 'WITHSCORES')
+		retry = tonumber(freeing[2]) + window - now
+	end
+	table.insert(result, count)
+	table.insert(result, reset)
+	table.insert(result, retry)
+end
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		redis.call('ZADD', key, now, ARGV[2])
+		redis.call('PEXPIRE', key, tonumber(ARGV[i * 2 + 1]))
+	end
+end
+table.insert(result, 1, allowed)
+return result
+`)
+
+// RedisLimiter shares the counters between all application instances. The window slides with every request,
+// so bursts at the edges of fixed windows can't double the limit.
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, checks []Check, now time.Time) (*Decision, error) {
+	if len(checks) == 0 {
+		return &Decision{Allowed: true}, nil
+	}
+
+	keys := make([]string, 0, len(checks))
+	args := []interface{}{now.UnixMilli(), fmt.Sprintf("%d-%s", now.UnixNano(), uuid.NewString())}
+	for _, check := range checks {
+		keys = append(keys, check.Key)
+		args = append(args, check.Window.Milliseconds(), check.Limit)
+	}
+
+	values, err := slidingWindowScript.Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := values[0] == 1
+	var decision *Decision
+	for i, check := range checks {
+		count, reset, retry := values[1+i*3], values[2+i*3], values[3+i*3]
+
+		current := Decision{
+			Allowed:    allowed,
+			Limit:      check.Limit,
+			Remaining:  check.Limit - int(count),
+			Reset:      time.Duration(reset) * time.Millisecond,
+			RetryAfter: time.Duration(retry) * time.Millisecond,
+		}
+		if allowed {
+			current.Remaining--
+		}
+		if current.Remaining < 0 {
+			current.Remaining = 0
+		}
+
+		if decision == nil || moreRestrictive(current, *decision) {
+			decision = &current
+		}
+	}
+
+	return decision, nil
+}
+
+// moreRestrictive prefers the check that waits longest when denied, the one with the fewest requests left otherwise.
+func moreRestrictive(a Decision, b Decision) bool {
+	if a.RetryAfter != b.RetryAfter {
+		return a.RetryAfter > b.RetryAfter
+	}
+
+	return a.Remaining < b.Remaining
+}
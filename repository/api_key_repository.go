@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"gorm.io/gorm"
+	"time"
+)
+
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+type APIKeyRepositoryInterface interface {
+	Save(ctx context.Context, apiKey *entity.APIKey) Result[*entity.APIKey]
+	FindAll(ctx context.Context) Result[[]entity.APIKey]
+	FindOneById(ctx context.Context, id int) Result[*entity.APIKey]
+	FindOneByPrefix(ctx context.Context, prefix string) Result[*entity.APIKey]
+	Revoke(ctx context.Context, id int, now time.Time) error
+	UpdateLastUsed(ctx context.Context, id int, now time.Time) error
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) Save(ctx context.Context, apiKey *entity.APIKey) Result[*entity.APIKey] {
+	err := r.db.WithContext(ctx).Create(apiKey).Error
+
+	if err != nil {
+		return Result[*entity.APIKey]{Error: err}
+	}
+
+	return Result[*entity.APIKey]{Result: apiKey}
+}
+
+func (r *APIKeyRepository) FindAll(ctx context.Context) Result[[]entity.APIKey] {
+	var apiKeys []entity.APIKey
+
+	err := r.db.WithContext(ctx).Order("id").Find(&apiKeys).Error
+
+	if err != nil {
+		return Result[[]entity.APIKey]{Error: err}
+	}
+
+	return Result[[]entity.APIKey]{Result: apiKeys}
+}
+
+func (r *APIKeyRepository) FindOneById(ctx context.Context, id int) Result[*entity.APIKey] {
+	var apiKey entity.APIKey
+
+	err := r.db.WithContext(ctx).Where(&entity.APIKey{ID: id}).Take(&apiKey).Error
+
+	if err != nil {
+		return Result[*entity.APIKey]{Error: notFound("api key", err)}
+	}
+
+	return Result[*entity.APIKey]{Result: &apiKey}
+}
+
+func (r *APIKeyRepository) FindOneByPrefix(ctx context.Context, prefix string) Result[*entity.APIKey] {
+	var apiKey entity.APIKey
+
+	err := r.db.WithContext(ctx).Where(&entity.APIKey{Prefix: prefix}).Take(&apiKey).Error
+
+	if err != nil {
+		return Result[*entity.APIKey]{Error: notFound("api key", err)}
+	}
+
+	return Result[*entity.APIKey]{Result: &apiKey}
+}
+
+// Revoke sets the revocation time of a key that is not revoked yet, a revoked key keeps its first revocation time.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id int, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", now).Error
+}
+
+func (r *APIKeyRepository) UpdateLastUsed(ctx context.Context, id int, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", now).Error
+}
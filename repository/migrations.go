@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"flash_sale_management/entity"
+	"gorm.io/gorm"
+)
+
+// BackfillSaleLogSales attributes sale logs written before they referenced their sale. A log belongs to the sale of
+// its product whose period contains the log's creation time. The discount comes from the sale and the original unit
+// price is derived from the discounted price, or taken from the product for a 100% discount.
+// Only logs without a sale are touched, so it is safe to run on every start. It returns the number of updated logs.
+func BackfillSaleLogSales(db *gorm.DB) (int64, error) {
+	result := db.Exec(`UPDATE sale_logs SET
+			sale_id = sales.id,
+			discount = sales.discount,
+			original_price = COALESCE(
+				ROUND(sale_logs.price / NULLIF(1 - sales.discount / 100, 0), 2),
+				(SELECT products.price FROM products WHERE products.id = sale_logs.product_id),
+				0)
+		FROM sales
+		WHERE sale_logs.sale_id IS NULL
+			AND sales.product_id = sale_logs.product_id
+			AND sale_logs.created_at >= sales.start_time
+			AND sale_logs.created_at <= sales.end_time`)
+
+	return result.RowsAffected, result.Error
+}
+
+// BackfillSaleInitialStock sets the initial stock of sales created before it was stored: the stock left plus the units
+// of placed orders and held reservations. Only sales without an initial stock are touched, so it is safe to run on
+// every start. It returns the number of updated sales.
+func BackfillSaleInitialStock(db *gorm.DB) (int64, error) {
+	result := db.Exec(`UPDATE sales SET initial_stock = sales.sale_stock
+			+ COALESCE((SELECT SUM(sale_logs.quantity) FROM sale_logs WHERE sale_logs.sale_id = sales.id AND sale_logs.status = ?), 0)
+			+ COALESCE((SELECT SUM(reservations.quantity) FROM reservations WHERE reservations.sale_id = sales.id AND reservations.status = ?), 0)
+		WHERE sales.initial_stock = 0`, entity.OrderPlaced, entity.ReservationHeld)
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+type OutboxRepositoryInterface interface {
+	SaveInTx(tx *gorm.DB, event *entity.OutboxEvent) Result[*entity.OutboxEvent]
+	ClaimPending(ctx context.Context, now time.Time, lease time.Duration, limit int) Result[[]entity.OutboxEvent]
+	MarkPublished(ctx context.Context, id int, now time.Time) error
+	MarkFailed(ctx context.Context, id int, nextAttemptAt time.Time, reason string) error
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+func (r *OutboxRepository) SaveInTx(tx *gorm.DB, event *entity.OutboxEvent) Result[*entity.OutboxEvent] {
+	err := tx.Create(event).Error
+
+	if err != nil {
+		return Result[*entity.OutboxEvent]{Error: err}
+	}
+
+	return Result[*entity.OutboxEvent]{Result: event}
+}
+
+// ClaimPending counts an attempt for up to limit unpublished events that are due and hides them from other relays
+// for lease, oldest first. Events that aren't marked before the lease ends are claimed again.
+func (r *OutboxRepository) ClaimPending(ctx context.Context, now time.Time, lease time.Duration, limit int) Result[[]entity.OutboxEvent] {
+	var events []entity.OutboxEvent
+
+	pending := r.db.WithContext(ctx).Model(&entity.OutboxEvent{}).Select("id").
+		Where("published_at IS NULL AND next_attempt_at <= ?", now).
+		Order("id").Limit(limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+	err := r.db.WithContext(ctx).Model(&events).Clauses(clause.Returning{}).
+		Where("id IN (?)", pending).
+		Updates(map[string]interface{}{"attempts": gorm.Expr("attempts + 1"), "next_attempt_at": now.Add(lease)}).Error
+
+	if err != nil {
+		return Result[[]entity.OutboxEvent]{Error: err}
+	}
+
+	// RETURNING keeps no order
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	return Result[[]entity.OutboxEvent]{Result: events}
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, id int, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.OutboxEvent{ID: id}).
+		Updates(map[string]interface{}{"published_at": now, "last_error": ""}).Error
+}
+
+// MarkFailed schedules the next attempt of the event.
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id int, nextAttemptAt time.Time, reason string) error {
+	return r.db.WithContext(ctx).Model(&entity.OutboxEvent{ID: id}).
+		Updates(map[string]interface{}{"next_attempt_at": nextAttemptAt, "last_error": reason}).Error
+}
@@ -1,17 +1,21 @@
 package repository
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 type ProductRepositoryInterface interface {
-	FindOneById(id int) Result
-	Save(product *entity.Product) Result
-	Update(product *entity.Product) Result
-	LockAndUpdateProduct(tx *gorm.DB, product *entity.Product) Result
-	BeginTransaction() *gorm.DB
+	FindAll(ctx context.Context) Result[[]entity.Product]
+	FindOneById(ctx context.Context, id int) Result[*entity.Product]
+	Save(ctx context.Context, product *entity.Product) Result[*entity.Product]
+	Update(ctx context.Context, product *entity.Product) Result[*entity.Product]
+	DeleteOneById(ctx context.Context, id int) error
+	FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.Product]
+	UpdateInTx(tx *gorm.DB, product *entity.Product) Result[*entity.Product]
+	UpdateColumnsInTx(tx *gorm.DB, product *entity.Product, columns ...string) Result[*entity.Product]
 }
 
 type ProductRepository struct {
@@ -22,63 +26,84 @@ func NewProductRepository(db *gorm.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
-func (r *ProductRepository) FindOneById(id int) Result {
+func (r *ProductRepository) FindAll(ctx context.Context) Result[[]entity.Product] {
+	var products []entity.Product
+
+	err := r.db.WithContext(ctx).Order("id").Find(&products).Error
+
+	if err != nil {
+		return Result[[]entity.Product]{Error: err}
+	}
+
+	return Result[[]entity.Product]{Result: products}
+}
+
+func (r *ProductRepository) FindOneById(ctx context.Context, id int) Result[*entity.Product] {
 	var product entity.Product
 
-	err := r.db.Where(&entity.Product{ID: id}).Take(&product).Error
+	err := r.db.WithContext(ctx).Where(&entity.Product{ID: id}).Take(&product).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[*entity.Product]{Error: notFound("product", err)}
 	}
 
-	return Result{Result: &product}
+	return Result[*entity.Product]{Result: &product}
 }
 
-func (r *ProductRepository) Save(product *entity.Product) Result {
-	err := r.db.Create(product).Error
+func (r *ProductRepository) Save(ctx context.Context, product *entity.Product) Result[*entity.Product] {
+	err := r.db.WithContext(ctx).Create(product).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[*entity.Product]{Error: err}
 	}
 
-	return Result{Result: product}
+	return Result[*entity.Product]{Result: product}
 }
 
-func (r *ProductRepository) Update(product *entity.Product) Result {
-	err := r.db.Save(product).Error
+func (r *ProductRepository) Update(ctx context.Context, product *entity.Product) Result[*entity.Product] {
+	err := r.db.WithContext(ctx).Save(product).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[*entity.Product]{Error: err}
 	}
 
-	return Result{Result: product}
+	return Result[*entity.Product]{Result: product}
+}
+
+func (r *ProductRepository) DeleteOneById(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Delete(&entity.Product{ID: id}).Error
 }
 
-func (r *ProductRepository) LockAndUpdateProduct(tx *gorm.DB, updatedProduct *entity.Product) Result {
+// FindOneByIdForUpdate reads the product with a row lock held until the transaction ends.
+func (r *ProductRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.Product] {
 	var product entity.Product
-	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", updatedProduct.ID).Take(&product).Error
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&product).Error
+
 	if err != nil {
-		tx.Rollback()
-		return Result{Error: err}
+		return Result[*entity.Product]{Error: notFound("product", err)}
 	}
 
-	err = tx.Save(&updatedProduct).Error
+	return Result[*entity.Product]{Result: &product}
+}
+
+func (r *ProductRepository) UpdateInTx(tx *gorm.DB, product *entity.Product) Result[*entity.Product] {
+	err := tx.Save(product).Error
+
 	if err != nil {
-		tx.Rollback()
-		return Result{Error: err}
+		return Result[*entity.Product]{Error: err}
 	}
 
-	return Result{Result: &product}
+	return Result[*entity.Product]{Result: product}
 }
 
-func (r *ProductRepository) BeginTransaction() *gorm.DB {
-	return r.db.Begin()
-}
+// UpdateColumnsInTx writes only the given columns of the product, the stock left by purchases is kept unless listed.
+func (r *ProductRepository) UpdateColumnsInTx(tx *gorm.DB, product *entity.Product, columns ...string) Result[*entity.Product] {
+	err := tx.Model(product).Select(columns).Updates(product).Error
 
-func (r *ProductRepository) EndTransaction() *gorm.DB {
-	return r.db.Commit()
-}
+	if err != nil {
+		return Result[*entity.Product]{Error: err}
+	}
 
-func (r *ProductRepository) RollbackTransaction() *gorm.DB {
-	return r.db.Rollback()
+	return Result[*entity.Product]{Result: product}
 }
@@ -1,6 +1,41 @@
 package repository
 
-type Result struct {
-	Result interface{}
+import (
+	"errors"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is matched by the error of a FindOne method that found no row.
+var ErrNotFound = errors.New("record not found")
+
+// Result is what the repository methods return, Result holds its zero value when Error is set.
+type Result[T any] struct {
+	Result T
 	Error  error
 }
+
+// NotFoundError names the entity a FindOne method didn't find. It matches ErrNotFound and unwraps to
+// gorm.ErrRecordNotFound.
+type NotFoundError struct {
+	Entity string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Entity + " not found"
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return gorm.ErrRecordNotFound
+}
+
+// notFound turns gorm's not found error into a NotFoundError of the entity, other errors are returned as they are.
+func notFound(entity string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &NotFoundError{Entity: entity}
+	}
+	return err
+}
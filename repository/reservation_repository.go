@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type ReservationRepository struct {
+	db *gorm.DB
+}
+
+type ReservationRepositoryInterface interface {
+	FindOneById(ctx context.Context, id int) Result[*entity.Reservation]
+	FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.Reservation]
+	FindOneByIdempotencyKey(ctx context.Context, key string) Result[*entity.Reservation]
+	SaveInTx(tx *gorm.DB, reservation *entity.Reservation) Result[*entity.Reservation]
+	UpdateInTx(tx *gorm.DB, reservation *entity.Reservation) Result[*entity.Reservation]
+	FindExpired(ctx context.Context, now time.Time, limit int) Result[[]entity.Reservation]
+}
+
+func NewReservationRepository(db *gorm.DB) *ReservationRepository {
+	return &ReservationRepository{db: db}
+}
+
+func (r *ReservationRepository) FindOneById(ctx context.Context, id int) Result[*entity.Reservation] {
+	var reservation entity.Reservation
+
+	err := r.db.WithContext(ctx).Where(&entity.Reservation{ID: id}).Take(&reservation).Error
+
+	if err != nil {
+		return Result[*entity.Reservation]{Error: notFound("reservation", err)}
+	}
+
+	return Result[*entity.Reservation]{Result: &reservation}
+}
+
+// FindOneByIdForUpdate reads the reservation with a row lock held until the transaction ends.
+func (r *ReservationRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.Reservation] {
+	var reservation entity.Reservation
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&reservation).Error
+
+	if err != nil {
+		return Result[*entity.Reservation]{Error: notFound("reservation", err)}
+	}
+
+	return Result[*entity.Reservation]{Result: &reservation}
+}
+
+func (r *ReservationRepository) FindOneByIdempotencyKey(ctx context.Context, key string) Result[*entity.Reservation] {
+	var reservation entity.Reservation
+
+	err := r.db.WithContext(ctx).Where("idempotency_key = ?", key).Take(&reservation).Error
+
+	if err != nil {
+		return Result[*entity.Reservation]{Error: notFound("reservation", err)}
+	}
+
+	return Result[*entity.Reservation]{Result: &reservation}
+}
+
+func (r *ReservationRepository) SaveInTx(tx *gorm.DB, reservation *entity.Reservation) Result[*entity.Reservation] {
+	err := tx.Create(reservation).Error
+
+	if err != nil {
+		return Result[*entity.Reservation]{Error: err}
+	}
+
+	return Result[*entity.Reservation]{Result: reservation}
+}
+
+func (r *ReservationRepository) UpdateInTx(tx *gorm.DB, reservation *entity.Reservation) Result[*entity.Reservation] {
+	err := tx.Save(reservation).Error
+
+	if err != nil {
+		return Result[*entity.Reservation]{Error: err}
+	}
+
+	return Result[*entity.Reservation]{Result: reservation}
+}
+
+// FindExpired returns up to limit held reservations whose hold ended, oldest first.
+func (r *ReservationRepository) FindExpired(ctx context.Context, now time.Time, limit int) Result[[]entity.Reservation] {
+	var reservations []entity.Reservation
+
+	err := r.db.WithContext(ctx).Where("status = ? AND expires_at <= ?", entity.ReservationHeld, now).
+		Order("expires_at").Limit(limit).Find(&reservations).Error
+
+	if err != nil {
+		return Result[[]entity.Reservation]{Error: err}
+	}
+
+	return Result[[]entity.Reservation]{Result: reservations}
+}
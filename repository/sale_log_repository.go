@@ -1,8 +1,12 @@
 package repository
 
 import (
+	"context"
 	"flash_sale_management/entity"
+	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 type SaleLogRepository struct {
@@ -10,19 +14,206 @@ type SaleLogRepository struct {
 }
 
 type SaleLogRepositoryInterface interface {
-	Save(sale *entity.SaleLog) Result
+	Save(ctx context.Context, sale *entity.SaleLog) Result[*entity.SaleLog]
+	SaveInTx(tx *gorm.DB, sale *entity.SaleLog) Result[*entity.SaleLog]
+	FindOneByIdempotencyKey(ctx context.Context, key string) Result[*entity.SaleLog]
+	FindOneById(ctx context.Context, id int) Result[*entity.SaleLog]
+	FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.SaleLog]
+	UpdateInTx(tx *gorm.DB, sale *entity.SaleLog) Result[*entity.SaleLog]
+	FindAllByQuery(ctx context.Context, query SaleLogQuery) Result[[]entity.SaleLog]
+	SumBySale(ctx context.Context, saleID int) Result[*SaleLogTotals]
+	CountPerMinuteBySale(ctx context.Context, saleID int) Result[[]SaleLogMinute]
 }
 
+// SaleLogTotals are the aggregates of the placed orders of a sale.
+type SaleLogTotals struct {
+	Orders          int64
+	UnitsSold       int64
+	Revenue         float64
+	DiscountGiven   float64
+	UniqueCustomers int64
+	FirstOrderAt    *time.Time
+	LastOrderAt     *time.Time
+}
+
+// SaleLogMinute counts the placed orders of a sale created within one minute.
+type SaleLogMinute struct {
+	Minute    time.Time
+	Purchases int64
+	Units     int64
+}
+
+// SaleLogQuery filters, sorts and pages sale logs, zero values don't filter.
+// Pages are read with a keyset: AfterValue and AfterID are the sort value and id of the last row of the previous page.
+type SaleLogQuery struct {
+	SaleID     int
+	ProductID  int
+	CustomerID string
+	Status     string
+	From       *time.Time
+	To         *time.Time
+	SortColumn string // created_at or total_price
+	Descending bool
+	AfterValue interface{}
+	AfterID    int
+	Limit      int
+}
+
+var saleLogSortColumns = map[string]bool{"created_at": true, "total_price": true}
+
 func NewSaleLogRepository(db *gorm.DB) *SaleLogRepository {
 	return &SaleLogRepository{db: db}
 }
 
-func (r *SaleLogRepository) Save(sale *entity.SaleLog) Result {
-	err := r.db.Create(sale).Error
+func (r *SaleLogRepository) Save(ctx context.Context, sale *entity.SaleLog) Result[*entity.SaleLog] {
+	err := r.db.WithContext(ctx).Create(sale).Error
+
+	if err != nil {
+		return Result[*entity.SaleLog]{Error: err}
+	}
+
+	return Result[*entity.SaleLog]{Result: sale}
+}
+
+func (r *SaleLogRepository) SaveInTx(tx *gorm.DB, sale *entity.SaleLog) Result[*entity.SaleLog] {
+	err := tx.Create(sale).Error
+
+	if err != nil {
+		return Result[*entity.SaleLog]{Error: err}
+	}
+
+	return Result[*entity.SaleLog]{Result: sale}
+}
+
+func (r *SaleLogRepository) FindOneByIdempotencyKey(ctx context.Context, key string) Result[*entity.SaleLog] {
+	var saleLog entity.SaleLog
+
+	err := r.db.WithContext(ctx).Where("idempotency_key = ?", key).Take(&saleLog).Error
+
+	if err != nil {
+		return Result[*entity.SaleLog]{Error: notFound("order", err)}
+	}
+
+	return Result[*entity.SaleLog]{Result: &saleLog}
+}
+
+func (r *SaleLogRepository) FindOneById(ctx context.Context, id int) Result[*entity.SaleLog] {
+	var saleLog entity.SaleLog
+
+	err := r.db.WithContext(ctx).Where(&entity.SaleLog{ID: id}).Take(&saleLog).Error
+
+	if err != nil {
+		return Result[*entity.SaleLog]{Error: notFound("order", err)}
+	}
+
+	return Result[*entity.SaleLog]{Result: &saleLog}
+}
+
+// FindOneByIdForUpdate reads the sale log with a row lock held until the transaction ends.
+func (r *SaleLogRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.SaleLog] {
+	var saleLog entity.SaleLog
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&saleLog).Error
+
+	if err != nil {
+		return Result[*entity.SaleLog]{Error: notFound("order", err)}
+	}
+
+	return Result[*entity.SaleLog]{Result: &saleLog}
+}
+
+func (r *SaleLogRepository) UpdateInTx(tx *gorm.DB, sale *entity.SaleLog) Result[*entity.SaleLog] {
+	err := tx.Save(sale).Error
+
+	if err != nil {
+		return Result[*entity.SaleLog]{Error: err}
+	}
+
+	return Result[*entity.SaleLog]{Result: sale}
+}
+
+func (r *SaleLogRepository) FindAllByQuery(ctx context.Context, query SaleLogQuery) Result[[]entity.SaleLog] {
+	var saleLogs []entity.SaleLog
+
+	column := query.SortColumn
+	if !saleLogSortColumns[column] {
+		column = "created_at"
+	}
+
+	direction, operator := "ASC", ">"
+	if query.Descending {
+		direction, operator = "DESC", "<"
+	}
+
+	db := r.db.WithContext(ctx).Model(&entity.SaleLog{})
+	if query.SaleID > 0 {
+		db = db.Where("sale_id = ?", query.SaleID)
+	}
+
+	if query.ProductID > 0 {
+		db = db.Where("product_id = ?", query.ProductID)
+	}
+
+	if query.CustomerID != "" {
+		db = db.Where("customer_id = ?", query.CustomerID)
+	}
+
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+
+	if query.From != nil {
+		db = db.Where("created_at >= ?", *query.From)
+	}
+
+	if query.To != nil {
+		db = db.Where("created_at < ?", *query.To)
+	}
+
+	if query.AfterValue != nil {
+		db = db.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, operator), query.AfterValue, query.AfterID)
+	}
+
+	err := db.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).Limit(query.Limit).Find(&saleLogs).Error
+
+	if err != nil {
+		return Result[[]entity.SaleLog]{Error: err}
+	}
+
+	return Result[[]entity.SaleLog]{Result: saleLogs}
+}
+
+// SumBySale aggregates the placed orders of the sale, cancelled and refunded orders are left out.
+func (r *SaleLogRepository) SumBySale(ctx context.Context, saleID int) Result[*SaleLogTotals] {
+	var totals SaleLogTotals
+
+	err := r.db.WithContext(ctx).Model(&entity.SaleLog{}).
+		Select("COUNT(*) AS orders, COALESCE(SUM(quantity), 0) AS units_sold, COALESCE(SUM(total_price), 0) AS revenue, "+
+			"COALESCE(SUM((original_price - price) * quantity), 0) AS discount_given, COUNT(DISTINCT customer_id) AS unique_customers, "+
+			"MIN(created_at) AS first_order_at, MAX(created_at) AS last_order_at").
+		Where("sale_id = ? AND status = ?", saleID, entity.OrderPlaced).
+		Scan(&totals).Error
+
+	if err != nil {
+		return Result[*SaleLogTotals]{Error: err}
+	}
+
+	return Result[*SaleLogTotals]{Result: &totals}
+}
+
+// CountPerMinuteBySale counts the placed orders of the sale per minute, minutes without orders are left out.
+func (r *SaleLogRepository) CountPerMinuteBySale(ctx context.Context, saleID int) Result[[]SaleLogMinute] {
+	var minutes []SaleLogMinute
+
+	err := r.db.WithContext(ctx).Model(&entity.SaleLog{}).
+		Select("date_trunc('minute', created_at) AS minute, COUNT(*) AS purchases, SUM(quantity) AS units").
+		Where("sale_id = ? AND status = ?", saleID, entity.OrderPlaced).
+		Group("minute").Order("minute").
+		Scan(&minutes).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[[]SaleLogMinute]{Error: err}
 	}
 
-	return Result{Result: sale}
+	return Result[[]SaleLogMinute]{Result: minutes}
 }
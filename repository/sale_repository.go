@@ -1,113 +1,378 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"flash_sale_management/entity"
+	"fmt"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"time"
 )
 
+// ErrPurchaseLimitExceeded is returned when a purchase would take a customer over the sale's per customer limit.
+var ErrPurchaseLimitExceeded = errors.New("purchase limit per customer exceeded")
+
+// Sale statuses of SaleQuery, they are worked out from the sale times and stock at SaleQuery.Now.
+const (
+	SaleUpcoming = "upcoming"
+	SaleActive   = "active"
+	SaleEnded    = "ended"
+	SaleSoldOut  = "sold_out"
+)
+
+// SaleQuery filters, sorts and pages sales, zero values don't filter. From and To match the sales running at some
+// point between them. Pages are read with a keyset like SaleLogQuery.
+type SaleQuery struct {
+	Status     string
+	ProductID  int
+	From       *time.Time
+	To         *time.Time
+	Now        time.Time
+	SortColumn string // start_time, end_time, discount or created_at
+	Descending bool
+	AfterValue interface{}
+	AfterID    int
+	Limit      int
+}
+
+var saleSortColumns = map[string]bool{"start_time": true, "end_time": true, "discount": true, "created_at": true}
+
 type SaleRepository struct {
 	db *gorm.DB
 }
 
 type SaleRepositoryInterface interface {
-	Save(sale *entity.Sale) Result
-	Update(sale *entity.Sale) Result
-	FindAll() Result
-	FindOneById(id int) Result
-	FindOneByProduct(id int) Result
-	DeleteOneById(id int) Result
-	LockAndUpdateSale(tx *gorm.DB, updatedSale *entity.Sale) Result
-	BeginTransaction() *gorm.DB
+	Save(ctx context.Context, sale *entity.Sale) Result[*entity.Sale]
+	SaveInTx(tx *gorm.DB, sale *entity.Sale) Result[*entity.Sale]
+	Update(ctx context.Context, sale *entity.Sale) Result[*entity.Sale]
+	FindAll(ctx context.Context) Result[[]entity.Sale]
+	FindAllActive(ctx context.Context, now time.Time) Result[[]entity.Sale]
+	FindAllByTimeWindow(ctx context.Context, from time.Time, to time.Time) Result[[]entity.Sale]
+	FindAllByProductInTx(tx *gorm.DB, productID int) Result[[]entity.Sale]
+	FindAllByQuery(ctx context.Context, query SaleQuery) Result[[]entity.Sale]
+	CountByQuery(ctx context.Context, query SaleQuery) Result[int64]
+	FindOneById(ctx context.Context, id int) Result[*entity.Sale]
+	DeleteOneById(ctx context.Context, id int) error
+	DeleteOneByIdInTx(tx *gorm.DB, id int) error
+	FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.Sale]
+	UpdateInTx(tx *gorm.DB, sale *entity.Sale) Result[*entity.Sale]
+	UpdateColumnsInTx(tx *gorm.DB, sale *entity.Sale, columns ...string) Result[*entity.Sale]
+	IncreaseCustomerPurchaseInTx(tx *gorm.DB, purchase *entity.CustomerPurchase, limit int) Result[*entity.CustomerPurchase]
+	DecreaseCustomerPurchaseInTx(tx *gorm.DB, purchase *entity.CustomerPurchase) Result[*entity.CustomerPurchase]
+	ActivateDueSalesInTx(tx *gorm.DB, now time.Time) Result[[]entity.Sale]
+	DeactivateFinishedSalesInTx(tx *gorm.DB, now time.Time) Result[[]entity.Sale]
+	FindStartingSales(ctx context.Context, from time.Time, to time.Time) Result[[]entity.Sale]
 }
 
 func NewSaleRepository(db *gorm.DB) *SaleRepository {
 	return &SaleRepository{db: db}
 }
 
-func (r *SaleRepository) Save(sale *entity.Sale) Result {
-	err := r.db.Create(sale).Error
+func (r *SaleRepository) Save(ctx context.Context, sale *entity.Sale) Result[*entity.Sale] {
+	err := r.db.WithContext(ctx).Create(sale).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[*entity.Sale]{Error: err}
 	}
 
-	return Result{Result: sale}
+	return Result[*entity.Sale]{Result: sale}
 }
 
-func (r *SaleRepository) Update(sale *entity.Sale) Result {
-	err := r.db.Save(sale).Error
+func (r *SaleRepository) SaveInTx(tx *gorm.DB, sale *entity.Sale) Result[*entity.Sale] {
+	err := tx.Create(sale).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[*entity.Sale]{Error: err}
 	}
 
-	return Result{Result: sale}
+	return Result[*entity.Sale]{Result: sale}
 }
 
-func (r *SaleRepository) LockAndUpdateSale(tx *gorm.DB, updatedSale *entity.Sale) Result {
+func (r *SaleRepository) Update(ctx context.Context, sale *entity.Sale) Result[*entity.Sale] {
+	err := r.db.WithContext(ctx).Save(sale).Error
+
+	if err != nil {
+		return Result[*entity.Sale]{Error: err}
+	}
+
+	return Result[*entity.Sale]{Result: sale}
+}
+
+// FindOneByIdForUpdate reads the sale with a row lock held until the transaction ends.
+func (r *SaleRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) Result[*entity.Sale] {
 	var sale entity.Sale
-	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", updatedSale.ID).Take(&sale).Error
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&sale).Error
+
+	if err != nil {
+		return Result[*entity.Sale]{Error: notFound("sale", err)}
+	}
+
+	return Result[*entity.Sale]{Result: &sale}
+}
+
+func (r *SaleRepository) UpdateInTx(tx *gorm.DB, sale *entity.Sale) Result[*entity.Sale] {
+	err := tx.Save(sale).Error
+
+	if err != nil {
+		return Result[*entity.Sale]{Error: err}
+	}
+
+	return Result[*entity.Sale]{Result: sale}
+}
+
+// UpdateColumnsInTx writes only the given columns of the sale, the others keep what the database has.
+func (r *SaleRepository) UpdateColumnsInTx(tx *gorm.DB, sale *entity.Sale, columns ...string) Result[*entity.Sale] {
+	err := tx.Model(sale).Select(columns).Updates(sale).Error
+
 	if err != nil {
-		tx.Rollback()
-		return Result{Error: err}
+		return Result[*entity.Sale]{Error: err}
 	}
 
-	err = tx.Save(&updatedSale).Error
+	return Result[*entity.Sale]{Result: sale}
+}
+
+// IncreaseCustomerPurchaseInTx adds purchase.Quantity to the customer's counter for the sale in one upsert.
+// The row lock taken by the upsert serializes concurrent purchases of the same customer, so the limit
+// (0 means unlimited) can't be exceeded. ErrPurchaseLimitExceeded is returned when nothing was written.
+func (r *SaleRepository) IncreaseCustomerPurchaseInTx(tx *gorm.DB, purchase *entity.CustomerPurchase, limit int) Result[*entity.CustomerPurchase] {
+	if limit > 0 && purchase.Quantity > limit {
+		return Result[*entity.CustomerPurchase]{Error: ErrPurchaseLimitExceeded}
+	}
+
+	onConflict := clause.OnConflict{
+		Columns: []clause.Column{{Name: "sale_id"}, {Name: "customer_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "quantity"}, Value: gorm.Expr("customer_purchases.quantity + EXCLUDED.quantity")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("EXCLUDED.updated_at")},
+		},
+	}
+	if limit > 0 {
+		onConflict.Where = clause.Where{Exprs: []clause.Expression{
+			gorm.Expr("customer_purchases.quantity + EXCLUDED.quantity <= ?", limit),
+		}}
+	}
+
+	result := tx.Clauses(onConflict).Create(purchase)
+	if result.Error != nil {
+		return Result[*entity.CustomerPurchase]{Error: result.Error}
+	}
+
+	if result.RowsAffected == 0 {
+		return Result[*entity.CustomerPurchase]{Error: ErrPurchaseLimitExceeded}
+	}
+
+	return Result[*entity.CustomerPurchase]{Result: purchase}
+}
+
+// DecreaseCustomerPurchaseInTx takes purchase.Quantity back from the customer's counter for the sale,
+// so returned units count towards the limit again.
+func (r *SaleRepository) DecreaseCustomerPurchaseInTx(tx *gorm.DB, purchase *entity.CustomerPurchase) Result[*entity.CustomerPurchase] {
+	err := tx.Model(&entity.CustomerPurchase{}).
+		Where("sale_id = ? AND customer_id = ?", purchase.SaleID, purchase.CustomerID).
+		Updates(map[string]interface{}{
+			"quantity":   gorm.Expr("GREATEST(quantity - ?, 0)", purchase.Quantity),
+			"updated_at": time.Now(),
+		}).Error
+
 	if err != nil {
-		tx.Rollback()
-		return Result{Error: err}
+		return Result[*entity.CustomerPurchase]{Error: err}
 	}
 
-	return Result{Result: &sale}
+	return Result[*entity.CustomerPurchase]{Result: purchase}
 }
 
-func (r *SaleRepository) BeginTransaction() *gorm.DB {
-	return r.db.Begin()
+// ActivateDueSalesInTx switches on every sale whose period has started and returns the activated sales.
+// The update claims the rows, so when several instances run it at once each sale is returned only once.
+func (r *SaleRepository) ActivateDueSalesInTx(tx *gorm.DB, now time.Time) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	err := tx.Model(&sales).Clauses(clause.Returning{}).
+		Where("active = ? AND activated_at IS NULL AND start_time <= ? AND end_time > ? AND sale_stock > 0", false, now, now).
+		Updates(map[string]interface{}{"active": true, "activated_at": now, "updated_at": now}).Error
+
+	if err != nil {
+		return Result[[]entity.Sale]{Error: err}
+	}
+
+	return Result[[]entity.Sale]{Result: sales}
 }
 
-func (r *SaleRepository) FindAll() Result {
-	var sales entity.Sale
+// DeactivateFinishedSalesInTx switches off active sales that have ended or sold out and returns them.
+// A sale whose stock is only held by reservations stays active, the held units may come back. Sold out sales lose
+// their activation time, so ActivateDueSalesInTx switches them on again when cancelled orders restock them.
+func (r *SaleRepository) DeactivateFinishedSalesInTx(tx *gorm.DB, now time.Time) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	heldReservations := tx.Session(&gorm.Session{NewDB: true}).Model(&entity.Reservation{}).Select("1").
+		Where("reservations.sale_id = sales.id AND reservations.status = ?", entity.ReservationHeld)
 
-	err := r.db.Find(&sales).Error
+	err := tx.Model(&sales).Clauses(clause.Returning{}).
+		Where("active = ? AND (end_time <= ? OR (sale_stock <= 0 AND NOT EXISTS (?)))", true, now, heldReservations).
+		Updates(map[string]interface{}{
+			"active":       false,
+			"activated_at": gorm.Expr("CASE WHEN end_time <= ? THEN activated_at END", now),
+			"updated_at":   now,
+		}).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[[]entity.Sale]{Error: err}
 	}
 
-	return Result{Result: &sales}
+	return Result[[]entity.Sale]{Result: sales}
 }
 
-func (r *SaleRepository) FindOneById(id int) Result {
-	var sale entity.Sale
+func (r *SaleRepository) FindAll(ctx context.Context) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	err := r.db.WithContext(ctx).Order("id").Find(&sales).Error
+
+	if err != nil {
+		return Result[[]entity.Sale]{Error: err}
+	}
+
+	return Result[[]entity.Sale]{Result: sales}
+}
+
+// FindAllActive returns the sales running at now with stock left, in start order.
+func (r *SaleRepository) FindAllActive(ctx context.Context, now time.Time) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	err := r.filterByQuery(ctx, SaleQuery{Status: SaleActive, Now: now}).Order("start_time, id").Find(&sales).Error
+
+	if err != nil {
+		return Result[[]entity.Sale]{Error: err}
+	}
+
+	return Result[[]entity.Sale]{Result: sales}
+}
+
+// FindAllByTimeWindow returns the sales running at some point between from and to, in start order.
+func (r *SaleRepository) FindAllByTimeWindow(ctx context.Context, from time.Time, to time.Time) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	err := r.filterByQuery(ctx, SaleQuery{From: &from, To: &to}).Order("start_time, id").Find(&sales).Error
+
+	if err != nil {
+		return Result[[]entity.Sale]{Error: err}
+	}
+
+	return Result[[]entity.Sale]{Result: sales}
+}
+
+// FindAllByProductInTx returns every sale of the product, the earlier ones first.
+func (r *SaleRepository) FindAllByProductInTx(tx *gorm.DB, productID int) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	err := tx.Where("product_id = ?", productID).Order("start_time, id").Find(&sales).Error
+
+	if err != nil {
+		return Result[[]entity.Sale]{Error: err}
+	}
+
+	return Result[[]entity.Sale]{Result: sales}
+}
+
+func (r *SaleRepository) FindAllByQuery(ctx context.Context, query SaleQuery) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	column := query.SortColumn
+	if !saleSortColumns[column] {
+		column = "start_time"
+	}
+
+	direction, operator := "ASC", ">"
+	if query.Descending {
+		direction, operator = "DESC", "<"
+	}
+
+	db := r.filterByQuery(ctx, query)
+	if query.AfterValue != nil {
+		db = db.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, operator), query.AfterValue, query.AfterID)
+	}
 
-	err := r.db.Where(&entity.Sale{ID: id}).Take(&sale).Error
+	err := db.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).Limit(query.Limit).Find(&sales).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[[]entity.Sale]{Error: err}
+	}
+
+	return Result[[]entity.Sale]{Result: sales}
+}
+
+// CountByQuery counts every sale matching the filters of the query, its sort and page are left out.
+func (r *SaleRepository) CountByQuery(ctx context.Context, query SaleQuery) Result[int64] {
+	var count int64
+
+	err := r.filterByQuery(ctx, query).Count(&count).Error
+
+	if err != nil {
+		return Result[int64]{Error: err}
+	}
+
+	return Result[int64]{Result: count}
+}
+
+func (r *SaleRepository) filterByQuery(ctx context.Context, query SaleQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.Sale{})
+
+	switch query.Status {
+	case SaleUpcoming:
+		db = db.Where("start_time > ?", query.Now)
+	case SaleActive:
+		db = db.Where("active = ? AND start_time <= ? AND end_time > ? AND sale_stock > 0", true, query.Now, query.Now)
+	case SaleEnded:
+		db = db.Where("end_time <= ?", query.Now)
+	case SaleSoldOut:
+		db = db.Where("sale_stock <= 0 AND end_time > ?", query.Now)
+	}
+
+	if query.ProductID > 0 {
+		db = db.Where("product_id = ?", query.ProductID)
 	}
 
-	return Result{Result: &sale}
+	if query.From != nil {
+		db = db.Where("end_time > ?", *query.From)
+	}
+
+	if query.To != nil {
+		db = db.Where("start_time < ?", *query.To)
+	}
+
+	return db
 }
 
-func (r *SaleRepository) FindOneByProduct(id int) Result {
+func (r *SaleRepository) FindOneById(ctx context.Context, id int) Result[*entity.Sale] {
 	var sale entity.Sale
 
-	err := r.db.Where(&entity.Sale{ProductID: id}).Take(&sale).Error
+	err := r.db.WithContext(ctx).Where(&entity.Sale{ID: id}).Take(&sale).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[*entity.Sale]{Error: notFound("sale", err)}
 	}
 
-	return Result{Result: &sale}
+	return Result[*entity.Sale]{Result: &sale}
+}
+
+func (r *SaleRepository) DeleteOneById(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Delete(&entity.Sale{ID: id}).Error
 }
 
-func (r *SaleRepository) DeleteOneById(id int) Result {
-	err := r.db.Delete(&entity.Sale{ID: id}).Error
+func (r *SaleRepository) DeleteOneByIdInTx(tx *gorm.DB, id int) error {
+	return tx.Delete(&entity.Sale{ID: id}).Error
+}
+
+// FindStartingSales returns the sales that haven't been activated yet and start after from, up to to.
+func (r *SaleRepository) FindStartingSales(ctx context.Context, from time.Time, to time.Time) Result[[]entity.Sale] {
+	var sales []entity.Sale
+
+	err := r.db.WithContext(ctx).Where("active = ? AND activated_at IS NULL AND start_time > ? AND start_time <= ?", false, from, to).
+		Find(&sales).Error
 
 	if err != nil {
-		return Result{Error: err}
+		return Result[[]entity.Sale]{Error: err}
 	}
 
-	return Result{Result: nil}
+	return Result[[]entity.Sale]{Result: sales}
 }
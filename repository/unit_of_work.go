@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// UnitOfWorkInterface groups repository calls into one database transaction.
+// Repository methods taking a tx argument must be called with the transaction passed to fn, it carries ctx.
+type UnitOfWorkInterface interface {
+	Execute(ctx context.Context, fn func(tx *gorm.DB) error) error
+}
+
+type UnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Execute commits the transaction when fn returns nil and rolls it back when fn returns an error or panics.
+// The transaction is rolled back as well when ctx is done before it commits.
+func (u *UnitOfWork) Execute(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return u.db.WithContext(ctx).Transaction(fn)
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+type WebhookRepositoryInterface interface {
+	Save(ctx context.Context, subscription *entity.WebhookSubscription) Result[*entity.WebhookSubscription]
+	FindAll(ctx context.Context) Result[[]entity.WebhookSubscription]
+	FindOneById(ctx context.Context, id int) Result[*entity.WebhookSubscription]
+	DeleteOneById(ctx context.Context, id int) error
+	SaveDeliveries(ctx context.Context, deliveries []entity.WebhookDelivery) Result[[]entity.WebhookDelivery]
+	FindDeliveryById(ctx context.Context, id int) Result[*entity.WebhookDelivery]
+	FindDeliveriesBySubscription(ctx context.Context, subscriptionID int, limit int) Result[[]entity.WebhookDelivery]
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) Result[[]entity.WebhookDelivery]
+	UpdateDelivery(ctx context.Context, delivery *entity.WebhookDelivery) Result[*entity.WebhookDelivery]
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Save(ctx context.Context, subscription *entity.WebhookSubscription) Result[*entity.WebhookSubscription] {
+	err := r.db.WithContext(ctx).Create(subscription).Error
+
+	if err != nil {
+		return Result[*entity.WebhookSubscription]{Error: err}
+	}
+
+	return Result[*entity.WebhookSubscription]{Result: subscription}
+}
+
+func (r *WebhookRepository) FindAll(ctx context.Context) Result[[]entity.WebhookSubscription] {
+	var subscriptions []entity.WebhookSubscription
+
+	err := r.db.WithContext(ctx).Order("id").Find(&subscriptions).Error
+
+	if err != nil {
+		return Result[[]entity.WebhookSubscription]{Error: err}
+	}
+
+	return Result[[]entity.WebhookSubscription]{Result: subscriptions}
+}
+
+func (r *WebhookRepository) FindOneById(ctx context.Context, id int) Result[*entity.WebhookSubscription] {
+	var subscription entity.WebhookSubscription
+
+	err := r.db.WithContext(ctx).Where(&entity.WebhookSubscription{ID: id}).Take(&subscription).Error
+
+	if err != nil {
+		return Result[*entity.WebhookSubscription]{Error: notFound("webhook subscription", err)}
+	}
+
+	return Result[*entity.WebhookSubscription]{Result: &subscription}
+}
+
+// DeleteOneById deletes the subscription, its deliveries are deleted with it.
+func (r *WebhookRepository) DeleteOneById(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Delete(&entity.WebhookSubscription{ID: id}).Error
+}
+
+// SaveDeliveries inserts the deliveries, skipping the ones already created for the same subscription and event,
+// so an event published again by the outbox relay is delivered only once.
+func (r *WebhookRepository) SaveDeliveries(ctx context.Context, deliveries []entity.WebhookDelivery) Result[[]entity.WebhookDelivery] {
+	if len(deliveries) == 0 {
+		return Result[[]entity.WebhookDelivery]{Result: deliveries}
+	}
+
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&deliveries).Error
+
+	if err != nil {
+		return Result[[]entity.WebhookDelivery]{Error: err}
+	}
+
+	return Result[[]entity.WebhookDelivery]{Result: deliveries}
+}
+
+func (r *WebhookRepository) FindDeliveryById(ctx context.Context, id int) Result[*entity.WebhookDelivery] {
+	var delivery entity.WebhookDelivery
+
+	err := r.db.WithContext(ctx).Where(&entity.WebhookDelivery{ID: id}).Take(&delivery).Error
+
+	if err != nil {
+		return Result[*entity.WebhookDelivery]{Error: notFound("webhook delivery", err)}
+	}
+
+	return Result[*entity.WebhookDelivery]{Result: &delivery}
+}
+
+// FindDeliveriesBySubscription returns the latest deliveries of the subscription, newest first.
+func (r *WebhookRepository) FindDeliveriesBySubscription(ctx context.Context, subscriptionID int, limit int) Result[[]entity.WebhookDelivery] {
+	var deliveries []entity.WebhookDelivery
+
+	err := r.db.WithContext(ctx).Where(&entity.WebhookDelivery{SubscriptionID: subscriptionID}).
+		Order("id DESC").Limit(limit).
+		Find(&deliveries).Error
+
+	if err != nil {
+		return Result[[]entity.WebhookDelivery]{Error: err}
+	}
+
+	return Result[[]entity.WebhookDelivery]{Result: deliveries}
+}
+
+// ClaimDueDeliveries counts an attempt for up to limit pending deliveries that are due and hides them from other
+// senders for lease, oldest first. Deliveries that aren't updated before the lease ends are claimed again.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) Result[[]entity.WebhookDelivery] {
+	var deliveries []entity.WebhookDelivery
+
+	due := r.db.WithContext(ctx).Model(&entity.WebhookDelivery{}).Select("id").
+		Where("status = ? AND next_attempt_at <= ?", entity.WebhookDeliveryPending, now).
+		Order("id").Limit(limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+	err := r.db.WithContext(ctx).Model(&deliveries).Clauses(clause.Returning{}).
+		Where("id IN (?)", due).
+		Updates(map[string]interface{}{"attempts": gorm.Expr("attempts + 1"), "next_attempt_at": now.Add(lease), "updated_at": now}).Error
+
+	if err != nil {
+		return Result[[]entity.WebhookDelivery]{Error: err}
+	}
+
+	// RETURNING keeps no order
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+
+	return Result[[]entity.WebhookDelivery]{Result: deliveries}
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *entity.WebhookDelivery) Result[*entity.WebhookDelivery] {
+	err := r.db.WithContext(ctx).Save(delivery).Error
+
+	if err != nil {
+		return Result[*entity.WebhookDelivery]{Error: err}
+	}
+
+	return Result[*entity.WebhookDelivery]{Result: delivery}
+}
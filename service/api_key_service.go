@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flash_sale_management/auth"
+	"flash_sale_management/dto/request"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"flash_sale_management/utils"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyPrefix starts every key, so leaked keys are easy to find in code and logs.
+	apiKeyPrefix = "fsk"
+	// apiKeyLastUsedResolution limits the last used updates of a busy key to one per interval.
+	apiKeyLastUsedResolution = time.Minute
+)
+
+// APIKeyService manages the API keys of back-office integrations. A key is "fsk_<prefix>_<secret>", it is shown
+// once on creation and only its hash is stored. The prefix identifies the key in listings and lookups.
+type APIKeyService struct {
+	apiKeyRepository repository.APIKeyRepositoryInterface
+}
+
+func NewAPIKeyService(apiKeyRepository repository.APIKeyRepositoryInterface) APIKeyService {
+	return APIKeyService{apiKeyRepository: apiKeyRepository}
+}
+
+// CreateAPIKey returns the stored key and the key itself.
+func (as *APIKeyService) CreateAPIKey(ctx context.Context, request request.CreateAPIKeyRequest) (*entity.APIKey, string, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, "", validationError(err)
+	}
+
+	prefix, err := randomBytes(6)
+	if err != nil {
+		utils.CreateLogMessage("error generating api key", err)
+		return nil, "", err
+	}
+	secret, err := randomBytes(32)
+	if err != nil {
+		utils.CreateLogMessage("error generating api key", err)
+		return nil, "", err
+	}
+
+	apiKey := (&entity.APIKey{}).FromDto(request)
+	apiKey.Prefix = hex.EncodeToString(prefix)
+	key := fmt.Sprintf("%s_%s_%s", apiKeyPrefix, apiKey.Prefix, base64.RawURLEncoding.EncodeToString(secret))
+	apiKey.Hash = hashAPIKey(key)
+
+	result := as.apiKeyRepository.Save(ctx, apiKey)
+	if result.Error != nil {
+		utils.CreateLogMessage("error creating api key", result.Error)
+		return nil, "", result.Error
+	}
+
+	return apiKey, key, nil
+}
+
+func (as *APIKeyService) FindAPIKeys(ctx context.Context) (*[]entity.APIKey, error) {
+	result := as.apiKeyRepository.FindAll(ctx)
+	if result.Error != nil {
+		utils.CreateLogMessage("error getting api keys", result.Error)
+		return nil, result.Error
+	}
+
+	return &result.Result, nil
+}
+
+// RevokeAPIKey stops the key from authenticating, the revoked key stays listed.
+func (as *APIKeyService) RevokeAPIKey(ctx context.Context, id int) (*entity.APIKey, error) {
+	result := as.apiKeyRepository.FindOneById(ctx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error getting api key", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("api key not found. id: %d", id))
+	}
+	apiKey := result.Result
+
+	if apiKey.Revoked() {
+		return apiKey, nil
+	}
+
+	now := time.Now()
+	if err := as.apiKeyRepository.Revoke(ctx, id, now); err != nil {
+		utils.CreateLogMessage("error revoking api key", err)
+		return nil, err
+	}
+	apiKey.RevokedAt = &now
+
+	return apiKey, nil
+}
+
+// Resolve returns the integration principal of a valid key with the scopes of the key and records its use.
+// Unknown, revoked and wrong keys return auth.ErrInvalidAPIKey, a failed lookup returns its error.
+func (as *APIKeyService) Resolve(ctx context.Context, key string) (*auth.Principal, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	result := as.apiKeyRepository.FindOneByPrefix(ctx, parts[1])
+	if result.Error != nil {
+		if errors.Is(result.Error, repository.ErrNotFound) {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		utils.CreateLogMessage("error getting api key", result.Error)
+		return nil, result.Error
+	}
+	apiKey := result.Result
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashAPIKey(key))) != 1 || apiKey.Revoked() {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyLastUsedResolution {
+		// the request is still served when the use can't be recorded
+		if err := as.apiKeyRepository.UpdateLastUsed(ctx, apiKey.ID, now); err != nil {
+			utils.CreateLogMessage("error updating api key last used time", err)
+		}
+	}
+
+	return &auth.Principal{Subject: "api-key:" + apiKey.Prefix, Role: auth.RoleIntegration, Scopes: apiKey.ScopeList()}, nil
+}
+
+// hashAPIKey hashes a key for storage. Keys are long random strings, so a fast hash can't be brute forced.
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
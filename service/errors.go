@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"flash_sale_management/queue"
+	"flash_sale_management/repository"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"reflect"
+)
+
+// Error kinds, they are also the error codes the API answers with.
+const (
+	KindNotFound        = "not_found"
+	KindValidation      = "validation_failed"
+	KindConflict        = "conflict"
+	KindSoldOut         = "sold_out"
+	KindSaleNotStarted  = "sale_not_started"
+	KindSaleEnded       = "sale_ended"
+	KindSaleInactive    = "sale_inactive"
+	KindLimitExceeded   = "limit_exceeded"
+	KindAdmissionDenied = "admission_denied"
+)
+
+// Sentinels of every kind, errors.Is(err, ErrNotFound) matches any not found error.
+var (
+	ErrNotFound        = &Error{Kind: KindNotFound}
+	ErrValidation      = &Error{Kind: KindValidation}
+	ErrConflict        = &Error{Kind: KindConflict}
+	ErrSoldOut         = &Error{Kind: KindSoldOut}
+	ErrSaleNotStarted  = &Error{Kind: KindSaleNotStarted}
+	ErrSaleEnded       = &Error{Kind: KindSaleEnded}
+	ErrSaleInactive    = &Error{Kind: KindSaleInactive}
+	ErrLimitExceeded   = &Error{Kind: KindLimitExceeded}
+	ErrAdmissionDenied = &Error{Kind: KindAdmissionDenied}
+)
+
+// Error is a failure the caller can act on, its kind tells what went wrong and Fields which inputs were invalid.
+type Error struct {
+	Kind    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError is a request field that failed validation, Field is its json name.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Kind
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors of the same kind.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+func newError(kind string, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// validationError wraps a request.Validate error, listing the fields validator rejected.
+func validationError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return &Error{Kind: KindValidation, Message: err.Error(), Err: err}
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fields = append(fields, FieldError{
+			Field:   fieldError.Field(),
+			Rule:    fieldError.Tag(),
+			Message: fieldMessage(fieldError),
+		})
+	}
+
+	return &Error{Kind: KindValidation, Message: "request is invalid", Fields: fields, Err: err}
+}
+
+func fieldMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fieldError.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fieldError.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fieldError.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fieldError.Param())
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fieldError.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fieldError.Param())
+	case "max":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fieldError.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fieldError.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fieldError.Param())
+	case "url":
+		return "must be a valid url"
+	}
+
+	return fmt.Sprintf("failed the %s rule", fieldError.Tag())
+}
+
+// AsError returns err as an *Error, translating the errors of the layers below into their kind.
+// Errors without a kind, like a lost database connection, return nil.
+func AsError(err error) *Error {
+	var serviceError *Error
+	if errors.As(err, &serviceError) {
+		return serviceError
+	}
+
+	var validationErrors validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrors):
+		return validationError(err).(*Error)
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, queue.ErrTicketNotFound):
+		return &Error{Kind: KindNotFound, Message: err.Error(), Err: err}
+	case errors.Is(err, gorm.ErrDuplicatedKey), errors.Is(err, gorm.ErrForeignKeyViolated):
+		return &Error{Kind: KindConflict, Message: err.Error(), Err: err}
+	case errors.Is(err, repository.ErrPurchaseLimitExceeded):
+		return &Error{Kind: KindLimitExceeded, Message: err.Error(), Err: err}
+	}
+
+	return nil
+}
+
+// notFoundError names the missing record when err is the repository's not found error, other errors are returned as they are.
+func notFoundError(err error, message string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return &Error{Kind: KindNotFound, Message: message, Err: err}
+	}
+	return err
+}
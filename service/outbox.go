@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/json"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"flash_sale_management/utils"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SalePayload is the payload of the SaleCreated, SaleUpdated, SaleDeleted and SaleSoldOut events.
+type SalePayload struct {
+	ID             int       `json:"id"`
+	ProductID      int       `json:"productId"`
+	SaleStock      int       `json:"saleStock"`
+	Discount       float64   `json:"discount"`
+	StartTime      time.Time `json:"startTime"`
+	EndTime        time.Time `json:"endTime"`
+	Active         bool      `json:"active"`
+	MaxPerCustomer int       `json:"maxPerCustomer"`
+	MaxPerOrder    int       `json:"maxPerOrder"`
+}
+
+func newSalePayload(sale *entity.Sale) SalePayload {
+	return SalePayload{
+		ID:             sale.ID,
+		ProductID:      sale.ProductID,
+		SaleStock:      sale.SaleStock,
+		Discount:       sale.Discount,
+		StartTime:      sale.StartTime,
+		EndTime:        sale.EndTime,
+		Active:         sale.Active,
+		MaxPerCustomer: sale.MaxPerCustomer,
+		MaxPerOrder:    sale.MaxPerOrder,
+	}
+}
+
+// PurchasePayload is the payload of the SalePurchased event.
+type PurchasePayload struct {
+	OrderID       int       `json:"orderId"`
+	SaleID        int       `json:"saleId"`
+	ProductID     int       `json:"productId"`
+	CustomerID    string    `json:"customerId"`
+	Quantity      int       `json:"quantity"`
+	OriginalPrice float64   `json:"originalPrice"`
+	Discount      float64   `json:"discount"`
+	Price         float64   `json:"price"`
+	TotalPrice    float64   `json:"totalPrice"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func newPurchasePayload(sale *entity.Sale, order *entity.SaleLog) PurchasePayload {
+	return PurchasePayload{
+		OrderID:       order.ID,
+		SaleID:        sale.ID,
+		ProductID:     order.ProductID,
+		CustomerID:    order.CustomerID,
+		Quantity:      order.Quantity,
+		OriginalPrice: order.OriginalPrice,
+		Discount:      order.Discount,
+		Price:         order.Price,
+		TotalPrice:    order.TotalPrice,
+		CreatedAt:     order.CreatedAt,
+	}
+}
+
+// OrderPayload is the payload of the OrderCancelled and OrderRefunded events.
+type OrderPayload struct {
+	OrderID    int       `json:"orderId"`
+	SaleID     *int      `json:"saleId"`
+	ProductID  int       `json:"productId"`
+	CustomerID string    `json:"customerId"`
+	Quantity   int       `json:"quantity"`
+	TotalPrice float64   `json:"totalPrice"`
+	Status     string    `json:"status"`
+	Restocked  bool      `json:"restocked"` // whether the units went back to the sale stock
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func newOrderPayload(order *entity.SaleLog, restocked bool) OrderPayload {
+	return OrderPayload{
+		OrderID:    order.ID,
+		SaleID:     order.SaleID,
+		ProductID:  order.ProductID,
+		CustomerID: order.CustomerID,
+		Quantity:   order.Quantity,
+		TotalPrice: order.TotalPrice,
+		Status:     order.Status,
+		Restocked:  restocked,
+		UpdatedAt:  order.UpdatedAt,
+	}
+}
+
+// writeOutboxEvent adds the event to the transaction of the change it describes,
+// so it is published exactly when the change is committed.
+func writeOutboxEvent(outboxRepository repository.OutboxRepositoryInterface, tx *gorm.DB, eventType string, saleID int, payload interface{}) error {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		utils.CreateLogMessage("error encoding outbox event", err)
+		return err
+	}
+
+	event := entity.OutboxEvent{Type: eventType, SaleID: saleID, Payload: string(p), NextAttemptAt: time.Now()}
+	if result := outboxRepository.SaveInTx(tx, &event); result.Error != nil {
+		utils.CreateLogMessage("error writing outbox event", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+// writePurchaseEvents writes SalePurchased for the order and SaleSoldOut when it took the last unit of the sale.
+func writePurchaseEvents(outboxRepository repository.OutboxRepositoryInterface, tx *gorm.DB, sale *entity.Sale, order *entity.SaleLog) error {
+	if err := writeOutboxEvent(outboxRepository, tx, entity.SalePurchased, sale.ID, newPurchasePayload(sale, order)); err != nil {
+		return err
+	}
+
+	return writeSoldOutEvent(outboxRepository, tx, sale)
+}
+
+// writeSoldOutEvent writes SaleSoldOut when the change took the last unit of the sale.
+func writeSoldOutEvent(outboxRepository repository.OutboxRepositoryInterface, tx *gorm.DB, sale *entity.Sale) error {
+	if sale.SaleStock > 0 {
+		return nil
+	}
+
+	return writeOutboxEvent(outboxRepository, tx, entity.SaleSoldOut, sale.ID, newSalePayload(sale))
+}
+
+// writeSaleUpdatedEvents writes SaleUpdated for each sale the scheduler switched on or off.
+func writeSaleUpdatedEvents(outboxRepository repository.OutboxRepositoryInterface, tx *gorm.DB, sales []entity.Sale) error {
+	for i := range sales {
+		if err := writeOutboxEvent(outboxRepository, tx, entity.SaleUpdated, sales[i].ID, newSalePayload(&sales[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeOrderEvent writes OrderCancelled or OrderRefunded for an order that was returned with status.
+// Old orders that are not linked to a sale are written with sale id 0.
+func writeOrderEvent(outboxRepository repository.OutboxRepositoryInterface, tx *gorm.DB, order *entity.SaleLog, restocked bool) error {
+	eventType := entity.OrderCancelledEvent
+	if order.Status == entity.OrderRefunded {
+		eventType = entity.OrderRefundedEvent
+	}
+
+	saleID := 0
+	if order.SaleID != nil {
+		saleID = *order.SaleID
+	}
+
+	return writeOutboxEvent(outboxRepository, tx, eventType, saleID, newOrderPayload(order, restocked))
+}
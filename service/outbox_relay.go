@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"flash_sale_management/entity"
+	"flash_sale_management/events"
+	"flash_sale_management/repository"
+	"github.com/gofiber/fiber/v2/log"
+	"time"
+)
+
+const (
+	// outboxLease hides claimed events from other relays while they are published.
+	outboxLease = 30 * time.Second
+	// outboxRetryDelay is the wait after the first failed attempt, it doubles with every further attempt.
+	outboxRetryDelay = time.Second
+	// outboxMaxRetryDelay caps the wait between attempts.
+	outboxMaxRetryDelay = 5 * time.Minute
+)
+
+// OutboxRelay publishes the outbox events oldest first and retries the failed ones with exponential backoff.
+// An event is marked published only after the publisher accepted it, so every event is delivered at least once.
+// Events are claimed in the database, so the relay can run on every instance. Delivery order is not guaranteed:
+// a failed event is retried after later ones went out and relays publish their batches side by side, so
+// consumers order the events of a sale by their ID.
+type OutboxRelay struct {
+	outboxRepository repository.OutboxRepositoryInterface
+	publisher        events.Publisher
+	interval         time.Duration
+	batchSize        int
+}
+
+func NewOutboxRelay(outboxRepository repository.OutboxRepositoryInterface, publisher events.Publisher, interval time.Duration, batchSize int) *OutboxRelay {
+	return &OutboxRelay{outboxRepository: outboxRepository, publisher: publisher, interval: interval, batchSize: batchSize}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Run(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run publishes the due events, batch by batch until none are left or a batch had failures.
+func (r *OutboxRelay) Run(ctx context.Context, now time.Time) {
+	for {
+		result := r.outboxRepository.ClaimPending(ctx, now, outboxLease, r.batchSize)
+		if result.Error != nil {
+			log.Errorf("outbox relay claim failed: %v", result.Error)
+			return
+		}
+
+		claimed := result.Result
+		failed := false
+		for _, event := range claimed {
+			if !r.publish(ctx, event, now) {
+				failed = true
+			}
+		}
+
+		// a failing publisher is retried on the next tick instead of right away
+		if failed || len(claimed) < r.batchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, event entity.OutboxEvent, now time.Time) bool {
+	message := events.Message{
+		ID:         event.ID,
+		Type:       event.Type,
+		SaleID:     event.SaleID,
+		Payload:    json.RawMessage(event.Payload),
+		OccurredAt: event.CreatedAt,
+	}
+
+	if err := r.publisher.Publish(ctx, message); err != nil {
+		log.Errorf("publishing outbox event %d failed, attempt %d: %v", event.ID, event.Attempts, err)
+		if markErr := r.outboxRepository.MarkFailed(ctx, event.ID, now.Add(outboxRetryAfter(event.Attempts)), err.Error()); markErr != nil {
+			log.Errorf("outbox event %d couldn't be rescheduled: %v", event.ID, markErr)
+		}
+		return false
+	}
+
+	// a failed mark only means the event is published again after the lease
+	if err := r.outboxRepository.MarkPublished(ctx, event.ID, now); err != nil {
+		log.Errorf("outbox event %d couldn't be marked published: %v", event.ID, err)
+	}
+
+	return true
+}
+
+// outboxRetryAfter is the wait before the next attempt after the given number of failed attempts.
+func outboxRetryAfter(attempts int) time.Duration {
+	return retryAfter(attempts, outboxRetryDelay, outboxMaxRetryDelay)
+}
+
+// retryAfter doubles delay for every failed attempt after the first, up to maxDelay.
+func retryAfter(attempts int, delay time.Duration, maxDelay time.Duration) time.Duration {
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		return maxDelay
+	}
+
+	return delay
+}
@@ -1,7 +1,10 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flash_sale_management/dto/request"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"flash_sale_management/utils"
@@ -15,37 +18,120 @@ const ProductKey = "KEY_PRODUCT:%d"
 type ProductService struct {
 	productRepository repository.ProductRepositoryInterface
 	redisService      RedisServiceInterface
+	unitOfWork        repository.UnitOfWorkInterface
 }
 
-func NewProductService(repo repository.ProductRepositoryInterface, redis RedisServiceInterface) ProductService {
-	return ProductService{productRepository: repo, redisService: redis}
+func NewProductService(repo repository.ProductRepositoryInterface, redis RedisServiceInterface, unitOfWork repository.UnitOfWorkInterface) ProductService {
+	return ProductService{productRepository: repo, redisService: redis, unitOfWork: unitOfWork}
 }
 
-func (ps *ProductService) CreateProduct(product entity.Product) *entity.Product {
-	ps.productRepository.Save(&product)
+func (ps *ProductService) CreateProduct(ctx context.Context, product entity.Product) (*entity.Product, error) {
+	result := ps.productRepository.Save(ctx, &product)
+	if result.Error != nil {
+		utils.CreateLogMessage("error creating product", result.Error)
+		return nil, result.Error
+	}
 
-	return &product
+	return &product, nil
 }
 
-func (ps *ProductService) UpdateProduct(product entity.Product) error {
-	product.UpdatedAt = time.Now()
-	result := ps.productRepository.Update(&product)
+func (ps *ProductService) SaveProduct(ctx context.Context, request request.CreateProductRequest) (*entity.Product, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
+
+	product := (&entity.Product{}).FromDto(request)
 
+	return ps.CreateProduct(ctx, *product)
+}
+
+func (ps *ProductService) FindProducts(ctx context.Context) (*[]entity.Product, error) {
+	result := ps.productRepository.FindAll(ctx)
 	if result.Error != nil {
-		utils.CreateLogMessage("error updating product from db", result.Error)
-		return result.Error
+		utils.CreateLogMessage("error getting all products from db", result.Error)
+		return nil, result.Error
+	}
+
+	return &result.Result, nil
+}
+
+// UpdateProductDetails applies the request to the product locked in the transaction and writes only the changed
+// columns, so stock taken by purchases committing meanwhile is not put back.
+func (ps *ProductService) UpdateProductDetails(ctx context.Context, request request.UpdateProductRequest) (*entity.Product, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
 	}
 
-	if err := ps.redisService.Set(fmt.Sprintf(ProductKey, product.ID), product); err != nil {
+	var product *entity.Product
+	err := ps.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		locked, err := ps.lockProduct(tx, request.ID)
+		if err != nil {
+			return notFoundError(err, fmt.Sprintf("product not found. id: %d", request.ID))
+		}
+		previous := *locked
+
+		product = locked.FromUpdateDto(request)
+		product.UpdatedAt = time.Now()
+		if result := ps.productRepository.UpdateColumnsInTx(tx, product, changedProductColumns(&previous, product)...); result.Error != nil {
+			utils.CreateLogMessage("error updating product from db", result.Error)
+			return result.Error
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ps.redisService.Set(withoutDeadline(ctx), fmt.Sprintf(ProductKey, product.ID), product); err != nil {
 		utils.CreateLogMessage("error setting product to redis", err)
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// changedProductColumns lists the columns an update request changed, updated_at always among them.
+func changedProductColumns(previous *entity.Product, product *entity.Product) []string {
+	columns := []string{"updated_at"}
+	if previous.Name != product.Name {
+		columns = append(columns, "name")
+	}
+	if previous.Price != product.Price {
+		columns = append(columns, "price")
+	}
+	if previous.Stock != product.Stock {
+		columns = append(columns, "stock")
+	}
+
+	return columns
+}
+
+func (ps *ProductService) DeleteProduct(ctx context.Context, id int) error {
+	_, err := ps.GetProduct(ctx, id)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	err = ps.productRepository.DeleteOneById(ctx, id)
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		deleteErr := &Error{Kind: KindConflict, Message: fmt.Sprintf("product has flash sales and can't be deleted. id: %d", id), Err: err}
+		utils.CreateLogMessage(deleteErr.Error(), err)
+		return deleteErr
+	}
+
+	if err != nil {
+		utils.CreateLogMessage("error deleting product from db", err)
+		return err
+	}
+
+	return ps.InvalidateProductCache(withoutDeadline(ctx), id)
 }
 
-func (ps *ProductService) GetProduct(id int) (*entity.Product, error) {
-	productCache, err := ps.redisService.Get(fmt.Sprintf(ProductKey, id))
+func (ps *ProductService) GetProduct(ctx context.Context, id int) (*entity.Product, error) {
+	productCache, err := ps.redisService.Get(ctx, fmt.Sprintf(ProductKey, id))
 	if err == nil {
 		var product entity.Product
 		if json.Unmarshal([]byte(productCache), &product) == nil {
@@ -53,14 +139,14 @@ func (ps *ProductService) GetProduct(id int) (*entity.Product, error) {
 		}
 	}
 
-	result := ps.productRepository.FindOneById(id)
+	result := ps.productRepository.FindOneById(ctx, id)
 	if result.Error != nil {
 		utils.CreateLogMessage("error getting product from db", result.Error)
-		return nil, result.Error
+		return nil, notFoundError(result.Error, fmt.Sprintf("product not found. id: %d", id))
 	}
 
-	data := result.Result.(*entity.Product)
-	if err := ps.redisService.Set(fmt.Sprintf(ProductKey, id), data); err != nil {
+	data := result.Result
+	if err := ps.redisService.Set(ctx, fmt.Sprintf(ProductKey, id), data); err != nil {
 		utils.CreateLogMessage("error updating product to redis", err)
 		return nil, err
 	}
@@ -68,26 +154,29 @@ func (ps *ProductService) GetProduct(id int) (*entity.Product, error) {
 	return data, nil
 }
 
-func (ps *ProductService) BeginTransaction() *gorm.DB {
-	return ps.productRepository.BeginTransaction()
-}
-
-func (ps *ProductService) updateProductWithLock(tx *gorm.DB, product *entity.Product) error {
-	if err := ps.productRepository.LockAndUpdateProduct(tx, product); err.Error != nil {
-		return err.Error
+func (ps *ProductService) lockProduct(tx *gorm.DB, id int) (*entity.Product, error) {
+	result := ps.productRepository.FindOneByIdForUpdate(tx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error locking product", result.Error)
+		return nil, result.Error
 	}
 
-	err := ps.InvalidateProductCache(product.ID)
-	if err != nil {
-		return err
+	return result.Result, nil
+}
+
+func (ps *ProductService) updateProductInTx(tx *gorm.DB, product *entity.Product) error {
+	product.UpdatedAt = time.Now()
+	if result := ps.productRepository.UpdateInTx(tx, product); result.Error != nil {
+		utils.CreateLogMessage("error updating product", result.Error)
+		return result.Error
 	}
 
 	return nil
 }
 
-func (ps *ProductService) InvalidateProductCache(productID int) error {
+func (ps *ProductService) InvalidateProductCache(ctx context.Context, productID int) error {
 	// invalidate product redis key
-	if err := ps.redisService.Delete(fmt.Sprintf(ProductKey, productID)); err != nil {
+	if err := ps.redisService.Delete(ctx, fmt.Sprintf(ProductKey, productID)); err != nil {
 		utils.CreateLogMessage("error deleting redis key", err)
 		return err
 	}
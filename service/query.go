@@ -0,0 +1,71 @@
+package service
+
+import (
+	"encoding/base64"
+	"flash_sale_management/utils"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryTimeLayout is the layout of the time filters, the same as the sale start and end times.
+const queryTimeLayout = "2006-01-02T15:04"
+
+func parseQueryTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(queryTimeLayout, value)
+	if err != nil {
+		err = &Error{Kind: KindValidation, Message: fmt.Sprintf("error parsing date: %v", err), Err: err}
+		utils.CreateLogMessage(err.Error(), err)
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// encodeCursor makes the opaque keyset cursor of the page after a row, from its sort value and id.
+func encodeCursor(value string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", value, id)))
+}
+
+// decodeCursor reads a cursor of encodeCursor, the sort value is a float when numeric and a time otherwise.
+func decodeCursor(cursor string, numeric bool) (interface{}, int, error) {
+	invalid := newError(KindValidation, "invalid cursor")
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		utils.CreateLogMessage(invalid.Error(), err)
+		return nil, 0, invalid
+	}
+
+	separator := strings.LastIndex(string(decoded), "|")
+	if separator < 0 {
+		utils.CreateLogMessage(invalid.Error(), invalid)
+		return nil, 0, invalid
+	}
+
+	id, err := strconv.Atoi(string(decoded[separator+1:]))
+	if err != nil {
+		utils.CreateLogMessage(invalid.Error(), err)
+		return nil, 0, invalid
+	}
+
+	raw := string(decoded[:separator])
+	var value interface{}
+	if numeric {
+		value, err = strconv.ParseFloat(raw, 64)
+	} else {
+		value, err = time.Parse(time.RFC3339Nano, raw)
+	}
+
+	if err != nil {
+		utils.CreateLogMessage(invalid.Error(), err)
+		return nil, 0, invalid
+	}
+
+	return value, id, nil
+}
@@ -3,13 +3,48 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/redis/go-redis/v9"
+	"time"
 )
 
+// ErrStockNotMirrored is returned by ReserveStock when the stock counter key does not exist yet.
+var ErrStockNotMirrored = errors.New("stock counter is not mirrored to redis")
+
+// reserveStockScript takes ARGV[1] units from the counter only when enough are left.
+// Returns the remaining stock, -1 when the counter can't cover the quantity and -2 when the key is missing.
+var reserveStockScript = redis.NewScript(`
+local stock = redis.call('GET', KEYS[1])
+if not stock then
+	return -2
+end
+local quantity = tonumber(ARGV[1])
+if tonumber(stock) < quantity then
+	return -1
+end
+return redis.call('DECRBY', KEYS[1], quantity)
+`)
+
+// addStockScript adds ARGV[1] units, a negative amount takes units away, but never recreates a counter that was
+// removed in the meantime.
+var addStockScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -2
+end
+return redis.call('INCRBY', KEYS[1], tonumber(ARGV[1]))
+`)
+
 type RedisServiceInterface interface {
-	Set(key string, value interface{}) error
-	Get(key string) (string, error)
-	Delete(key string) error
+	Set(ctx context.Context, key string, value interface{}) error
+	SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, key string) (string, error)
+	Delete(ctx context.Context, key string) error
+	InitStock(ctx context.Context, key string, stock int) error
+	ReserveStock(ctx context.Context, key string, quantity int) (bool, error)
+	ReleaseStock(ctx context.Context, key string, quantity int) error
+	AdjustStock(ctx context.Context, key string, delta int) error
+	Publish(ctx context.Context, channel string, message interface{}) error
 }
 
 type RedisService struct {
@@ -20,16 +55,33 @@ func NewRedisService(client *redis.Client) RedisService {
 	return RedisService{client: client}
 }
 
-func (rs *RedisService) Set(key string, value interface{}) error {
+func (rs *RedisService) Set(ctx context.Context, key string, value interface{}) error {
+	p, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return rs.client.Set(ctx, key, p, 0).Err()
+}
+
+func (rs *RedisService) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	p, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	return rs.client.Set(context.Background(), key, p, 0).Err()
+	return rs.client.Set(ctx, key, p, ttl).Err()
+}
+
+// SetNX stores the value only when the key doesn't exist and reports whether it was stored.
+func (rs *RedisService) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	p, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return rs.client.SetNX(ctx, key, p, ttl).Result()
 }
 
-func (rs *RedisService) Get(key string) (string, error) {
-	p, err := rs.client.Get(context.Background(), key).Result()
+func (rs *RedisService) Get(ctx context.Context, key string) (string, error) {
+	p, err := rs.client.Get(ctx, key).Result()
 	if err != nil {
 		return "", err
 	}
@@ -37,6 +89,48 @@ func (rs *RedisService) Get(key string) (string, error) {
 	return p, err
 }
 
-func (rs *RedisService) Delete(key string) error {
-	return rs.client.Del(context.Background(), key).Err()
+func (rs *RedisService) Delete(ctx context.Context, key string) error {
+	return rs.client.Del(ctx, key).Err()
+}
+
+// InitStock creates the stock counter unless another instance already did.
+func (rs *RedisService) InitStock(ctx context.Context, key string, stock int) error {
+	return rs.client.SetNX(ctx, key, stock, 0).Err()
+}
+
+// ReserveStock atomically decrements the stock counter by quantity.
+// It returns false without changing the counter when not enough stock is left.
+func (rs *RedisService) ReserveStock(ctx context.Context, key string, quantity int) (bool, error) {
+	remaining, err := reserveStockScript.Run(ctx, rs.client, []string{key}, quantity).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	switch remaining {
+	case -2:
+		return false, ErrStockNotMirrored
+	case -1:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ReleaseStock returns previously reserved units to the stock counter.
+func (rs *RedisService) ReleaseStock(ctx context.Context, key string, quantity int) error {
+	return addStockScript.Run(ctx, rs.client, []string{key}, quantity).Err()
+}
+
+// AdjustStock moves the stock counter by delta, leaving the units reserved by purchases in flight taken.
+// A missing counter stays missing, the next reservation seeds it from the database.
+func (rs *RedisService) AdjustStock(ctx context.Context, key string, delta int) error {
+	return addStockScript.Run(ctx, rs.client, []string{key}, delta).Err()
+}
+
+func (rs *RedisService) Publish(ctx context.Context, channel string, message interface{}) error {
+	p, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return rs.client.Publish(ctx, channel, p).Err()
 }
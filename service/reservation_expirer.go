@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2/log"
+	"time"
+)
+
+// ReservationExpirer periodically gives the stock of expired reservations back to their sales.
+type ReservationExpirer struct {
+	reservationService ReservationService
+	interval           time.Duration
+}
+
+func NewReservationExpirer(reservationService ReservationService, interval time.Duration) *ReservationExpirer {
+	return &ReservationExpirer{reservationService: reservationService, interval: interval}
+}
+
+func (e *ReservationExpirer) Start(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.Run(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run does a single expiry pass.
+func (e *ReservationExpirer) Run(ctx context.Context, now time.Time) {
+	expired, err := e.reservationService.ExpireReservations(ctx, now)
+	if err != nil {
+		log.Errorf("reservation expiry failed: %v", err)
+	}
+
+	for _, reservation := range expired {
+		log.Infof("reservation %d expired", reservation.ID)
+	}
+}
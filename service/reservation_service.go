@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/dto/request"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"flash_sale_management/utils"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// expiredReservationBatch is the number of expired reservations released in one ExpireReservations call.
+const expiredReservationBatch = 100
+
+// ReservationService is the two phase checkout: Reserve holds units of the sale stock for ttl,
+// ConfirmReservation turns the hold into an order and cancelled or expired holds give the units back.
+type ReservationService struct {
+	reservationRepository repository.ReservationRepositoryInterface
+	salesService          SalesService
+	ttl                   time.Duration
+}
+
+func NewReservationService(repo repository.ReservationRepositoryInterface, salesService SalesService, ttl time.Duration) ReservationService {
+	return ReservationService{
+		reservationRepository: repo,
+		salesService:          salesService,
+		ttl:                   ttl,
+	}
+}
+
+func (rs *ReservationService) Reserve(ctx context.Context, id int, request request.BuyProductRequest) (*entity.Reservation, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
+
+	quantity := request.GetQuantity()
+	ss := &rs.salesService
+
+	// a retried request returns the reservation made by the first one
+	idempotencyKey := orderIdempotencyKey(request)
+	if idempotencyKey != nil {
+		existing, err := rs.findReservationByIdempotencyKey(ctx, *idempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+	}
+
+	sale, product, err := ss.getSalesAndProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkOrder(sale, product, quantity); err != nil {
+		return nil, err
+	}
+
+	if err := ss.admit(ctx, sale, request.AdmissionToken, request.CustomerID); err != nil {
+		return nil, err
+	}
+
+	reservation, err := rs.hold(ctx, sale, request.CustomerID, quantity, idempotencyKey)
+	if err != nil {
+		ss.releaseAdmission(ctx, sale, request.AdmissionToken)
+	}
+
+	return reservation, err
+}
+
+// hold takes the units from the redis counter and the sale stock and stores the reservation in one transaction.
+// Held units count towards the customer's limit until the reservation is cancelled or expires.
+func (rs *ReservationService) hold(ctx context.Context, sale *entity.Sale, customerID string, quantity int, idempotencyKey *string) (*entity.Reservation, error) {
+	ss := &rs.salesService
+
+	if err := ss.takeSaleStock(ctx, sale.ID, quantity); err != nil {
+		return nil, err
+	}
+
+	reservation := entity.Reservation{
+		SaleID:         sale.ID,
+		ProductID:      sale.ProductID,
+		CustomerID:     customerID,
+		Quantity:       quantity,
+		Status:         entity.ReservationHeld,
+		ExpiresAt:      time.Now().Add(rs.ttl),
+		IdempotencyKey: idempotencyKey,
+	}
+
+	var updatedSale *entity.Sale
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		result := ss.saleRepository.FindOneByIdForUpdate(tx, sale.ID)
+		if result.Error != nil {
+			utils.CreateLogMessage("error locking sale", result.Error)
+			return result.Error
+		}
+		lockedSale := result.Result
+		updatedSale = lockedSale
+
+		product, err := ss.productService.lockProduct(tx, lockedSale.ProductID)
+		if err != nil {
+			return err
+		}
+
+		if !isPurchasable(lockedSale, product, quantity) {
+			err = unavailableError("reservation failed", lockedSale, product, quantity)
+			utils.CreateLogMessage(err.Error(), err)
+			return err
+		}
+
+		lockedSale.SaleStock -= quantity
+		lockedSale.UpdatedAt = time.Now()
+		if result := ss.saleRepository.UpdateInTx(tx, lockedSale); result.Error != nil {
+			utils.CreateLogMessage("error updating sale", result.Error)
+			return result.Error
+		}
+
+		purchase := entity.CustomerPurchase{SaleID: lockedSale.ID, CustomerID: customerID, Quantity: quantity}
+		if result := ss.saleRepository.IncreaseCustomerPurchaseInTx(tx, &purchase, lockedSale.MaxPerCustomer); result.Error != nil {
+			utils.CreateLogMessage("reservation failed", result.Error)
+			return result.Error
+		}
+
+		if result := rs.reservationRepository.SaveInTx(tx, &reservation); result.Error != nil {
+			utils.CreateLogMessage("error creating reservation", result.Error)
+			return result.Error
+		}
+
+		// held units count as sold, they only come back when the reservation is released
+		return writeSoldOutEvent(ss.outboxRepository, tx, lockedSale)
+	})
+	if err != nil {
+		ss.releaseSaleStock(ctx, sale.ID, quantity)
+
+		// a concurrent retry committed the reservation first
+		if idempotencyKey != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+			return rs.findReservationByIdempotencyKey(ctx, *idempotencyKey)
+		}
+
+		return nil, err
+	}
+
+	ctx = withoutDeadline(ctx)
+
+	if err := ss.InvalidateSalesCache(ctx, sale.ID); err != nil {
+		return nil, err
+	}
+
+	publishSaleChange(ctx, ss.redisService, newSaleChange(updatedSale, updatedSale.SaleStock+quantity, updatedSale.Active))
+
+	return &reservation, nil
+}
+
+// findReservationByIdempotencyKey returns nil without an error when no reservation was stored with the key.
+func (rs *ReservationService) findReservationByIdempotencyKey(ctx context.Context, key string) (*entity.Reservation, error) {
+	result := rs.reservationRepository.FindOneByIdempotencyKey(ctx, key)
+	if errors.Is(result.Error, repository.ErrNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding reservation by idempotency key", result.Error)
+		return nil, result.Error
+	}
+
+	return result.Result, nil
+}
+
+func (rs *ReservationService) FindReservation(ctx context.Context, id int) (*entity.Reservation, error) {
+	result := rs.reservationRepository.FindOneById(ctx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding reservation", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("reservation not found. id: %d", id))
+	}
+
+	return result.Result, nil
+}
+
+// ConfirmReservation turns a held reservation into an order. The sale stock was taken by the hold,
+// so only the product stock is decremented.
+func (rs *ReservationService) ConfirmReservation(ctx context.Context, id int, request request.ReservationRequest) (*entity.SaleLog, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
+
+	ss := &rs.salesService
+
+	var saleLog entity.SaleLog
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		reservation, err := rs.lockReservation(tx, id, request.CustomerID)
+		if err != nil {
+			return err
+		}
+
+		if reservation.Status != entity.ReservationHeld || reservation.IsExpired(time.Now()) {
+			err = newError(KindConflict, fmt.Sprintf("confirm failed: reservation is no longer held. id: %d", id))
+			utils.CreateLogMessage(err.Error(), err)
+			return err
+		}
+
+		result := ss.saleRepository.FindOneByIdForUpdate(tx, reservation.SaleID)
+		if result.Error != nil {
+			utils.CreateLogMessage("error locking sale", result.Error)
+			return result.Error
+		}
+		sale := result.Result
+
+		product, err := ss.productService.lockProduct(tx, reservation.ProductID)
+		if err != nil {
+			return err
+		}
+
+		if product.Stock < reservation.Quantity {
+			err = newError(KindSoldOut, "confirm failed: insufficient product stock")
+			utils.CreateLogMessage(err.Error(), err)
+			return err
+		}
+
+		product.Stock -= reservation.Quantity
+		if err := ss.productService.updateProductInTx(tx, product); err != nil {
+			return err
+		}
+
+		saleLog = newOrder(sale, product, reservation.CustomerID, reservation.Quantity)
+		if err := ss.saleLogService.saveSaleLogInTx(tx, &saleLog); err != nil {
+			utils.CreateLogMessage("error creating order", err)
+			return err
+		}
+
+		reservation.Status = entity.ReservationConfirmed
+		reservation.SaleLogID = &saleLog.ID
+		if result := rs.reservationRepository.UpdateInTx(tx, reservation); result.Error != nil {
+			utils.CreateLogMessage("error updating reservation", result.Error)
+			return result.Error
+		}
+
+		// the sold out event was written when the last units were reserved
+		return writeOutboxEvent(ss.outboxRepository, tx, entity.SalePurchased, sale.ID, newPurchasePayload(sale, &saleLog))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withoutDeadline(ctx)
+
+	if err := ss.productService.InvalidateProductCache(ctx, saleLog.ProductID); err != nil {
+		return nil, err
+	}
+
+	return &saleLog, nil
+}
+
+func (rs *ReservationService) CancelReservation(ctx context.Context, id int, request request.ReservationRequest) (*entity.Reservation, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
+
+	reservation, err := rs.release(ctx, id, request.CustomerID, entity.ReservationCancelled, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if reservation == nil {
+		err = newError(KindConflict, fmt.Sprintf("cancel failed: reservation is no longer held. id: %d", id))
+		utils.CreateLogMessage(err.Error(), err)
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// ExpireReservations gives the units of reservations whose hold ended back to their sales.
+// Each reservation is re-checked under its row lock, so instances running it at once release it only once.
+func (rs *ReservationService) ExpireReservations(ctx context.Context, now time.Time) ([]entity.Reservation, error) {
+	result := rs.reservationRepository.FindExpired(ctx, now, expiredReservationBatch)
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding expired reservations", result.Error)
+		return nil, result.Error
+	}
+
+	var expired []entity.Reservation
+	for _, reservation := range result.Result {
+		released, err := rs.release(ctx, reservation.ID, "", entity.ReservationExpired, now)
+		if err != nil {
+			return expired, err
+		}
+
+		if released != nil {
+			expired = append(expired, *released)
+		}
+	}
+
+	return expired, nil
+}
+
+// release ends a held reservation with status and returns its units to the sale stock, the redis counter and
+// the customer's limit. It returns nil when the reservation is no longer held, or not yet expired for status expired.
+func (rs *ReservationService) release(ctx context.Context, id int, customerID string, status string, now time.Time) (*entity.Reservation, error) {
+	ss := &rs.salesService
+
+	var released *entity.Reservation
+	var updatedSale *entity.Sale
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		reservation, err := rs.lockReservation(tx, id, customerID)
+		if err != nil {
+			return err
+		}
+
+		if reservation.Status != entity.ReservationHeld {
+			return nil
+		}
+
+		if status == entity.ReservationExpired && !reservation.IsExpired(now) {
+			return nil
+		}
+
+		// a deleted sale has no stock to give back
+		result := ss.saleRepository.FindOneByIdForUpdate(tx, reservation.SaleID)
+		if result.Error != nil && !errors.Is(result.Error, repository.ErrNotFound) {
+			utils.CreateLogMessage("error locking sale", result.Error)
+			return result.Error
+		}
+
+		if result.Error == nil {
+			sale := result.Result
+			sale.SaleStock += reservation.Quantity
+			sale.UpdatedAt = time.Now()
+			if result := ss.saleRepository.UpdateInTx(tx, sale); result.Error != nil {
+				utils.CreateLogMessage("error updating sale", result.Error)
+				return result.Error
+			}
+			updatedSale = sale
+		}
+
+		purchase := entity.CustomerPurchase{SaleID: reservation.SaleID, CustomerID: reservation.CustomerID, Quantity: reservation.Quantity}
+		if result := ss.saleRepository.DecreaseCustomerPurchaseInTx(tx, &purchase); result.Error != nil {
+			utils.CreateLogMessage("error updating customer purchase", result.Error)
+			return result.Error
+		}
+
+		reservation.Status = status
+		if result := rs.reservationRepository.UpdateInTx(tx, reservation); result.Error != nil {
+			utils.CreateLogMessage("error updating reservation", result.Error)
+			return result.Error
+		}
+
+		released = reservation
+		return nil
+	})
+	if err != nil || released == nil {
+		return nil, err
+	}
+
+	ctx = withoutDeadline(ctx)
+
+	ss.releaseSaleStock(ctx, released.SaleID, released.Quantity)
+
+	if err := ss.InvalidateSalesCache(ctx, released.SaleID); err != nil {
+		return nil, err
+	}
+
+	if updatedSale != nil {
+		publishSaleChange(ctx, ss.redisService, newSaleChange(updatedSale, updatedSale.SaleStock-released.Quantity, updatedSale.Active))
+	}
+
+	return released, nil
+}
+
+// lockReservation reads the reservation with a row lock. A non-empty customerID must own the reservation.
+func (rs *ReservationService) lockReservation(tx *gorm.DB, id int, customerID string) (*entity.Reservation, error) {
+	result := rs.reservationRepository.FindOneByIdForUpdate(tx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error locking reservation", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("reservation not found. id: %d", id))
+	}
+	reservation := result.Result
+
+	if customerID != "" && reservation.CustomerID != customerID {
+		err := newError(KindNotFound, fmt.Sprintf("reservation not found. id: %d", id))
+		utils.CreateLogMessage(err.Error(), err)
+		return nil, err
+	}
+
+	return reservation, nil
+}
@@ -1,21 +1,55 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"flash_sale_management/dto/request"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"flash_sale_management/utils"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const defaultOrderPageSize = 20
+
+var orderSortColumns = map[string]string{"createdAt": "created_at", "totalPrice": "total_price"}
+
 type SaleLogService struct {
 	saleLogRepository repository.SaleLogRepositoryInterface
+	saleRepository    repository.SaleRepositoryInterface
+	productService    ProductService
+	redisService      RedisServiceInterface
+	unitOfWork        repository.UnitOfWorkInterface
+	outboxRepository  repository.OutboxRepositoryInterface
+}
+
+func NewSaleLogService(repo repository.SaleLogRepositoryInterface, saleRepository repository.SaleRepositoryInterface, productService ProductService, redisService RedisServiceInterface, unitOfWork repository.UnitOfWorkInterface, outboxRepository repository.OutboxRepositoryInterface) SaleLogService {
+	return SaleLogService{
+		saleLogRepository: repo,
+		saleRepository:    saleRepository,
+		productService:    productService,
+		redisService:      redisService,
+		unitOfWork:        unitOfWork,
+		outboxRepository:  outboxRepository,
+	}
 }
 
-func NewSaleLogService(repo repository.SaleLogRepositoryInterface) SaleLogService {
-	return SaleLogService{saleLogRepository: repo}
+func (sl *SaleLogService) SaveSaleLog(ctx context.Context, saleLog *entity.SaleLog) error {
+	result := sl.saleLogRepository.Save(ctx, saleLog)
+	if result.Error != nil {
+		utils.CreateLogMessage("error inserting log to db", result.Error)
+		return result.Error
+	}
+
+	return nil
 }
 
-func (sl *SaleLogService) SaveSaleLog(saleLog *entity.SaleLog) error {
-	result := sl.saleLogRepository.Save(saleLog)
+func (sl *SaleLogService) saveSaleLogInTx(tx *gorm.DB, saleLog *entity.SaleLog) error {
+	result := sl.saleLogRepository.SaveInTx(tx, saleLog)
 	if result.Error != nil {
 		utils.CreateLogMessage("error inserting log to db", result.Error)
 		return result.Error
@@ -23,3 +57,235 @@ func (sl *SaleLogService) SaveSaleLog(saleLog *entity.SaleLog) error {
 
 	return nil
 }
+
+// FindSaleLogByIdempotencyKey returns nil without an error when no order was stored with the key.
+func (sl *SaleLogService) FindSaleLogByIdempotencyKey(ctx context.Context, key string) (*entity.SaleLog, error) {
+	result := sl.saleLogRepository.FindOneByIdempotencyKey(ctx, key)
+	if errors.Is(result.Error, repository.ErrNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding log by idempotency key", result.Error)
+		return nil, result.Error
+	}
+
+	return result.Result, nil
+}
+
+func (sl *SaleLogService) FindSaleLog(ctx context.Context, id int) (*entity.SaleLog, error) {
+	result := sl.saleLogRepository.FindOneById(ctx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding log", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("order not found. id: %d", id))
+	}
+
+	return result.Result, nil
+}
+
+// FindOrders returns a page of the orders matching the query and the cursor of the next page,
+// the cursor is empty on the last page.
+func (sl *SaleLogService) FindOrders(ctx context.Context, query request.OrderQuery) (*[]entity.SaleLog, string, error) {
+	if err := query.Validate(); err != nil {
+		utils.CreateLogMessage("query validation error", err)
+		return nil, "", validationError(err)
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultOrderPageSize
+	}
+
+	sort := query.Sort
+	if sort == "" {
+		sort = "-createdAt"
+	}
+
+	logQuery := repository.SaleLogQuery{
+		SaleID:     query.SaleID,
+		ProductID:  query.ProductID,
+		CustomerID: query.CustomerID,
+		Status:     query.Status,
+		SortColumn: orderSortColumns[strings.TrimPrefix(sort, "-")],
+		Descending: strings.HasPrefix(sort, "-"),
+		Limit:      limit + 1,
+	}
+
+	var err error
+	if logQuery.From, err = parseQueryTime(query.From); err != nil {
+		return nil, "", err
+	}
+
+	if logQuery.To, err = parseQueryTime(query.To); err != nil {
+		return nil, "", err
+	}
+
+	if query.Cursor != "" {
+		if logQuery.AfterValue, logQuery.AfterID, err = decodeOrderCursor(query.Cursor, logQuery.SortColumn); err != nil {
+			return nil, "", err
+		}
+	}
+
+	result := sl.saleLogRepository.FindAllByQuery(ctx, logQuery)
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding orders", result.Error)
+		return nil, "", result.Error
+	}
+
+	orders := result.Result
+	nextCursor := ""
+	if len(orders) > limit {
+		orders = orders[:limit]
+		nextCursor = encodeOrderCursor(orders[limit-1], logQuery.SortColumn)
+	}
+
+	return &orders, nextCursor, nil
+}
+
+// encodeOrderCursor makes the opaque cursor of the page after order, from its sort value and id.
+func encodeOrderCursor(order entity.SaleLog, column string) string {
+	value := order.CreatedAt.Format(time.RFC3339Nano)
+	if column == "total_price" {
+		value = strconv.FormatFloat(order.TotalPrice, 'f', -1, 64)
+	}
+
+	return encodeCursor(value, order.ID)
+}
+
+func decodeOrderCursor(cursor string, column string) (interface{}, int, error) {
+	return decodeCursor(cursor, column == "total_price")
+}
+
+// CancelOrder cancels a placed order of the customer and gives its units back.
+func (sl *SaleLogService) CancelOrder(ctx context.Context, id int, request request.CancelOrderRequest) (*entity.SaleLog, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
+
+	return sl.returnOrder(ctx, id, request.CustomerID, entity.OrderCancelled)
+}
+
+// RefundOrder marks a placed order as refunded and gives its units back.
+func (sl *SaleLogService) RefundOrder(ctx context.Context, id int) (*entity.SaleLog, error) {
+	return sl.returnOrder(ctx, id, "", entity.OrderRefunded)
+}
+
+// returnOrder ends a placed order with status in one transaction. The units go back to the product stock and,
+// while the sale is still running, to the sale stock and its redis counter. A non-empty customerID must own the order.
+func (sl *SaleLogService) returnOrder(ctx context.Context, id int, customerID string, status string) (*entity.SaleLog, error) {
+	var order *entity.SaleLog
+	var sale *entity.Sale
+	var restored bool
+
+	err := sl.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		result := sl.saleLogRepository.FindOneByIdForUpdate(tx, id)
+		if result.Error != nil {
+			utils.CreateLogMessage("error locking order", result.Error)
+			return notFoundError(result.Error, fmt.Sprintf("order not found. id: %d", id))
+		}
+		order = result.Result
+
+		if customerID != "" && order.CustomerID != customerID {
+			err := newError(KindNotFound, fmt.Sprintf("order not found. id: %d", id))
+			utils.CreateLogMessage(err.Error(), err)
+			return err
+		}
+
+		if order.Status != entity.OrderPlaced {
+			err := newError(KindConflict, fmt.Sprintf("order is already %s. id: %d", order.Status, id))
+			utils.CreateLogMessage(err.Error(), err)
+			return err
+		}
+
+		// sale and product are locked in the same order as a purchase does
+		var err error
+		sale, err = sl.lockSaleOfOrder(tx, order)
+		if err != nil {
+			return err
+		}
+
+		if sale != nil {
+			// a sale the scheduler switched off for selling out is still running, it is switched on again once restocked
+			if time.Now().Before(sale.EndTime) {
+				sale.SaleStock += order.Quantity
+				sale.UpdatedAt = time.Now()
+				if result := sl.saleRepository.UpdateInTx(tx, sale); result.Error != nil {
+					utils.CreateLogMessage("error updating sale", result.Error)
+					return result.Error
+				}
+				restored = true
+			}
+
+			purchase := entity.CustomerPurchase{SaleID: sale.ID, CustomerID: order.CustomerID, Quantity: order.Quantity}
+			if result := sl.saleRepository.DecreaseCustomerPurchaseInTx(tx, &purchase); result.Error != nil {
+				utils.CreateLogMessage("error updating customer purchase", result.Error)
+				return result.Error
+			}
+		}
+
+		product, err := sl.productService.lockProduct(tx, order.ProductID)
+		if err != nil {
+			return err
+		}
+
+		product.Stock += order.Quantity
+		if err := sl.productService.updateProductInTx(tx, product); err != nil {
+			return err
+		}
+
+		order.Status = status
+		if result := sl.saleLogRepository.UpdateInTx(tx, order); result.Error != nil {
+			utils.CreateLogMessage("error updating order", result.Error)
+			return result.Error
+		}
+
+		return writeOrderEvent(sl.outboxRepository, tx, order, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withoutDeadline(ctx)
+
+	if sale != nil {
+		if restored {
+			if err := sl.redisService.ReleaseStock(ctx, fmt.Sprintf(SaleStockKey, sale.ID), order.Quantity); err != nil {
+				utils.CreateLogMessage("error releasing sale stock", err)
+			}
+		}
+
+		if err := invalidateSaleCache(ctx, sl.redisService, sale.ID); err != nil {
+			return nil, err
+		}
+
+		if restored {
+			publishSaleChange(ctx, sl.redisService, newSaleChange(sale, sale.SaleStock-order.Quantity, sale.Active))
+		}
+	}
+
+	if err := sl.productService.InvalidateProductCache(ctx, order.ProductID); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// lockSaleOfOrder locks the sale the order was bought from, nil for old orders that are not linked to a sale.
+func (sl *SaleLogService) lockSaleOfOrder(tx *gorm.DB, order *entity.SaleLog) (*entity.Sale, error) {
+	if order.SaleID == nil {
+		return nil, nil
+	}
+
+	result := sl.saleRepository.FindOneByIdForUpdate(tx, *order.SaleID)
+	if errors.Is(result.Error, repository.ErrNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		utils.CreateLogMessage("error locking sale", result.Error)
+		return nil, result.Error
+	}
+
+	return result.Result, nil
+}
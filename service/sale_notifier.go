@@ -0,0 +1,53 @@
+package service
+
+import (
+	"flash_sale_management/hub"
+	"time"
+)
+
+// SaleNotifier turns the sale events of all instances into the lifecycle notifications of the websocket hub.
+type SaleNotifier struct {
+	hub      *hub.Hub
+	lowStock int
+}
+
+// NewSaleNotifier notifies low stock once the sale stock drops to lowStock units, 0 turns it off.
+func NewSaleNotifier(hub *hub.Hub, lowStock int) SaleNotifier {
+	return SaleNotifier{hub: hub, lowStock: lowStock}
+}
+
+func (n *SaleNotifier) Notify(event SaleEvent) {
+	now := time.Now()
+	for _, notification := range n.notifications(event) {
+		n.hub.Publish(hub.Event{Type: notification, SaleID: event.SaleID, SaleStock: event.SaleStock, Time: now})
+	}
+}
+
+// notifications compares the sale with its state before the change, in the order things happened to it.
+func (n *SaleNotifier) notifications(event SaleEvent) []string {
+	if event.Starting {
+		return []string{hub.SaleStarting}
+	}
+
+	if event.Deleted {
+		return []string{hub.SaleEnded}
+	}
+
+	var notifications []string
+	if event.Active && !event.WasActive {
+		notifications = append(notifications, hub.SaleStarted)
+	}
+
+	if event.SaleStock <= 0 && event.PreviousStock > 0 {
+		notifications = append(notifications, hub.SaleSoldOut)
+	} else if event.SaleStock > 0 && event.SaleStock <= n.lowStock && event.PreviousStock > n.lowStock {
+		notifications = append(notifications, hub.SaleLowStock)
+	}
+
+	// a sold out sale was already notified as such
+	if !event.Active && event.WasActive && event.SaleStock > 0 {
+		notifications = append(notifications, hub.SaleEnded)
+	}
+
+	return notifications
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2/log"
+	"time"
+)
+
+// SaleScheduler announces sales starting within startingLead, activates sales at their start time and deactivates
+// them when they end or sell out. Activation and deactivation claim the sale rows in the database and announcements
+// are claimed in redis, so the scheduler can run on every instance.
+type SaleScheduler struct {
+	salesService SalesService
+	interval     time.Duration
+	startingLead time.Duration
+}
+
+func NewSaleScheduler(salesService SalesService, interval time.Duration, startingLead time.Duration) *SaleScheduler {
+	return &SaleScheduler{salesService: salesService, interval: interval, startingLead: startingLead}
+}
+
+func (s *SaleScheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Run(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run does a single scheduling pass.
+func (s *SaleScheduler) Run(ctx context.Context, now time.Time) {
+	if s.startingLead > 0 {
+		announced, err := s.salesService.AnnounceStartingSales(ctx, now, s.startingLead)
+		if err != nil {
+			log.Errorf("sale scheduler announcement failed: %v", err)
+		}
+
+		for _, sale := range announced {
+			log.Infof("sale %d starting", sale.ID)
+		}
+	}
+
+	activated, err := s.salesService.ActivateDueSales(ctx, now)
+	if err != nil {
+		log.Errorf("sale scheduler activation failed: %v", err)
+	}
+
+	for _, sale := range activated {
+		log.Infof("sale %d activated", sale.ID)
+	}
+
+	deactivated, err := s.salesService.DeactivateFinishedSales(ctx, now)
+	if err != nil {
+		log.Errorf("sale scheduler deactivation failed: %v", err)
+	}
+
+	for _, sale := range deactivated {
+		log.Infof("sale %d deactivated", sale.ID)
+	}
+}
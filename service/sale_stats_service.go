@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"flash_sale_management/repository"
+	"flash_sale_management/utils"
+	"fmt"
+	"math"
+	"time"
+)
+
+const SaleStatsKey = "KEY_SALE_STATS:%d"
+
+// SaleStats reports on the placed orders of a sale.
+type SaleStats struct {
+	SaleID          int
+	UnitsSold       int64
+	Revenue         float64
+	DiscountGiven   float64
+	SellThrough     float64        // percentage of the initial stock sold by placed orders
+	TimeToSellOut   *time.Duration // from the sale start to the last order, nil until placed orders took the initial stock
+	UniqueCustomers int64
+	PerMinute       []repository.SaleLogMinute
+}
+
+// SaleStatsService computes sale stats from the sale logs and caches them for a short ttl,
+// so a busy report page doesn't run the aggregates on every request.
+type SaleStatsService struct {
+	saleLogRepository repository.SaleLogRepositoryInterface
+	saleRepository    repository.SaleRepositoryInterface
+	redisService      RedisServiceInterface
+	ttl               time.Duration
+}
+
+func NewSaleStatsService(saleLogRepository repository.SaleLogRepositoryInterface, saleRepository repository.SaleRepositoryInterface, redisService RedisServiceInterface, ttl time.Duration) SaleStatsService {
+	return SaleStatsService{
+		saleLogRepository: saleLogRepository,
+		saleRepository:    saleRepository,
+		redisService:      redisService,
+		ttl:               ttl,
+	}
+}
+
+func (s *SaleStatsService) GetSaleStats(ctx context.Context, id int) (*SaleStats, error) {
+	statsCache, err := s.redisService.Get(ctx, fmt.Sprintf(SaleStatsKey, id))
+	if err == nil {
+		var stats SaleStats
+		if json.Unmarshal([]byte(statsCache), &stats) == nil {
+			return &stats, nil
+		}
+	}
+
+	result := s.saleRepository.FindOneById(ctx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding sale", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("flash sale not found. id: %d", id))
+	}
+	sale := result.Result
+
+	totalsResult := s.saleLogRepository.SumBySale(ctx, id)
+	if totalsResult.Error != nil {
+		utils.CreateLogMessage("error summing sale logs", totalsResult.Error)
+		return nil, totalsResult.Error
+	}
+	totals := totalsResult.Result
+
+	perMinuteResult := s.saleLogRepository.CountPerMinuteBySale(ctx, id)
+	if perMinuteResult.Error != nil {
+		utils.CreateLogMessage("error counting sale logs per minute", perMinuteResult.Error)
+		return nil, perMinuteResult.Error
+	}
+
+	stats := SaleStats{
+		SaleID:          id,
+		UnitsSold:       totals.UnitsSold,
+		Revenue:         totals.Revenue,
+		DiscountGiven:   totals.DiscountGiven,
+		UniqueCustomers: totals.UniqueCustomers,
+		PerMinute:       perMinuteResult.Result,
+	}
+
+	// units held by reservations are taken from the sale stock but not sold, so the sold units are compared to the
+	// initial stock instead of what is left
+	if sale.InitialStock > 0 {
+		stats.SellThrough = math.Round(float64(totals.UnitsSold)*10000/float64(sale.InitialStock)) / 100
+	}
+
+	if sale.InitialStock > 0 && totals.UnitsSold >= int64(sale.InitialStock) && totals.LastOrderAt != nil {
+		timeToSellOut := totals.LastOrderAt.Sub(sale.StartTime)
+		stats.TimeToSellOut = &timeToSellOut
+	}
+
+	if err := s.redisService.SetWithTTL(ctx, fmt.Sprintf(SaleStatsKey, id), stats, s.ttl); err != nil {
+		utils.CreateLogMessage("error setting sale stats to redis", err)
+		return nil, err
+	}
+
+	return &stats, nil
+}
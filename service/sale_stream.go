@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"flash_sale_management/entity"
+	"flash_sale_management/utils"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// SaleEventsChannel is the redis pub/sub channel sale changes are published on.
+const SaleEventsChannel = "SALE_EVENTS"
+
+// SaleEvent is the state of a sale after a purchase or an update changed it,
+// with the stock and active flag it had before the change.
+type SaleEvent struct {
+	SaleID        int
+	SaleStock     int
+	Active        bool
+	StartTime     time.Time
+	EndTime       time.Time
+	Deleted       bool
+	Starting      bool
+	PreviousStock int
+	WasActive     bool
+}
+
+// NewSaleEvent is the state of the sale without a change, e.g. for a stream that was just opened.
+func NewSaleEvent(sale *entity.Sale) SaleEvent {
+	return newSaleChange(sale, sale.SaleStock, sale.Active)
+}
+
+func newSaleChange(sale *entity.Sale, previousStock int, wasActive bool) SaleEvent {
+	return SaleEvent{
+		SaleID:        sale.ID,
+		SaleStock:     sale.SaleStock,
+		Active:        sale.Active,
+		StartTime:     sale.StartTime,
+		EndTime:       sale.EndTime,
+		PreviousStock: previousStock,
+		WasActive:     wasActive,
+	}
+}
+
+// publishSaleChange tells the streams on every instance about the new state of the sale.
+// The change is already committed, so a failed publish is only logged.
+func publishSaleChange(ctx context.Context, redisService RedisServiceInterface, event SaleEvent) {
+	if err := redisService.Publish(ctx, SaleEventsChannel, event); err != nil {
+		utils.CreateLogMessage("error publishing sale event", err)
+	}
+}
+
+// SaleStream receives the sale events of all instances and fans them out to the streams opened on this one.
+type SaleStream struct {
+	client      *redis.Client
+	mutex       sync.Mutex
+	subscribers map[int]map[chan SaleEvent]struct{}
+	listeners   []func(SaleEvent)
+}
+
+func NewSaleStream(client *redis.Client) *SaleStream {
+	return &SaleStream{client: client, subscribers: make(map[int]map[chan SaleEvent]struct{})}
+}
+
+// Start listens on the sale events channel until the context is cancelled.
+func (s *SaleStream) Start(ctx context.Context) {
+	pubsub := s.client.Subscribe(ctx, SaleEventsChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var event SaleEvent
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				utils.CreateLogMessage("error reading sale event", err)
+				continue
+			}
+			s.Broadcast(event)
+			for _, listener := range s.listeners {
+				listener(event)
+			}
+		}
+	}
+}
+
+// Listen registers a listener called with every received event, listeners have to be added before Start.
+func (s *SaleStream) Listen(listener func(SaleEvent)) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// Subscribe returns a channel receiving the events of the sale and a function closing it.
+func (s *SaleStream) Subscribe(saleID int) (<-chan SaleEvent, func()) {
+	events := make(chan SaleEvent, 1)
+
+	s.mutex.Lock()
+	if s.subscribers[saleID] == nil {
+		s.subscribers[saleID] = make(map[chan SaleEvent]struct{})
+	}
+	s.subscribers[saleID][events] = struct{}{}
+	s.mutex.Unlock()
+
+	unsubscribe := func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if _, ok := s.subscribers[saleID][events]; !ok {
+			return
+		}
+		delete(s.subscribers[saleID], events)
+		if len(s.subscribers[saleID]) == 0 {
+			delete(s.subscribers, saleID)
+		}
+		close(events)
+	}
+
+	return events, unsubscribe
+}
+
+// Broadcast hands the event to the subscribers of its sale. A subscriber only needs the latest state,
+// so when a slow one hasn't read the previous event yet it is replaced instead of blocking the others.
+func (s *SaleStream) Broadcast(event SaleEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for events := range s.subscribers[event.SaleID] {
+		select {
+		case events <- event:
+		default:
+			select {
+			case <-events:
+			default:
+			}
+			events <- event
+		}
+	}
+}
@@ -1,88 +1,78 @@
 package service
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"flash_sale_management/dto/request"
 	"flash_sale_management/entity"
+	"flash_sale_management/queue"
 	"flash_sale_management/repository"
 	"flash_sale_management/utils"
 	"fmt"
 	"github.com/gofiber/fiber/v2/log"
 	"gorm.io/gorm"
-	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type SalesService struct {
-	saleRepository repository.SaleRepositoryInterface
-	productService ProductService
-	saleLogService SaleLogService
-	redisService   RedisServiceInterface
+	saleRepository   repository.SaleRepositoryInterface
+	productService   ProductService
+	saleLogService   SaleLogService
+	redisService     RedisServiceInterface
+	unitOfWork       repository.UnitOfWorkInterface
+	waitingRoom      WaitingRoom
+	outboxRepository repository.OutboxRepositoryInterface
 }
 
-const SalesKey = "KEY_SALES"
+const SalesPageKey = "KEY_SALES:%s:%x"
+const SalesVersionKey = "KEY_SALES_VERSION"
 const SaleKey = "KEY_SALE:%d"
+const SaleStockKey = "KEY_SALE_STOCK:%d"
+const SaleStartingKey = "KEY_SALE_STARTING:%d:%d"
 
-func NewSalesService(repo repository.SaleRepositoryInterface, productService ProductService, saleLogService SaleLogService, service RedisServiceInterface) SalesService {
-	return SalesService{
-		saleRepository: repo,
-		productService: productService,
-		saleLogService: saleLogService,
-		redisService:   service,
-	}
-}
+const defaultSalePageSize = 20
 
-func (ss *SalesService) FindSales() (*[]entity.Sale, error) {
-	salesCache, err := ss.redisService.Get(SalesKey)
-	if err == nil {
-		var sales []entity.Sale
-		if json.Unmarshal([]byte(salesCache), &sales) == nil {
-			return &sales, nil
-		}
-	}
+// salePageTTL bounds how long a cached page misses the sales that change status by time alone, e.g. by starting.
+const salePageTTL = 30 * time.Second
 
-	result := ss.saleRepository.FindAll()
-	if result.Error != nil {
-		utils.CreateLogMessage("error getting all sales from db", result.Error)
-		return nil, result.Error
-	}
+var saleSortColumns = map[string]string{"startTime": "start_time", "endTime": "end_time", "discount": "discount", "createdAt": "created_at"}
 
-	var salesFromDB []entity.Sale
-	if reflect.TypeOf(result.Result).Elem().Kind() == reflect.Slice {
-		salesFromDB = *(result.Result.(*[]entity.Sale))
-	} else {
-		singleData := result.Result.(*entity.Sale)
-		salesFromDB = []entity.Sale{*singleData}
-	}
+// SalePage is a page of sales, Total counts every sale matching the filters.
+type SalePage struct {
+	Sales      []entity.Sale `json:"sales"`
+	NextCursor string        `json:"nextCursor"`
+	Total      int64         `json:"total"`
+}
 
-	if err := ss.redisService.Set(SalesKey, salesFromDB); err != nil {
-		utils.CreateLogMessage("error setting all sales to redis", result.Error)
-		return nil, err
+func NewSalesService(repo repository.SaleRepositoryInterface, productService ProductService, saleLogService SaleLogService, service RedisServiceInterface, unitOfWork repository.UnitOfWorkInterface, waitingRoom WaitingRoom, outboxRepository repository.OutboxRepositoryInterface) SalesService {
+	return SalesService{
+		saleRepository:   repo,
+		productService:   productService,
+		saleLogService:   saleLogService,
+		redisService:     service,
+		unitOfWork:       unitOfWork,
+		waitingRoom:      waitingRoom,
+		outboxRepository: outboxRepository,
 	}
-
-	return &salesFromDB, nil
 }
 
-func (ss *SalesService) CreateSale(request request.CreateSaleRequest) (*entity.Sale, error) {
+func (ss *SalesService) CreateSale(ctx context.Context, request request.CreateSaleRequest) (*entity.Sale, error) {
 	if err := request.Validate(); err != nil {
 		utils.CreateLogMessage("body validation error", err)
-		return nil, err
+		return nil, validationError(err)
 	}
 
-	product, err := ss.productService.GetProduct(request.ProductID)
+	product, err := ss.productService.GetProduct(ctx, request.ProductID)
 	if err != nil {
 		return nil, err
 	}
 
 	if product.Stock <= 0 {
-		err = errors.New(fmt.Sprintf("product doesn't have stock. id: %d", product.ID))
-		utils.CreateLogMessage(err.Error(), err)
-		return nil, err
-	}
-
-	if ss.saleRepository.FindOneByProduct(request.ProductID).Result != nil {
-		err = errors.New(fmt.Sprintf("flash sale already exists for this product: %d", request.ProductID))
+		err = newError(KindConflict, fmt.Sprintf("product doesn't have stock. id: %d", product.ID))
 		utils.CreateLogMessage(err.Error(), err)
 		return nil, err
 	}
@@ -93,56 +83,293 @@ func (ss *SalesService) CreateSale(request request.CreateSaleRequest) (*entity.S
 	}
 
 	if sale.StartTime.After(sale.EndTime) || sale.EndTime.Before(time.Now()) {
-		err = errors.New("incorrect time information")
+		err = newError(KindValidation, "incorrect time information")
 		utils.CreateLogMessage(err.Error(), err)
 		return nil, err
 	}
 
+	if err := validateWaitingRoom(sale); err != nil {
+		return nil, err
+	}
+
 	return sale, nil
 }
 
-func (ss *SalesService) SaveSale(sale *entity.Sale) (*entity.Sale, error) {
-	result := ss.saleRepository.Save(sale)
+// checkOverlappingSalesInTx refuses a sale of a product that is already on sale, by an active sale or one running at
+// some point of the new sale's period. Sales that ended don't count, the product can be put on sale again.
+// The product is locked first, so sales of the product created at the same time are checked one after the other.
+func (ss *SalesService) checkOverlappingSalesInTx(tx *gorm.DB, sale *entity.Sale) error {
+	if _, err := ss.productService.lockProduct(tx, sale.ProductID); err != nil {
+		return err
+	}
+
+	result := ss.saleRepository.FindAllByProductInTx(tx, sale.ProductID)
 	if result.Error != nil {
-		utils.CreateLogMessage("create sale error", result.Error)
-		return nil, result.Error
+		utils.CreateLogMessage("error finding sales of product", result.Error)
+		return result.Error
+	}
+
+	for _, existing := range result.Result {
+		if existing.Active || (existing.StartTime.Before(sale.EndTime) && sale.StartTime.Before(existing.EndTime)) {
+			err := newError(KindConflict, fmt.Sprintf("product %d is already on sale in that period. sale id: %d", sale.ProductID, existing.ID))
+			utils.CreateLogMessage(err.Error(), err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveSale stores a sale made by CreateSale, unless a sale of its product created meanwhile overlaps it.
+func (ss *SalesService) SaveSale(ctx context.Context, sale *entity.Sale) (*entity.Sale, error) {
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		if err := ss.checkOverlappingSalesInTx(tx, sale); err != nil {
+			return err
+		}
+
+		if result := ss.saleRepository.SaveInTx(tx, sale); result.Error != nil {
+			utils.CreateLogMessage("create sale error", result.Error)
+			return result.Error
+		}
+
+		return writeOutboxEvent(ss.outboxRepository, tx, entity.SaleCreated, sale.ID, newSalePayload(sale))
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	err := ss.InvalidateSalesCache(0)
+	ctx = withoutDeadline(ctx)
+
+	err = ss.InvalidateSalesCache(ctx, 0)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := ss.mirrorSaleStock(ctx, sale); err != nil {
+		return nil, err
+	}
+
 	return sale, nil
 }
 
-func (ss *SalesService) UpdateSale(request request.UpdateSaleRequest) (*entity.Sale, error) {
+// UpdateSale applies the request to the sale locked in the transaction, so purchases committing meanwhile keep the
+// stock they took. Only the changed columns are written.
+func (ss *SalesService) UpdateSale(ctx context.Context, request request.UpdateSaleRequest) (*entity.Sale, error) {
 	if err := request.Validate(); err != nil {
 		utils.CreateLogMessage("body validation error", err)
-		return nil, err
+		return nil, validationError(err)
 	}
 
-	sale, err := ss.FindSale(request.ID)
+	var previous entity.Sale
+	var sale *entity.Sale
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		result := ss.saleRepository.FindOneByIdForUpdate(tx, request.ID)
+		if result.Error != nil {
+			utils.CreateLogMessage("error locking sale", result.Error)
+			return notFoundError(result.Error, fmt.Sprintf("flash sale not found. id: %d", request.ID))
+		}
+		previous = *result.Result
+
+		updated, err := result.Result.FromUpdateDto(request)
+		if err != nil {
+			log.Errorf(err.Error())
+			return err
+		}
+
+		if err := validateWaitingRoom(updated); err != nil {
+			return err
+		}
+
+		updated.UpdatedAt = time.Now()
+		if result := ss.saleRepository.UpdateColumnsInTx(tx, updated, changedSaleColumns(&previous, updated)...); result.Error != nil {
+			utils.CreateLogMessage("error updating sale", result.Error)
+			return result.Error
+		}
+		sale = updated
+
+		return writeOutboxEvent(ss.outboxRepository, tx, entity.SaleUpdated, sale.ID, newSalePayload(sale))
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	sale, err = sale.FromUpdateDto(request)
+	ctx = withoutDeadline(ctx)
+
+	if err := ss.InvalidateSalesCache(ctx, sale.ID); err != nil {
+		return nil, err
+	}
+
+	if err := ss.redisService.Set(ctx, fmt.Sprintf(SaleKey, sale.ID), sale); err != nil {
+		utils.CreateLogMessage("error setting sale to redis", err)
+		return nil, err
+	}
+
+	if err := ss.syncSaleStock(ctx, &previous, sale); err != nil {
+		return nil, err
+	}
+
+	publishSaleChange(ctx, ss.redisService, newSaleChange(sale, previous.SaleStock, previous.Active))
+
+	return sale, nil
+}
+
+// changedSaleColumns lists the columns an update request changed, updated_at always among them.
+func changedSaleColumns(previous *entity.Sale, sale *entity.Sale) []string {
+	columns := []string{"updated_at"}
+	add := func(column string, changed bool) {
+		if changed {
+			columns = append(columns, column)
+		}
+	}
+
+	add("sale_stock", previous.SaleStock != sale.SaleStock)
+	add("initial_stock", previous.InitialStock != sale.InitialStock)
+	add("discount", previous.Discount != sale.Discount)
+	add("start_time", !previous.StartTime.Equal(sale.StartTime))
+	add("end_time", !previous.EndTime.Equal(sale.EndTime))
+	add("active", previous.Active != sale.Active)
+	add("activated_at", (previous.ActivatedAt == nil) != (sale.ActivatedAt == nil))
+	add("max_per_customer", previous.MaxPerCustomer != sale.MaxPerCustomer)
+	add("max_per_order", previous.MaxPerOrder != sale.MaxPerOrder)
+	add("waiting_room", previous.WaitingRoom != sale.WaitingRoom)
+	add("admission_rate", previous.AdmissionRate != sale.AdmissionRate)
+
+	return columns
+}
+
+func validateWaitingRoom(sale *entity.Sale) error {
+	if sale.WaitingRoom && sale.AdmissionRate <= 0 {
+		err := newError(KindValidation, "waiting room needs an admission rate greater than zero")
+		utils.CreateLogMessage(err.Error(), err)
+		return err
+	}
+
+	return nil
+}
+
+func (ss *SalesService) JoinWaitingRoom(ctx context.Context, id int, customerID string) (*queue.Status, error) {
+	sale, err := ss.FindSale(ctx, id)
 	if err != nil {
-		log.Errorf(err.Error())
 		return nil, err
 	}
 
-	sale, err = ss.Update(sale)
+	return ss.waitingRoom.Join(ctx, sale, customerID, time.Now())
+}
+
+func (ss *SalesService) GetWaitingRoomStatus(ctx context.Context, id int, token string) (*queue.Status, error) {
+	sale, err := ss.FindSale(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	return sale, nil
+	return ss.waitingRoom.Status(ctx, sale, token, time.Now())
 }
 
-func (ss *SalesService) FindSale(id int) (*entity.Sale, error) {
-	saleCache, err := ss.redisService.Get(fmt.Sprintf(SaleKey, id))
+// FindSalePage returns a page of the sales matching the query and the cursor of the next page, the cursor is empty
+// on the last page. Pages are cached per query until any sale changes.
+func (ss *SalesService) FindSalePage(ctx context.Context, query request.SaleQuery) (*SalePage, error) {
+	if err := query.Validate(); err != nil {
+		utils.CreateLogMessage("query validation error", err)
+		return nil, validationError(err)
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultSalePageSize
+	}
+
+	if query.Sort == "" {
+		query.Sort = "startTime"
+	}
+
+	saleQuery := repository.SaleQuery{
+		Status:     query.Status,
+		ProductID:  query.ProductID,
+		Now:        time.Now(),
+		SortColumn: saleSortColumns[strings.TrimPrefix(query.Sort, "-")],
+		Descending: strings.HasPrefix(query.Sort, "-"),
+		Limit:      query.Limit + 1,
+	}
+
+	var err error
+	if saleQuery.From, err = parseQueryTime(query.From); err != nil {
+		return nil, err
+	}
+
+	if saleQuery.To, err = parseQueryTime(query.To); err != nil {
+		return nil, err
+	}
+
+	if query.Cursor != "" {
+		if saleQuery.AfterValue, saleQuery.AfterID, err = decodeCursor(query.Cursor, saleQuery.SortColumn == "discount"); err != nil {
+			return nil, err
+		}
+	}
+
+	key := ss.salePageKey(ctx, query)
+	pageCache, err := ss.redisService.Get(ctx, key)
+	if err == nil {
+		var page SalePage
+		if json.Unmarshal([]byte(pageCache), &page) == nil {
+			return &page, nil
+		}
+	}
+
+	result := ss.saleRepository.FindAllByQuery(ctx, saleQuery)
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding sales", result.Error)
+		return nil, result.Error
+	}
+
+	countResult := ss.saleRepository.CountByQuery(ctx, saleQuery)
+	if countResult.Error != nil {
+		utils.CreateLogMessage("error counting sales", countResult.Error)
+		return nil, countResult.Error
+	}
+
+	page := SalePage{Sales: result.Result, Total: countResult.Result}
+	if len(page.Sales) > query.Limit {
+		page.Sales = page.Sales[:query.Limit]
+		page.NextCursor = encodeSaleCursor(page.Sales[query.Limit-1], saleQuery.SortColumn)
+	}
+
+	if err := ss.redisService.SetWithTTL(ctx, key, page, salePageTTL); err != nil {
+		utils.CreateLogMessage("error setting sales page to redis", err)
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// salePageKey keys the cached page by the query and the sales version, so a change to any sale retires every page.
+func (ss *SalesService) salePageKey(ctx context.Context, query request.SaleQuery) string {
+	version, err := ss.redisService.Get(ctx, SalesVersionKey)
+	if err != nil {
+		version = "0"
+	}
+
+	shape := fmt.Sprintf("%s|%d|%s|%s|%s|%d|%s", query.Status, query.ProductID, query.From, query.To, query.Sort, query.Limit, query.Cursor)
+	return fmt.Sprintf(SalesPageKey, version, sha256.Sum256([]byte(shape)))
+}
+
+// encodeSaleCursor makes the opaque cursor of the page after sale, from its sort value and id.
+func encodeSaleCursor(sale entity.Sale, column string) string {
+	var value string
+	switch column {
+	case "end_time":
+		value = sale.EndTime.Format(time.RFC3339Nano)
+	case "discount":
+		value = strconv.FormatFloat(sale.Discount, 'f', -1, 64)
+	case "created_at":
+		value = sale.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		value = sale.StartTime.Format(time.RFC3339Nano)
+	}
+
+	return encodeCursor(value, sale.ID)
+}
+
+func (ss *SalesService) FindSale(ctx context.Context, id int) (*entity.Sale, error) {
+	saleCache, err := ss.redisService.Get(ctx, fmt.Sprintf(SaleKey, id))
 	if err == nil {
 		var sale entity.Sale
 		if json.Unmarshal([]byte(saleCache), &sale) == nil {
@@ -150,14 +377,14 @@ func (ss *SalesService) FindSale(id int) (*entity.Sale, error) {
 		}
 	}
 
-	result := ss.saleRepository.FindOneById(id)
+	result := ss.saleRepository.FindOneById(ctx, id)
 	if result.Error != nil {
-		utils.CreateLogMessage("error finding sale", err)
-		return nil, result.Error
+		utils.CreateLogMessage("error finding sale", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("flash sale not found. id: %d", id))
 	}
 
-	data := result.Result.(*entity.Sale)
-	if err := ss.redisService.Set(fmt.Sprintf(SaleKey, id), data); err != nil {
+	data := result.Result
+	if err := ss.redisService.Set(ctx, fmt.Sprintf(SaleKey, id), data); err != nil {
 		utils.CreateLogMessage("error setting sale to redis", err)
 		return nil, err
 	}
@@ -165,177 +392,421 @@ func (ss *SalesService) FindSale(id int) (*entity.Sale, error) {
 	return data, nil
 }
 
-func (ss *SalesService) Update(sale *entity.Sale) (*entity.Sale, error) {
-	sale.UpdatedAt = time.Now()
-	result := ss.saleRepository.Update(sale)
-	if result.Error != nil {
-		utils.CreateLogMessage("error updating sale", result.Error)
-		return nil, result.Error
+// withoutDeadline keeps the values of ctx but not its deadline or cancellation, for work that must finish once
+// started: the cache and stock upkeep after a commit and handing back what a failed purchase took.
+func withoutDeadline(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+func (ss *SalesService) InvalidateSalesCache(ctx context.Context, saleID int) error {
+	return invalidateSaleCache(ctx, ss.redisService, saleID)
+}
+
+func invalidateSaleCache(ctx context.Context, redisService RedisServiceInterface, saleID int) error {
+	// a new version retires the cached pages of every query
+	if err := redisService.Set(ctx, SalesVersionKey, time.Now().UnixNano()); err != nil {
+		utils.CreateLogMessage("error setting sales version redis key", err)
+		return err
+	}
+
+	if err := redisService.Delete(ctx, fmt.Sprintf(SaleKey, saleID)); err != nil {
+		utils.CreateLogMessage("error delete sale redis key", err)
+		return err
+	}
+
+	return nil
+}
+
+// mirrorSaleStock copies the sale stock of an active sale into the redis counter used by Buy for reservations.
+// Inactive sales have no counter, so nothing can be reserved from them.
+func (ss *SalesService) mirrorSaleStock(ctx context.Context, sale *entity.Sale) error {
+	key := fmt.Sprintf(SaleStockKey, sale.ID)
+
+	if !sale.Active {
+		if err := ss.redisService.Delete(ctx, key); err != nil {
+			utils.CreateLogMessage("error deleting sale stock redis key", err)
+			return err
+		}
+
+		return nil
+	}
+
+	if err := ss.redisService.Set(ctx, key, sale.SaleStock); err != nil {
+		utils.CreateLogMessage("error setting sale stock to redis", err)
+		return err
+	}
+
+	return nil
+}
+
+// syncSaleStock brings the redis counter of an updated sale in line with its stock. While the sale stays active the
+// counter is moved by the change the admin made, so units reserved by purchases in flight stay taken.
+func (ss *SalesService) syncSaleStock(ctx context.Context, previous *entity.Sale, sale *entity.Sale) error {
+	if !previous.Active || !sale.Active {
+		return ss.mirrorSaleStock(ctx, sale)
+	}
+
+	delta := sale.SaleStock - previous.SaleStock
+	if delta == 0 {
+		return nil
+	}
+
+	if err := ss.redisService.AdjustStock(ctx, fmt.Sprintf(SaleStockKey, sale.ID), delta); err != nil {
+		utils.CreateLogMessage("error adjusting sale stock in redis", err)
+		return err
 	}
 
-	err := ss.InvalidateSalesCache(sale.ID)
+	return nil
+}
+
+// ActivateDueSales activates the sales whose start time has come and mirrors their stock to redis.
+func (ss *SalesService) ActivateDueSales(ctx context.Context, now time.Time) ([]entity.Sale, error) {
+	var sales []entity.Sale
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		result := ss.saleRepository.ActivateDueSalesInTx(tx, now)
+		if result.Error != nil {
+			utils.CreateLogMessage("error activating sales", result.Error)
+			return result.Error
+		}
+		sales = result.Result
+
+		return writeSaleUpdatedEvents(ss.outboxRepository, tx, sales)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := ss.redisService.Set(fmt.Sprintf(SaleKey, sale.ID), sale); err != nil {
-		utils.CreateLogMessage("error updating product to redis", err)
+	ctx = withoutDeadline(ctx)
+
+	for i := range sales {
+		if err := ss.refreshSaleState(ctx, &sales[i], false); err != nil {
+			return nil, err
+		}
+	}
+
+	return sales, nil
+}
+
+// DeactivateFinishedSales deactivates the sales that ended or sold out and drops their redis stock counter.
+func (ss *SalesService) DeactivateFinishedSales(ctx context.Context, now time.Time) ([]entity.Sale, error) {
+	var sales []entity.Sale
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		result := ss.saleRepository.DeactivateFinishedSalesInTx(tx, now)
+		if result.Error != nil {
+			utils.CreateLogMessage("error deactivating sales", result.Error)
+			return result.Error
+		}
+		sales = result.Result
+
+		return writeSaleUpdatedEvents(ss.outboxRepository, tx, sales)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return sale, nil
+	ctx = withoutDeadline(ctx)
+
+	for i := range sales {
+		if err := ss.refreshSaleState(ctx, &sales[i], true); err != nil {
+			return nil, err
+		}
+	}
+
+	return sales, nil
+}
+
+// AnnounceStartingSales publishes a starting event for the sales starting within lead from now.
+// Each start time of a sale is announced once, by whichever instance claims it first.
+func (ss *SalesService) AnnounceStartingSales(ctx context.Context, now time.Time, lead time.Duration) ([]entity.Sale, error) {
+	result := ss.saleRepository.FindStartingSales(ctx, now, now.Add(lead))
+	if result.Error != nil {
+		utils.CreateLogMessage("error finding starting sales", result.Error)
+		return nil, result.Error
+	}
+
+	announced := make([]entity.Sale, 0)
+	for _, sale := range result.Result {
+		claimed, err := ss.redisService.SetNX(ctx, fmt.Sprintf(SaleStartingKey, sale.ID, sale.StartTime.Unix()), sale.StartTime, sale.StartTime.Sub(now)+lead)
+		if err != nil {
+			utils.CreateLogMessage("error claiming starting sale", err)
+			return nil, err
+		}
+		if !claimed {
+			continue
+		}
+
+		event := NewSaleEvent(&sale)
+		event.Starting = true
+		publishSaleChange(ctx, ss.redisService, event)
+		announced = append(announced, sale)
+	}
+
+	return announced, nil
 }
 
-func (ss *SalesService) InvalidateSalesCache(saleID int) error {
-	// invalidate sales redis key
-	if err := ss.redisService.Delete(SalesKey); err != nil {
-		utils.CreateLogMessage("error deleting sales redis key", err)
+func (ss *SalesService) refreshSaleState(ctx context.Context, sale *entity.Sale, wasActive bool) error {
+	if err := ss.InvalidateSalesCache(ctx, sale.ID); err != nil {
 		return err
 	}
 
-	if err := ss.redisService.Delete(fmt.Sprintf(SaleKey, saleID)); err != nil {
-		utils.CreateLogMessage("error delete sale redis key", err)
+	if err := ss.mirrorSaleStock(ctx, sale); err != nil {
 		return err
 	}
 
+	publishSaleChange(ctx, ss.redisService, newSaleChange(sale, sale.SaleStock, wasActive))
+
 	return nil
 }
 
-func (ss *SalesService) DeleteSale(id int) error {
-	_, err := ss.FindSale(id)
+func (ss *SalesService) DeleteSale(ctx context.Context, id int) error {
+	sale, err := ss.FindSale(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	result := ss.saleRepository.DeleteOneById(id)
-	if result.Error != nil {
-		utils.CreateLogMessage("error deleting sales from db", err)
-		return result.Error
+	err = ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		if err := ss.saleRepository.DeleteOneByIdInTx(tx, id); err != nil {
+			return err
+		}
+
+		return writeOutboxEvent(ss.outboxRepository, tx, entity.SaleDeleted, id, newSalePayload(sale))
+	})
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		deleteErr := &Error{Kind: KindConflict, Message: fmt.Sprintf("flash sale has orders and can't be deleted, deactivate it instead. id: %d", id), Err: err}
+		utils.CreateLogMessage(deleteErr.Error(), err)
+		return deleteErr
 	}
 
-	err = ss.InvalidateSalesCache(id)
 	if err != nil {
+		utils.CreateLogMessage("error deleting sales from db", err)
 		return err
 	}
 
-	return nil
-}
+	ctx = withoutDeadline(ctx)
 
-func (ss *SalesService) Buy(id int, wait int) (*entity.SaleLog, error) {
-	sale, product, err := ss.getSalesAndProduct(id)
+	err = ss.InvalidateSalesCache(ctx, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// check eligible for sales
-	if !sale.Active || product.Stock <= 0 || sale.SaleStock <= 0 || time.Now().After(sale.EndTime) {
-		err = errors.New("start sale failed: insufficient product stock, sale stock, or the sale period has ended")
-		utils.CreateLogMessage(err.Error(), err)
-		return nil, err
+	if err := ss.redisService.Delete(ctx, fmt.Sprintf(SaleStockKey, id)); err != nil {
+		utils.CreateLogMessage("error deleting sale stock redis key", err)
+		return err
 	}
 
-	// discounted price
-	price := product.Price * (1 - sale.Discount/100)
+	publishSaleChange(ctx, ss.redisService, SaleEvent{SaleID: id, Deleted: true, PreviousStock: sale.SaleStock, WasActive: sale.Active})
 
-	// wait for testing (checkout)
-	time.Sleep(time.Duration(wait) * time.Second)
+	return nil
+}
 
-	saleTx := ss.saleRepository.BeginTransaction()
-	productTx := ss.productService.BeginTransaction()
+func (ss *SalesService) Buy(ctx context.Context, id int, request request.BuyProductRequest) (*entity.SaleLog, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
 
-	if err := ss.buyProduct(product, sale, saleTx, productTx); err != nil {
-		saleTx.Rollback()
-		productTx.Rollback()
+	quantity := request.GetQuantity()
 
-		return nil, err
+	// a retried request returns the order created by the first one
+	idempotencyKey := orderIdempotencyKey(request)
+	if idempotencyKey != nil {
+		existing, err := ss.saleLogService.FindSaleLogByIdempotencyKey(ctx, *idempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
 	}
 
-	// create sale log (order)
-	saleLog := entity.SaleLog{
-		ProductID:             sale.ProductID,
-		RemainingSaleStock:    sale.SaleStock,
-		RemainingProductStock: product.Stock,
-		Price:                 price,
-	}
-	err = ss.saleLogService.SaveSaleLog(&saleLog)
+	sale, product, err := ss.getSalesAndProduct(ctx, id)
 	if err != nil {
-		utils.CreateLogMessage("error creating order", err)
-		saleTx.Rollback()
-		productTx.Rollback()
-
 		return nil, err
 	}
 
-	saleTx.Commit()
-	productTx.Commit()
-
-	if err := ss.redisService.Set(fmt.Sprintf(SaleKey, sale.ID), sale); err != nil {
-		utils.CreateLogMessage("error updating product to redis", err)
+	if err := checkOrder(sale, product, quantity); err != nil {
 		return nil, err
 	}
 
-	if err := ss.redisService.Set(fmt.Sprintf(ProductKey, product.ID), product); err != nil {
-		utils.CreateLogMessage("error updating product to redis", err)
+	// admission through the waiting room is used up by the purchase and handed back when it fails
+	if err := ss.admit(ctx, sale, request.AdmissionToken, request.CustomerID); err != nil {
 		return nil, err
 	}
 
-	return &saleLog, nil
+	saleLog, err := ss.placeOrder(ctx, sale, product, request, quantity, idempotencyKey)
+	if err != nil {
+		ss.releaseAdmission(ctx, sale, request.AdmissionToken)
+	}
+
+	return saleLog, err
 }
 
-func (ss *SalesService) buyProduct(product *entity.Product, sale *entity.Sale, saleTx *gorm.DB, productTx *gorm.DB) error {
-	// get cached product and sale
-	cachedProduct, err := ss.redisService.Get(fmt.Sprintf(ProductKey, product.ID))
-	if err != nil {
-		utils.CreateLogMessage("error getting product from redis ", err)
+// checkOrder checks that quantity units can be ordered from the sale right now.
+func checkOrder(sale *entity.Sale, product *entity.Product, quantity int) error {
+	if time.Now().Before(sale.StartTime) {
+		err := newError(KindSaleNotStarted, "purchase failed: the sale has not started yet")
+		utils.CreateLogMessage(err.Error(), err)
 		return err
 	}
-	cachedSale, err := ss.redisService.Get(fmt.Sprintf(SaleKey, sale.ID))
-	if err != nil {
-		utils.CreateLogMessage("error getting sale from redis ", err)
+
+	if sale.MaxPerOrder > 0 && quantity > sale.MaxPerOrder {
+		err := newError(KindLimitExceeded, fmt.Sprintf("purchase failed: at most %d units can be bought in one order", sale.MaxPerOrder))
+		utils.CreateLogMessage(err.Error(), err)
 		return err
 	}
 
-	var productTime entity.Product
-	var saleTime entity.Sale
-	if err := json.Unmarshal([]byte(cachedProduct), &productTime); err != nil {
-		utils.CreateLogMessage("json unmarshall error", err)
+	// check eligible for sales
+	if !isPurchasable(sale, product, quantity) {
+		err := unavailableError("purchase failed", sale, product, quantity)
+		utils.CreateLogMessage(err.Error(), err)
 		return err
 	}
-	if err := json.Unmarshal([]byte(cachedSale), &saleTime); err != nil {
-		utils.CreateLogMessage("json unmarshall error", err)
-		return err
+
+	return nil
+}
+
+func (ss *SalesService) admit(ctx context.Context, sale *entity.Sale, token string, customerID string) error {
+	if !sale.WaitingRoom {
+		return nil
 	}
 
-	if !product.UpdatedAt.Equal(productTime.UpdatedAt) {
-		product, err = ss.productService.GetProduct(sale.ProductID)
+	return ss.waitingRoom.Admit(ctx, sale, token, customerID, time.Now())
+}
+
+func (ss *SalesService) releaseAdmission(ctx context.Context, sale *entity.Sale, token string) {
+	if sale.WaitingRoom {
+		ss.waitingRoom.Release(withoutDeadline(ctx), sale, token)
+	}
+}
+
+// placeOrder reserves the units in redis and writes the order, stock changes and the customer counter in one transaction.
+func (ss *SalesService) placeOrder(ctx context.Context, sale *entity.Sale, product *entity.Product, request request.BuyProductRequest, quantity int, idempotencyKey *string) (*entity.SaleLog, error) {
+	// only requests holding a reservation reach the database
+	if err := ss.takeSaleStock(ctx, sale.ID, quantity); err != nil {
+		return nil, err
+	}
+
+	// product stock, sale stock and the sale log (order) are written in one transaction
+	var saleLog entity.SaleLog
+	var updatedSale *entity.Sale
+	err := ss.unitOfWork.Execute(ctx, func(tx *gorm.DB) error {
+		lockedSale, lockedProduct, err := ss.buyProduct(tx, sale.ID, sale.ProductID, quantity)
 		if err != nil {
 			return err
 		}
-	}
+		updatedSale = lockedSale
 
-	if !sale.UpdatedAt.Equal(saleTime.UpdatedAt) {
-		sale, err = ss.FindSale(sale.ID)
-		if err != nil {
+		// the sale row is locked, so the limit check sees every committed purchase of this customer
+		purchase := entity.CustomerPurchase{SaleID: lockedSale.ID, CustomerID: request.CustomerID, Quantity: quantity}
+		if result := ss.saleRepository.IncreaseCustomerPurchaseInTx(tx, &purchase, lockedSale.MaxPerCustomer); result.Error != nil {
+			utils.CreateLogMessage("purchase failed", result.Error)
+			return result.Error
+		}
+
+		// create sale log (order)
+		saleLog = newOrder(lockedSale, lockedProduct, request.CustomerID, quantity)
+		saleLog.IdempotencyKey = idempotencyKey
+		if err := ss.saleLogService.saveSaleLogInTx(tx, &saleLog); err != nil {
+			utils.CreateLogMessage("error creating order", err)
 			return err
 		}
+
+		return writePurchaseEvents(ss.outboxRepository, tx, lockedSale, &saleLog)
+	})
+	if err != nil {
+		// the database did not take the units, give the reservation back
+		ss.releaseSaleStock(ctx, sale.ID, quantity)
+
+		// a concurrent retry committed the order first
+		if idempotencyKey != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ss.saleLogService.FindSaleLogByIdempotencyKey(ctx, *idempotencyKey)
+		}
+
+		return nil, err
 	}
 
-	if sale.Active && product.Stock > 0 && sale.SaleStock > 0 && time.Now().Before(sale.EndTime) {
-		product.Stock--
-		sale.SaleStock--
+	ctx = withoutDeadline(ctx)
 
-		err = ss.productService.updateProductWithLock(productTx, product)
-		if err != nil {
-			return err
+	if err := ss.InvalidateSalesCache(ctx, sale.ID); err != nil {
+		return nil, err
+	}
+
+	if err := ss.productService.InvalidateProductCache(ctx, product.ID); err != nil {
+		return nil, err
+	}
+
+	publishSaleChange(ctx, ss.redisService, newSaleChange(updatedSale, updatedSale.SaleStock+quantity, updatedSale.Active))
+
+	return &saleLog, nil
+}
+
+// newOrder builds the sale log (order) of quantity units at the discounted price, from the stocks left after it.
+// The sale's discount and the product's price are copied, so the order keeps them when the sale or product changes.
+func newOrder(sale *entity.Sale, product *entity.Product, customerID string, quantity int) entity.SaleLog {
+	// discounted price
+	price := product.Price * (1 - sale.Discount/100)
+	saleID := sale.ID
+
+	return entity.SaleLog{
+		SaleID:                &saleID,
+		ProductID:             sale.ProductID,
+		CustomerID:            customerID,
+		RemainingSaleStock:    sale.SaleStock,
+		RemainingProductStock: product.Stock,
+		Quantity:              quantity,
+		OriginalPrice:         product.Price,
+		Discount:              sale.Discount,
+		Price:                 price,
+		TotalPrice:            price * float64(quantity),
+		Status:                entity.OrderPlaced,
+	}
+}
+
+// orderIdempotencyKey scopes the client's idempotency key to the customer, nil when the client sent none.
+func orderIdempotencyKey(request request.BuyProductRequest) *string {
+	if request.IdempotencyKey == "" {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%s", request.CustomerID, request.IdempotencyKey)
+	return &key
+}
+
+// reserveSaleStock atomically takes quantity units from the redis stock counter of the sale.
+// A missing counter is seeded from the database first.
+func (ss *SalesService) reserveSaleStock(ctx context.Context, saleID int, quantity int) (bool, error) {
+	key := fmt.Sprintf(SaleStockKey, saleID)
+
+	reserved, err := ss.redisService.ReserveStock(ctx, key, quantity)
+	if errors.Is(err, ErrStockNotMirrored) {
+		result := ss.saleRepository.FindOneById(ctx, saleID)
+		if result.Error != nil {
+			utils.CreateLogMessage("error finding sale", result.Error)
+			return false, result.Error
 		}
 
-		err = ss.updateSaleWithLock(saleTx, sale)
-		if err != nil {
-			return err
+		if err := ss.redisService.InitStock(ctx, key, result.Result.SaleStock); err != nil {
+			utils.CreateLogMessage("error setting sale stock to redis", err)
+			return false, err
 		}
 
-	} else {
-		err = errors.New("purchase failed: insufficient product stock, sale stock, or the sale period has ended")
+		reserved, err = ss.redisService.ReserveStock(ctx, key, quantity)
+	}
+
+	if err != nil {
+		utils.CreateLogMessage("error reserving sale stock", err)
+		return false, err
+	}
+
+	return reserved, nil
+}
+
+// takeSaleStock reserves quantity units in redis and fails when the sale is sold out.
+func (ss *SalesService) takeSaleStock(ctx context.Context, saleID int, quantity int) error {
+	reserved, err := ss.reserveSaleStock(ctx, saleID, quantity)
+	if err != nil {
+		return err
+	}
+
+	if !reserved {
+		err = newError(KindSoldOut, "purchase failed: sale is sold out")
 		utils.CreateLogMessage(err.Error(), err)
 		return err
 	}
@@ -343,27 +814,81 @@ func (ss *SalesService) buyProduct(product *entity.Product, sale *entity.Sale, s
 	return nil
 }
 
-func (ss *SalesService) getSalesAndProduct(id int) (*entity.Sale, *entity.Product, error) {
-	sale, err := ss.FindSale(id)
+// releaseSaleStock hands reserved units back to the redis counter, also when ctx is already done.
+func (ss *SalesService) releaseSaleStock(ctx context.Context, saleID int, quantity int) {
+	if err := ss.redisService.ReleaseStock(withoutDeadline(ctx), fmt.Sprintf(SaleStockKey, saleID), quantity); err != nil {
+		utils.CreateLogMessage("error releasing sale stock", err)
+	}
+}
+
+// buyProduct locks the sale and then the product row, re-checks them and decrements both stocks by quantity.
+// The lock order is the same for every buyer, so concurrent purchases queue up instead of deadlocking.
+func (ss *SalesService) buyProduct(tx *gorm.DB, saleID int, productID int, quantity int) (*entity.Sale, *entity.Product, error) {
+	result := ss.saleRepository.FindOneByIdForUpdate(tx, saleID)
+	if result.Error != nil {
+		utils.CreateLogMessage("error locking sale", result.Error)
+		return nil, nil, result.Error
+	}
+	sale := result.Result
+
+	product, err := ss.productService.lockProduct(tx, productID)
 	if err != nil {
 		return nil, nil, err
 	}
-	product, err := ss.productService.GetProduct(sale.ProductID)
-	if err != nil {
+
+	if !isPurchasable(sale, product, quantity) {
+		err = unavailableError("purchase failed", sale, product, quantity)
+		utils.CreateLogMessage(err.Error(), err)
 		return nil, nil, err
 	}
+
+	product.Stock -= quantity
+	sale.SaleStock -= quantity
+
+	if err := ss.productService.updateProductInTx(tx, product); err != nil {
+		return nil, nil, err
+	}
+
+	sale.UpdatedAt = time.Now()
+	if result := ss.saleRepository.UpdateInTx(tx, sale); result.Error != nil {
+		utils.CreateLogMessage("error updating sale", result.Error)
+		return nil, nil, result.Error
+	}
+
 	return sale, product, nil
 }
 
-func (ss *SalesService) updateSaleWithLock(tx *gorm.DB, sale *entity.Sale) error {
-	if err := ss.saleRepository.LockAndUpdateSale(tx, sale); err.Error != nil {
-		return err.Error
-	}
+func isPurchasable(sale *entity.Sale, product *entity.Product, quantity int) bool {
+	now := time.Now()
+	return sale.Active && product.Stock >= quantity && sale.SaleStock >= quantity &&
+		!now.Before(sale.StartTime) && now.Before(sale.EndTime)
+}
 
-	err := ss.InvalidateSalesCache(sale.ID)
+// unavailableError tells why quantity units of the sale can't be ordered, for a sale isPurchasable rejected.
+func unavailableError(action string, sale *entity.Sale, product *entity.Product, quantity int) error {
+	now := time.Now()
+	switch {
+	case now.Before(sale.StartTime):
+		return newError(KindSaleNotStarted, fmt.Sprintf("%s: the sale has not started yet", action))
+	case !now.Before(sale.EndTime):
+		return newError(KindSaleEnded, fmt.Sprintf("%s: the sale period has ended", action))
+	case !sale.Active:
+		return newError(KindSaleInactive, fmt.Sprintf("%s: the sale is not active", action))
+	case sale.SaleStock <= 0:
+		return newError(KindSoldOut, fmt.Sprintf("%s: sale is sold out", action))
+	}
+
+	return newError(KindSoldOut, fmt.Sprintf("%s: insufficient product stock or sale stock for %d units", action, quantity))
+}
+
+func (ss *SalesService) getSalesAndProduct(ctx context.Context, id int) (*entity.Sale, *entity.Product, error) {
+	sale, err := ss.FindSale(ctx, id)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	return nil
+	product, err := ss.productService.GetProduct(ctx, sale.ProductID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sale, product, nil
 }
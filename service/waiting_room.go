@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/queue"
+	"flash_sale_management/utils"
+	"time"
+)
+
+// WaitingRoom admits the queued customers of a sale in join order, at most Sale.AdmissionRate tickets in every second
+// from the sale start. The admission progress is kept in the store, so every instance agrees on it.
+type WaitingRoom struct {
+	store queue.Store
+}
+
+func NewWaitingRoom(store queue.Store) WaitingRoom {
+	return WaitingRoom{store: store}
+}
+
+// Join issues a ticket to the customer, only that customer can buy with it.
+func (w *WaitingRoom) Join(ctx context.Context, sale *entity.Sale, customerID string, now time.Time) (*queue.Status, error) {
+	if !sale.WaitingRoom {
+		err := newError(KindConflict, "sale has no waiting room")
+		utils.CreateLogMessage(err.Error(), err)
+		return nil, err
+	}
+
+	if !now.Before(sale.EndTime) {
+		err := newError(KindSaleEnded, "sale period has ended")
+		utils.CreateLogMessage(err.Error(), err)
+		return nil, err
+	}
+
+	ticket, err := w.store.Join(ctx, sale.ID, customerID)
+	if err != nil {
+		utils.CreateLogMessage("error joining waiting room", err)
+		return nil, err
+	}
+
+	return w.status(ctx, sale, ticket, now)
+}
+
+func (w *WaitingRoom) Status(ctx context.Context, sale *entity.Sale, token string, now time.Time) (*queue.Status, error) {
+	ticket, err := w.store.Find(ctx, sale.ID, token)
+	if err != nil {
+		utils.CreateLogMessage("error finding queue ticket", err)
+		return nil, err
+	}
+
+	return w.status(ctx, sale, ticket, now)
+}
+
+// Admit checks that the customer's admission token is admitted and uses it up, so one admission buys once.
+func (w *WaitingRoom) Admit(ctx context.Context, sale *entity.Sale, token string, customerID string, now time.Time) error {
+	if token == "" {
+		err := newError(KindAdmissionDenied, "admission token is required for this sale")
+		utils.CreateLogMessage(err.Error(), err)
+		return err
+	}
+
+	ticket, err := w.store.Find(ctx, sale.ID, token)
+	if err != nil {
+		utils.CreateLogMessage("invalid admission token", err)
+		return err
+	}
+
+	// a shared or resold token doesn't let another customer skip the queue
+	if ticket.CustomerID != customerID {
+		err = newError(KindAdmissionDenied, "admission token was issued to another customer")
+		utils.CreateLogMessage(err.Error(), err)
+		return err
+	}
+
+	status, err := w.status(ctx, sale, ticket, now)
+	if err != nil {
+		return err
+	}
+
+	if !status.Admitted {
+		err = newError(KindAdmissionDenied, "admission token is not admitted yet")
+		utils.CreateLogMessage(err.Error(), err)
+		return err
+	}
+
+	consumed, err := w.store.Consume(ctx, sale.ID, token)
+	if err != nil {
+		utils.CreateLogMessage("error consuming admission token", err)
+		return err
+	}
+
+	if !consumed {
+		err = newError(KindAdmissionDenied, "admission token is already used")
+		utils.CreateLogMessage(err.Error(), err)
+		return err
+	}
+
+	return nil
+}
+
+func (w *WaitingRoom) Release(ctx context.Context, sale *entity.Sale, token string) {
+	if err := w.store.Release(ctx, sale.ID, token); err != nil {
+		utils.CreateLogMessage("error releasing admission token", err)
+	}
+}
+
+// status advances the admission of the sale to now and returns the ticket's place in it.
+func (w *WaitingRoom) status(ctx context.Context, sale *entity.Sale, ticket *queue.Ticket, now time.Time) (*queue.Status, error) {
+	second := int64(-1)
+	if !now.Before(sale.StartTime) {
+		second = int64(now.Sub(sale.StartTime) / time.Second)
+	}
+
+	admitted, err := w.store.Advance(ctx, sale.ID, sale.AdmissionRate, second)
+	if err != nil {
+		utils.CreateLogMessage("error advancing waiting room", err)
+		return nil, err
+	}
+
+	position := ticket.Sequence - admitted
+	if position <= 0 {
+		return &queue.Status{Token: ticket.Token, Admitted: true}, nil
+	}
+
+	// the batch of the current second is taken, the next one is admitted at the start or at the next full second
+	wait := time.Duration(0)
+	if sale.AdmissionRate > 0 {
+		batches := (position + int64(sale.AdmissionRate) - 1) / int64(sale.AdmissionRate)
+		next := sale.StartTime.Add(time.Duration(second+1) * time.Second)
+		wait = next.Sub(now) + time.Duration(batches-1)*time.Second
+	}
+
+	return &queue.Status{Token: ticket.Token, Position: position, EstimatedWait: wait}, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"fmt"
+	"github.com/gofiber/fiber/v2/log"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a webhook delivery. The signature is "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the subscription secret, see SignWebhook.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// webhookLease hides claimed deliveries from other dispatchers while they are sent.
+	webhookLease = time.Minute
+	// webhookRetryDelay is the wait after the first failed attempt, it doubles with every further attempt.
+	webhookRetryDelay = 10 * time.Second
+	// webhookMaxRetryDelay caps the wait between attempts.
+	webhookMaxRetryDelay = time.Hour
+)
+
+// WebhookDispatcher sends the pending webhook deliveries and retries the failed ones with exponential backoff
+// until maxAttempts, then the delivery is failed and only sent again on a manual redelivery. Any 2xx response
+// counts as delivered. Deliveries are claimed in the database, so the dispatcher can run on every instance.
+type WebhookDispatcher struct {
+	webhookRepository repository.WebhookRepositoryInterface
+	client            *http.Client
+	interval          time.Duration
+	batchSize         int
+	maxAttempts       int
+}
+
+func NewWebhookDispatcher(webhookRepository repository.WebhookRepositoryInterface, client *http.Client, interval time.Duration, batchSize int, maxAttempts int) *WebhookDispatcher {
+	return &WebhookDispatcher{webhookRepository: webhookRepository, client: client, interval: interval, batchSize: batchSize, maxAttempts: maxAttempts}
+}
+
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.Run(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run sends the due deliveries, batch by batch until none are left.
+func (d *WebhookDispatcher) Run(ctx context.Context, now time.Time) {
+	for {
+		result := d.webhookRepository.ClaimDueDeliveries(ctx, now, webhookLease, d.batchSize)
+		if result.Error != nil {
+			log.Errorf("webhook dispatcher claim failed: %v", result.Error)
+			return
+		}
+
+		claimed := result.Result
+		subscriptions := make(map[int]*entity.WebhookSubscription)
+		for i := range claimed {
+			d.deliver(ctx, &claimed[i], subscriptions, now)
+		}
+
+		if len(claimed) < d.batchSize {
+			return
+		}
+	}
+}
+
+// deliver sends the delivery once and records the outcome. Subscriptions are cached for the batch.
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *entity.WebhookDelivery, subscriptions map[int]*entity.WebhookSubscription, now time.Time) {
+	subscription, ok := subscriptions[delivery.SubscriptionID]
+	if !ok {
+		result := d.webhookRepository.FindOneById(ctx, delivery.SubscriptionID)
+		if result.Error != nil {
+			// the lease runs out and the delivery is claimed again
+			log.Errorf("webhook subscription %d of delivery %d couldn't be loaded: %v", delivery.SubscriptionID, delivery.ID, result.Error)
+			return
+		}
+		subscription = result.Result
+		subscriptions[subscription.ID] = subscription
+	}
+
+	status, err := d.send(ctx, subscription, delivery, now)
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		delivery.Status = entity.WebhookDeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= d.maxAttempts:
+		log.Errorf("webhook delivery %d to %s gave up after %d attempts: %v", delivery.ID, subscription.URL, delivery.Attempts, err)
+		delivery.Status = entity.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		log.Warnf("webhook delivery %d to %s failed, attempt %d: %v", delivery.ID, subscription.URL, delivery.Attempts, err)
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(retryAfter(delivery.Attempts, webhookRetryDelay, webhookMaxRetryDelay))
+	}
+
+	// a failed update only means the delivery is sent again after the lease
+	if result := d.webhookRepository.UpdateDelivery(ctx, delivery); result.Error != nil {
+		log.Errorf("webhook delivery %d couldn't be updated: %v", delivery.ID, result.Error)
+	}
+}
+
+// send posts the signed body to the subscription and returns the response status, 0 when there was no response.
+func (d *WebhookDispatcher) send(ctx context.Context, subscription *entity.WebhookSubscription, delivery *entity.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, strings.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(subscription.Secret, timestamp, []byte(delivery.Body)))
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(delivery.ID))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, errors.New(fmt.Sprintf("unexpected response status %d", res.StatusCode))
+	}
+
+	return res.StatusCode, nil
+}
+
+// SignWebhook returns the signature header value of a delivery body sent at timestamp. Receivers compute the
+// same value with their secret and reject the requests it doesn't match, or that have an old timestamp.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
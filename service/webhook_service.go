@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"flash_sale_management/dto/request"
+	"flash_sale_management/entity"
+	"flash_sale_management/events"
+	"flash_sale_management/repository"
+	"flash_sale_management/utils"
+	"fmt"
+	"time"
+)
+
+const defaultDeliveryPageSize = 50
+
+// WebhookService manages the webhook subscriptions. As a publisher of the outbox relay it turns every
+// event into a pending delivery for each subscription of its type, the WebhookDispatcher sends them.
+type WebhookService struct {
+	webhookRepository repository.WebhookRepositoryInterface
+}
+
+func NewWebhookService(webhookRepository repository.WebhookRepositoryInterface) WebhookService {
+	return WebhookService{webhookRepository: webhookRepository}
+}
+
+func (ws *WebhookService) CreateSubscription(ctx context.Context, request request.CreateWebhookRequest) (*entity.WebhookSubscription, error) {
+	if err := request.Validate(); err != nil {
+		utils.CreateLogMessage("body validation error", err)
+		return nil, validationError(err)
+	}
+
+	subscription := (&entity.WebhookSubscription{}).FromDto(request)
+	result := ws.webhookRepository.Save(ctx, subscription)
+	if result.Error != nil {
+		utils.CreateLogMessage("error creating webhook subscription", result.Error)
+		return nil, result.Error
+	}
+
+	return subscription, nil
+}
+
+func (ws *WebhookService) FindSubscriptions(ctx context.Context) (*[]entity.WebhookSubscription, error) {
+	result := ws.webhookRepository.FindAll(ctx)
+	if result.Error != nil {
+		utils.CreateLogMessage("error getting webhook subscriptions", result.Error)
+		return nil, result.Error
+	}
+
+	return &result.Result, nil
+}
+
+func (ws *WebhookService) FindSubscription(ctx context.Context, id int) (*entity.WebhookSubscription, error) {
+	result := ws.webhookRepository.FindOneById(ctx, id)
+	if result.Error != nil {
+		utils.CreateLogMessage("error getting webhook subscription", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("webhook subscription not found. id: %d", id))
+	}
+
+	return result.Result, nil
+}
+
+func (ws *WebhookService) DeleteSubscription(ctx context.Context, id int) error {
+	if _, err := ws.FindSubscription(ctx, id); err != nil {
+		return err
+	}
+
+	if err := ws.webhookRepository.DeleteOneById(ctx, id); err != nil {
+		utils.CreateLogMessage("error deleting webhook subscription", err)
+		return err
+	}
+
+	return nil
+}
+
+// FindDeliveries returns the latest deliveries of the subscription, newest first.
+func (ws *WebhookService) FindDeliveries(ctx context.Context, subscriptionID int) (*[]entity.WebhookDelivery, error) {
+	if _, err := ws.FindSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	result := ws.webhookRepository.FindDeliveriesBySubscription(ctx, subscriptionID, defaultDeliveryPageSize)
+	if result.Error != nil {
+		utils.CreateLogMessage("error getting webhook deliveries", result.Error)
+		return nil, result.Error
+	}
+
+	return &result.Result, nil
+}
+
+// Redeliver queues the delivery to be sent again right away with a fresh set of attempts,
+// whether it was delivered, failed or is still being retried.
+func (ws *WebhookService) Redeliver(ctx context.Context, subscriptionID int, deliveryID int) (*entity.WebhookDelivery, error) {
+	result := ws.webhookRepository.FindDeliveryById(ctx, deliveryID)
+	if result.Error != nil {
+		utils.CreateLogMessage("error getting webhook delivery", result.Error)
+		return nil, notFoundError(result.Error, fmt.Sprintf("webhook delivery not found. id: %d", deliveryID))
+	}
+
+	delivery := result.Result
+	if delivery.SubscriptionID != subscriptionID {
+		err := newError(KindNotFound, fmt.Sprintf("webhook delivery not found. id: %d", deliveryID))
+		utils.CreateLogMessage(err.Error(), err)
+		return nil, err
+	}
+
+	delivery.Status = entity.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.DeliveredAt = nil
+	if result := ws.webhookRepository.UpdateDelivery(ctx, delivery); result.Error != nil {
+		utils.CreateLogMessage("error updating webhook delivery", result.Error)
+		return nil, result.Error
+	}
+
+	return delivery, nil
+}
+
+// Publish creates a pending delivery of the message for every subscription of its type. The deliveries of a
+// message published again are created only once, so a failure can be retried by the outbox relay.
+func (ws *WebhookService) Publish(ctx context.Context, message events.Message) error {
+	subscriptions, err := ws.FindSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		utils.CreateLogMessage("error encoding webhook body", err)
+		return err
+	}
+
+	deliveries := make([]entity.WebhookDelivery, 0)
+	for _, subscription := range *subscriptions {
+		if !subscription.Subscribes(message.Type) {
+			continue
+		}
+
+		deliveries = append(deliveries, entity.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        message.ID,
+			EventType:      message.Type,
+			Body:           string(body),
+			Status:         entity.WebhookDeliveryPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+
+	if result := ws.webhookRepository.SaveDeliveries(ctx, deliveries); result.Error != nil {
+		utils.CreateLogMessage("error creating webhook deliveries", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
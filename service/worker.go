@@ -0,0 +1,8 @@
+package service
+
+import "context"
+
+// Worker is a background job started next to the http server, it runs until ctx is cancelled.
+type Worker interface {
+	Start(ctx context.Context)
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"flash_sale_management/auth"
+	"flash_sale_management/controller"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/entity"
+	"flash_sale_management/middleware"
+	"flash_sale_management/queue"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// customerVerifier accepts any bearer token as customer-1.
+type customerVerifier struct{}
+
+func (customerVerifier) Verify(string) (*auth.Principal, error) {
+	return &auth.Principal{Subject: "customer-1", Role: auth.RoleCustomer}, nil
+}
+
+func Test_BuyProduct_when_noBody_expect_singleUnitOrdered(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	product := entity.Product{ID: 2, Name: "Test product", Price: 10, Stock: 5}
+	sale := entity.Sale{ID: 1, ProductID: product.ID, SaleStock: 5, Active: true, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now().Add(time.Hour)}
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(false, nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	salesService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+	salesController := controller.New(salesService, service.SaleStatsService{}, nil)
+
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Post("/flash-sales/:id/buy", middleware.Authenticate(customerVerifier{}, nil), salesController.BuyProduct)
+
+	req := httptest.NewRequest(http.MethodPost, "/flash-sales/1/buy", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer token")
+	res, err := app.Test(req)
+	assert.Nil(t, err)
+
+	var problem response.ProblemResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	assert.Equal(t, service.KindSoldOut, problem.Code)
+	redisService.AssertExpectations(t)
+}
+
+func Test_GetFlashSale_when_saleFound_expect_saleIdReturned(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := entity.Sale{ID: 7, ProductID: 2, SaleStock: 5, Active: true, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now().Add(time.Hour)}
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("Set", mock.Anything, mock.Anything).Return(nil)
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+
+	productService := service.NewProductService(new(mocks.ProductRepository), redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	salesService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+	salesController := controller.New(salesService, service.SaleStatsService{}, nil)
+
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Get("/flash-sales/:id", salesController.GetFlashSale)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/flash-sales/7", nil))
+	assert.Nil(t, err)
+
+	var saleResponse response.SaleResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&saleResponse))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, sale.ID, saleResponse.ID)
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/events"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type brokenPublisher struct{}
+
+func (brokenPublisher) Publish(context.Context, events.Message) error {
+	return errors.New("receiver down")
+}
+
+func Test_when_onePublisherFails_expect_othersStillPublishedAndError(t *testing.T) {
+	first := events.NewMemoryPublisher()
+	second := events.NewMemoryPublisher()
+
+	err := events.NewMultiPublisher(first, brokenPublisher{}, second).Publish(context.Background(), events.Message{ID: 1})
+
+	assert.EqualError(t, err, "receiver down")
+	assert.Len(t, first.Messages(), 1)
+	assert.Len(t, second.Messages(), 1)
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"flash_sale_management/events"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_when_published_expect_messageAppendedToStream(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	publisher := events.NewRedisStreamPublisher(client, "SALE_EVENTS_STREAM", 0)
+
+	occurredAt := time.Date(2024, 9, 18, 5, 23, 5, 0, time.UTC)
+	err := publisher.Publish(context.Background(), events.Message{
+		ID:         7,
+		Type:       "SalePurchased",
+		SaleID:     2,
+		Payload:    json.RawMessage(`{"orderId":1}`),
+		OccurredAt: occurredAt,
+	})
+	assert.NoError(t, err)
+
+	entries, err := client.XRange(context.Background(), "SALE_EVENTS_STREAM", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "7", entries[0].Values["id"])
+	assert.Equal(t, "SalePurchased", entries[0].Values["type"])
+	assert.Equal(t, "2", entries[0].Values["saleId"])
+	assert.Equal(t, `{"orderId":1}`, entries[0].Values["payload"])
+	assert.Equal(t, occurredAt.Format(time.RFC3339Nano), entries[0].Values["occurredAt"])
+}
+
+func Test_when_memoryPublisher_expect_messagesKeptInOrder(t *testing.T) {
+	publisher := events.NewMemoryPublisher()
+
+	assert.NoError(t, publisher.Publish(context.Background(), events.Message{ID: 1}))
+	assert.NoError(t, publisher.Publish(context.Background(), events.Message{ID: 2}))
+
+	messages := publisher.Messages()
+	assert.Equal(t, 1, messages[0].ID)
+	assert.Equal(t, 2, messages[1].ID)
+}
@@ -0,0 +1,131 @@
+package hub
+
+import (
+	"flash_sale_management/controller"
+	"flash_sale_management/hub"
+	fasthttpws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_when_eventPublished_expect_onlySubscribersOfSaleReceiveIt(t *testing.T) {
+	saleHub := hub.NewHub(4)
+	subscriber := saleHub.Register()
+	other := saleHub.Register()
+	saleHub.Subscribe(subscriber, 1)
+	saleHub.Subscribe(other, 2)
+
+	saleHub.Publish(hub.Event{Type: hub.SaleStarted, SaleID: 1})
+
+	assert.Equal(t, hub.SaleStarted, (<-subscriber.Events()).Type)
+	assert.Len(t, other.Events(), 0)
+}
+
+func Test_when_unsubscribed_expect_noEvent(t *testing.T) {
+	saleHub := hub.NewHub(4)
+	client := saleHub.Register()
+	saleHub.Subscribe(client, 1)
+	saleHub.Subscribe(client, 2)
+	saleHub.Unsubscribe(client, 1)
+
+	saleHub.Publish(hub.Event{Type: hub.SaleStarted, SaleID: 1})
+	saleHub.Publish(hub.Event{Type: hub.SaleSoldOut, SaleID: 2})
+
+	assert.Equal(t, hub.SaleSoldOut, (<-client.Events()).Type)
+	assert.Len(t, client.Events(), 0)
+}
+
+func Test_when_slowClient_expect_droppedWithoutBlockingOthers(t *testing.T) {
+	saleHub := hub.NewHub(1)
+	slow := saleHub.Register()
+	fast := saleHub.Register()
+	saleHub.Subscribe(slow, 1)
+	saleHub.Subscribe(fast, 1)
+
+	saleHub.Publish(hub.Event{Type: hub.SaleLowStock, SaleID: 1})
+	assert.Equal(t, hub.SaleLowStock, (<-fast.Events()).Type)
+	saleHub.Publish(hub.Event{Type: hub.SaleSoldOut, SaleID: 1})
+	assert.Equal(t, hub.SaleSoldOut, (<-fast.Events()).Type)
+
+	// the buffered event is still delivered before the channel is closed
+	assert.Equal(t, hub.SaleLowStock, (<-slow.Events()).Type)
+	_, ok := <-slow.Events()
+	assert.False(t, ok)
+	assert.True(t, slow.Dropped())
+	assert.False(t, fast.Dropped())
+}
+
+func Test_when_unregistered_expect_eventsClosedAndSubscribeIgnored(t *testing.T) {
+	saleHub := hub.NewHub(1)
+	client := saleHub.Register()
+	saleHub.Subscribe(client, 1)
+
+	saleHub.Unregister(client)
+	saleHub.Unregister(client)
+	saleHub.Subscribe(client, 1)
+	saleHub.Publish(hub.Event{Type: hub.SaleEnded, SaleID: 1})
+
+	_, ok := <-client.Events()
+	assert.False(t, ok)
+	assert.False(t, client.Dropped())
+}
+
+func Test_when_websocketClientSubscribes_expect_saleEvents(t *testing.T) {
+	saleHub := hub.NewHub(4)
+	notificationController := controller.NewNotificationController(saleHub)
+
+	app := fiber.New()
+	app.Get("/notifications", notificationController.RequireWebsocket, websocket.New(notificationController.Notifications))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() { _ = app.Listener(listener) }()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := fasthttpws.DefaultDialer.Dial("ws://"+listener.Addr().String()+"/notifications", nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.NoError(t, conn.WriteJSON(map[string]interface{}{"action": "subscribe", "saleIds": []int{1, 2}}))
+
+	// the subscription is handled in the background, publish until it arrives
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				saleHub.Publish(hub.Event{Type: hub.SaleStarted, SaleID: 2, SaleStock: 10})
+			}
+		}
+	}()
+
+	var event hub.Event
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	assert.NoError(t, conn.ReadJSON(&event))
+
+	assert.Equal(t, hub.SaleStarted, event.Type)
+	assert.Equal(t, 2, event.SaleID)
+	assert.Equal(t, 10, event.SaleStock)
+}
+
+func Test_when_notWebsocketRequest_expect_upgradeRequired(t *testing.T) {
+	notificationController := controller.NewNotificationController(hub.NewHub(1))
+
+	app := fiber.New()
+	app.Get("/notifications", notificationController.RequireWebsocket, websocket.New(notificationController.Notifications))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/notifications", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusUpgradeRequired, resp.StatusCode)
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flash_sale_management/auth"
+	"flash_sale_management/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const jwtSecret = "test-secret-that-is-long-enough-for-hs256"
+
+var hs256Config = auth.JWTConfig{Algorithm: "HS256", Secret: jwtSecret, Issuer: "flash-sale-management", Audience: "flash-sale-api"}
+
+func claims(subject string, role string, expiresIn time.Duration) auth.Claims {
+	return auth.Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    "flash-sale-management",
+			Audience:  jwt.ClaimStrings{"flash-sale-api"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+}
+
+func signHS256(t *testing.T, claims auth.Claims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+// newAuthApp serves the subject of the caller on an admin route and on a route for any role.
+func newAuthApp(t *testing.T, config auth.JWTConfig) *fiber.App {
+	verifier, err := auth.NewJWTVerifier(config)
+	if err != nil {
+		t.Fatalf("creating verifier: %v", err)
+	}
+
+	subject := func(c *fiber.Ctx) error {
+		return c.SendString(middleware.Principal(c).Subject)
+	}
+
+	app := fiber.New()
+	app.Delete("/flash-sales/:id", middleware.Authenticate(verifier, nil), middleware.RequireRole(auth.RoleAdmin), subject)
+	app.Get("/orders", middleware.Authenticate(verifier, nil), subject)
+
+	return app
+}
+
+func request(method string, path string, token string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	return req
+}
+
+func Test_when_validToken_expect_subjectAvailableToHandler(t *testing.T) {
+	app := newAuthApp(t, hs256Config)
+
+	res, err := app.Test(request(http.MethodGet, "/orders", signHS256(t, claims("customer-1", auth.RoleCustomer, time.Hour))))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "customer-1", string(body))
+}
+
+func Test_when_tokenMissingOrInvalid_expect_unauthorized(t *testing.T) {
+	app := newAuthApp(t, hs256Config)
+
+	wrongSecret, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims("customer-1", auth.RoleCustomer, time.Hour)).
+		SignedString([]byte("another-secret-that-is-long-enough-too"))
+	wrongAudience := claims("customer-1", auth.RoleCustomer, time.Hour)
+	wrongAudience.Audience = jwt.ClaimStrings{"other-api"}
+
+	tokens := map[string]string{
+		"missing":        "",
+		"malformed":      "not-a-jwt",
+		"expired":        signHS256(t, claims("customer-1", auth.RoleCustomer, -time.Hour)),
+		"wrong secret":   wrongSecret,
+		"wrong audience": signHS256(t, wrongAudience),
+		"unknown role":   signHS256(t, claims("customer-1", "superuser", time.Hour)),
+		"no subject":     signHS256(t, claims("", auth.RoleCustomer, time.Hour)),
+	}
+
+	for name, token := range tokens {
+		res, err := app.Test(request(http.MethodGet, "/orders", token))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, name)
+		assert.Equal(t, "Bearer", res.Header.Get(fiber.HeaderWWWAuthenticate), name)
+	}
+}
+
+func Test_when_customerCallsAdminRoute_expect_forbidden(t *testing.T) {
+	app := newAuthApp(t, hs256Config)
+
+	customer, err := app.Test(request(http.MethodDelete, "/flash-sales/1", signHS256(t, claims("customer-1", auth.RoleCustomer, time.Hour))))
+	assert.Nil(t, err)
+	admin, err := app.Test(request(http.MethodDelete, "/flash-sales/1", signHS256(t, claims("admin-1", auth.RoleAdmin, time.Hour))))
+	assert.Nil(t, err)
+
+	assert.Equal(t, http.StatusForbidden, customer.StatusCode)
+	assert.Equal(t, http.StatusOK, admin.StatusCode)
+}
+
+func Test_when_rs256Configured_expect_onlyTokensOfPrivateKeyAccepted(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("encoding key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	app := newAuthApp(t, auth.JWTConfig{Algorithm: "RS256", PublicKey: publicPEM})
+
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, claims("admin-1", auth.RoleAdmin, time.Hour)).SignedString(privateKey)
+	// the public key is known to everyone, it must not work as an HS256 secret
+	confused, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims("admin-1", auth.RoleAdmin, time.Hour)).SignedString(publicPEM)
+
+	accepted, err := app.Test(request(http.MethodDelete, "/flash-sales/1", signed))
+	assert.Nil(t, err)
+	rejected, err := app.Test(request(http.MethodDelete, "/flash-sales/1", confused))
+	assert.Nil(t, err)
+
+	assert.Equal(t, http.StatusOK, accepted.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, rejected.StatusCode)
+}
+
+func Test_when_jwtConfigInvalid_expect_error(t *testing.T) {
+	_, shortSecret := auth.NewJWTVerifier(auth.JWTConfig{Algorithm: "HS256", Secret: "short"})
+	_, noKey := auth.NewJWTVerifier(auth.JWTConfig{Algorithm: "RS256"})
+	_, unknown := auth.NewJWTVerifier(auth.JWTConfig{Algorithm: "none", Secret: jwtSecret})
+
+	assert.NotNil(t, shortSecret)
+	assert.NotNil(t, noKey)
+	assert.NotNil(t, unknown)
+}
+
+// staticAPIKeys resolves the keys of the map, the others are invalid.
+type staticAPIKeys map[string]*auth.Principal
+
+func (k staticAPIKeys) Resolve(_ context.Context, key string) (*auth.Principal, error) {
+	if principal, ok := k[key]; ok {
+		return principal, nil
+	}
+	return nil, auth.ErrInvalidAPIKey
+}
+
+// failingAPIKeys fails every lookup with err.
+type failingAPIKeys struct{ err error }
+
+func (k failingAPIKeys) Resolve(context.Context, string) (*auth.Principal, error) {
+	return nil, k.err
+}
+
+func Test_when_apiKeyUsed_expect_routesOfItsScopesOnly(t *testing.T) {
+	verifier, err := auth.NewJWTVerifier(hs256Config)
+	if err != nil {
+		t.Fatalf("creating verifier: %v", err)
+	}
+	apiKeys := staticAPIKeys{
+		"fsk_reader_secret": {Subject: "api-key:reader", Role: auth.RoleIntegration, Scopes: []string{auth.ScopeSalesRead}},
+		"fsk_writer_secret": {Subject: "api-key:writer", Role: auth.RoleIntegration, Scopes: []string{auth.ScopeSalesWrite}},
+	}
+	authenticate := middleware.Authenticate(verifier, apiKeys)
+
+	app := fiber.New()
+	app.Put("/flash-sales", authenticate, middleware.RequireScope(auth.ScopeSalesWrite), func(c *fiber.Ctx) error {
+		return c.SendString(middleware.Principal(c).Subject)
+	})
+	app.Get("/orders", authenticate, middleware.RequireScope(auth.ScopeOrdersRead, auth.RoleCustomer), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	keyRequest := func(method string, path string, key string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(middleware.APIKeyHeader, key)
+		return req
+	}
+
+	writer, _ := app.Test(keyRequest(http.MethodPut, "/flash-sales", "fsk_writer_secret"))
+	writerBody, _ := io.ReadAll(writer.Body)
+	reader, _ := app.Test(keyRequest(http.MethodPut, "/flash-sales", "fsk_reader_secret"))
+	unknown, _ := app.Test(keyRequest(http.MethodPut, "/flash-sales", "fsk_unknown_secret"))
+	orders, _ := app.Test(keyRequest(http.MethodGet, "/orders", "fsk_writer_secret"))
+	admin, _ := app.Test(request(http.MethodPut, "/flash-sales", signHS256(t, claims("admin-1", auth.RoleAdmin, time.Hour))))
+	customer, _ := app.Test(request(http.MethodGet, "/orders", signHS256(t, claims("customer-1", auth.RoleCustomer, time.Hour))))
+
+	assert.Equal(t, http.StatusOK, writer.StatusCode)
+	assert.Equal(t, "api-key:writer", string(writerBody))
+	assert.Equal(t, http.StatusForbidden, reader.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, unknown.StatusCode)
+	assert.Equal(t, http.StatusForbidden, orders.StatusCode)
+	assert.Equal(t, http.StatusOK, admin.StatusCode)
+	assert.Equal(t, http.StatusOK, customer.StatusCode)
+}
+
+func Test_when_apiKeyLookupFails_expect_serverErrorNotUnauthorized(t *testing.T) {
+	verifier, err := auth.NewJWTVerifier(hs256Config)
+	if err != nil {
+		t.Fatalf("creating verifier: %v", err)
+	}
+
+	statusOf := func(apiKeys middleware.APIKeyResolver) int {
+		app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+		app.Get("/orders", middleware.Authenticate(verifier, apiKeys), func(c *fiber.Ctx) error {
+			return c.SendStatus(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set(middleware.APIKeyHeader, "fsk_reader_secret")
+		res, err := app.Test(req)
+		assert.Nil(t, err)
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, statusOf(failingAPIKeys{err: errors.New("connection refused")}))
+	assert.Equal(t, http.StatusServiceUnavailable, statusOf(failingAPIKeys{err: context.DeadlineExceeded}))
+	assert.Equal(t, http.StatusUnauthorized, statusOf(failingAPIKeys{err: auth.ErrInvalidAPIKey}))
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"encoding/json"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func deadlineApp(timeout time.Duration, handler fiber.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Use(middleware.Deadline(timeout))
+	app.Get("/flash-sales", handler)
+	return app
+}
+
+func Test_when_timeoutConfigured_expect_userContextWithDeadline(t *testing.T) {
+	var hasDeadline bool
+	app := deadlineApp(time.Second, func(c *fiber.Ctx) error {
+		_, hasDeadline = c.UserContext().Deadline()
+		return c.SendStatus(http.StatusOK)
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/flash-sales", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, hasDeadline)
+}
+
+func Test_when_timeoutZero_expect_userContextWithoutDeadline(t *testing.T) {
+	hasDeadline := true
+	app := deadlineApp(0, func(c *fiber.Ctx) error {
+		_, hasDeadline = c.UserContext().Deadline()
+		return c.SendStatus(http.StatusOK)
+	})
+
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/flash-sales", nil))
+
+	assert.Nil(t, err)
+	assert.False(t, hasDeadline)
+}
+
+func Test_when_deadlinePasses_expect_serviceUnavailable(t *testing.T) {
+	app := deadlineApp(time.Millisecond, func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return c.UserContext().Err()
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/flash-sales", nil))
+	assert.Nil(t, err)
+
+	var problem response.ProblemResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, http.StatusServiceUnavailable, problem.Status)
+	assert.Equal(t, "service_unavailable", problem.Code)
+}
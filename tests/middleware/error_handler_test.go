@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	dtoRequest "flash_sale_management/dto/request"
+	"flash_sale_management/dto/response"
+	"flash_sale_management/middleware"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func problemFor(t *testing.T, handlerErr error) (*http.Response, response.ProblemResponse) {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Get("/flash-sales/:id", func(c *fiber.Ctx) error {
+		return handlerErr
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/flash-sales/1", nil))
+	assert.Nil(t, err)
+
+	var problem response.ProblemResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&problem))
+	return res, problem
+}
+
+func Test_when_serviceErrorReturned_expect_problemWithKindStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"sold out", &service.Error{Kind: service.KindSoldOut, Message: "purchase failed: sale is sold out"}, http.StatusConflict, service.KindSoldOut},
+		{"not started", &service.Error{Kind: service.KindSaleNotStarted, Message: "not started"}, http.StatusConflict, service.KindSaleNotStarted},
+		{"limit exceeded", &service.Error{Kind: service.KindLimitExceeded, Message: "too many units"}, http.StatusUnprocessableEntity, service.KindLimitExceeded},
+		{"record not found", &repository.NotFoundError{Entity: "sale"}, http.StatusNotFound, service.KindNotFound},
+		{"fiber error", fiber.NewError(http.StatusTooManyRequests, "too many requests"), http.StatusTooManyRequests, "too_many_requests"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, problem := problemFor(t, test.err)
+
+			assert.Equal(t, test.status, res.StatusCode)
+			assert.Equal(t, middleware.ProblemContentType, res.Header.Get(fiber.HeaderContentType))
+			assert.Equal(t, test.status, problem.Status)
+			assert.Equal(t, test.code, problem.Code)
+			assert.Equal(t, test.err.Error(), problem.Detail)
+			assert.Equal(t, "/flash-sales/1", problem.Instance)
+		})
+	}
+}
+
+func Test_when_validationFails_expect_fieldErrorsByJsonName(t *testing.T) {
+	saleRequest := dtoRequest.CreateSaleRequest{SaleStock: 1}
+
+	res, problem := problemFor(t, saleRequest.Validate())
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, service.KindValidation, problem.Code)
+	assert.Contains(t, problem.Errors, service.FieldError{Field: "product_id", Rule: "required", Message: "is required"})
+	assert.Contains(t, problem.Errors, service.FieldError{Field: "saleStock", Rule: "gt", Message: "must be greater than 1"})
+}
+
+func Test_when_unexpectedError_expect_internalErrorWithoutDetails(t *testing.T) {
+	res, problem := problemFor(t, errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.Equal(t, "internal_server_error", problem.Code)
+	assert.NotContains(t, problem.Detail, "10.0.0.5")
+}
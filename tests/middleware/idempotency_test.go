@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flash_sale_management/auth"
+	"flash_sale_management/middleware"
+	"flash_sale_management/service"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newIdempotentApp(t *testing.T, handler fiber.Handler) (*fiber.App, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	redisService := service.NewRedisService(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	app := fiber.New()
+	app.Post("/flash-sales/:id/buy", middleware.Idempotency(&redisService, time.Minute, time.Hour), handler)
+
+	return app, server
+}
+
+func buyRequest(key string) *http.Request {
+	return buyRequestWithBody(key, "")
+}
+
+func buyRequestWithBody(key string, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/flash-sales/1/buy", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyHeader, key)
+	}
+	return req
+}
+
+func Test_when_requestRetriedWithSameKey_expect_firstOutcomeReplayed(t *testing.T) {
+	calls := 0
+	app, _ := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		return c.Status(http.StatusOK).JSON(fiber.Map{"order": calls})
+	})
+
+	first, err := app.Test(buyRequest("key-1"))
+	assert.Nil(t, err)
+	firstBody, _ := io.ReadAll(first.Body)
+
+	retry, err := app.Test(buyRequest("key-1"))
+	assert.Nil(t, err)
+	retryBody, _ := io.ReadAll(retry.Body)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusOK, retry.StatusCode)
+	assert.Equal(t, string(firstBody), string(retryBody))
+	assert.Equal(t, "true", retry.Header.Get(middleware.IdempotencyReplayedHeader))
+	assert.Equal(t, fiber.MIMEApplicationJSON, retry.Header.Get(fiber.HeaderContentType))
+}
+
+func Test_when_firstRequestFailed_expect_errorStatusReplayed(t *testing.T) {
+	calls := 0
+	app, _ := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		return c.Status(http.StatusConflict).SendString("sold out")
+	})
+
+	_, err := app.Test(buyRequest("key-1"))
+	assert.Nil(t, err)
+
+	retry, err := app.Test(buyRequest("key-1"))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(retry.Body)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusConflict, retry.StatusCode)
+	assert.Equal(t, "sold out", string(body))
+}
+
+func Test_when_firstRequestServerError_expect_retryProcessed(t *testing.T) {
+	calls := 0
+	app, _ := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		if calls == 1 {
+			return c.Status(http.StatusInternalServerError).SendString("database unavailable")
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+
+	_, err := app.Test(buyRequest("key-1"))
+	assert.Nil(t, err)
+
+	retry, err := app.Test(buyRequest("key-1"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusOK, retry.StatusCode)
+	assert.Empty(t, retry.Header.Get(middleware.IdempotencyReplayedHeader))
+}
+
+func Test_when_firstRequestTimedOut_expect_retryProcessed(t *testing.T) {
+	calls := 0
+	app, _ := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		if calls == 1 {
+			return context.DeadlineExceeded
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+
+	_, err := app.Test(buyRequest("key-1"))
+	assert.Nil(t, err)
+
+	retry, err := app.Test(buyRequest("key-1"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusOK, retry.StatusCode)
+}
+
+func Test_when_keyReusedWithOtherBody_expect_unprocessableEntity(t *testing.T) {
+	calls := 0
+	app, _ := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		return c.SendStatus(http.StatusOK)
+	})
+
+	_, err := app.Test(buyRequestWithBody("key-1", `{"quantity":1}`))
+	assert.Nil(t, err)
+
+	retry, err := app.Test(buyRequestWithBody("key-1", `{"quantity":2}`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, retry.StatusCode)
+	assert.Empty(t, retry.Header.Get(middleware.IdempotencyReplayedHeader))
+}
+
+func Test_when_duplicateWhileFirstInProgress_expect_conflict(t *testing.T) {
+	calls := 0
+	app, server := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		return c.SendStatus(http.StatusOK)
+	})
+
+	// the first request claimed the key and has not finished yet
+	redisKey := fmt.Sprintf(middleware.IdempotencyKey, http.MethodPost, "/flash-sales/1/buy", "key-1")
+	emptyBody := sha256.Sum256(nil)
+	assert.Nil(t, server.Set(redisKey, `{"state":"processing","bodyHash":"`+hex.EncodeToString(emptyBody[:])+`"}`))
+
+	resp, err := app.Test(buyRequest("key-1"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, 0, calls)
+}
+
+func Test_when_noIdempotencyKey_expect_everyRequestHandled(t *testing.T) {
+	calls := 0
+	app, _ := newIdempotentApp(t, func(c *fiber.Ctx) error {
+		calls++
+		return c.SendStatus(http.StatusOK)
+	})
+
+	_, _ = app.Test(buyRequest(""))
+	_, _ = app.Test(buyRequest(""))
+
+	assert.Equal(t, 2, calls)
+}
+
+// subjectVerifier accepts any token as the customer with that subject.
+type subjectVerifier struct{}
+
+func (subjectVerifier) Verify(token string) (*auth.Principal, error) {
+	return &auth.Principal{Subject: token, Role: auth.RoleCustomer}, nil
+}
+
+func Test_when_customersUseSameKey_expect_keysNotShared(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisService := service.NewRedisService(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	calls := 0
+	app := fiber.New()
+	app.Post("/flash-sales/:id/buy", middleware.Authenticate(subjectVerifier{}, nil), middleware.Idempotency(&redisService, time.Minute, time.Hour),
+		func(c *fiber.Ctx) error {
+			calls++
+			return c.SendStatus(http.StatusOK)
+		})
+
+	for _, customer := range []string{"customer-1", "customer-2"} {
+		req := buyRequest("key-1")
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+customer)
+		_, err := app.Test(req)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"flash_sale_management/middleware"
+	"flash_sale_management/ratelimit"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRateLimitedApp(t *testing.T, rules []ratelimit.Rule) (*fiber.App, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	limiter := ratelimit.NewRedisLimiter(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	rateLimits := middleware.NewRateLimits(limiter, map[string][]ratelimit.Rule{"buy": rules})
+
+	app := fiber.New()
+	app.Post("/flash-sales/:id/buy", middleware.Authenticate(subjectVerifier{}, nil), rateLimits.For("buy"), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	return app, server
+}
+
+func customerBuy(saleID string, customer string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/flash-sales/"+saleID+"/buy", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+customer)
+	return req
+}
+
+func Test_when_customerOverLimit_expect_tooManyRequestsWithRetryAfter(t *testing.T) {
+	app, _ := newRateLimitedApp(t, []ratelimit.Rule{{By: []string{ratelimit.ByCustomer, ratelimit.BySale}, Limit: 2, Window: time.Minute}})
+
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		res, err := app.Test(customerBuy("1", "customer-1"))
+		assert.Nil(t, err)
+		statuses = append(statuses, res.StatusCode)
+
+		if i == 1 {
+			assert.Equal(t, "2", res.Header.Get(middleware.RateLimitLimitHeader))
+			assert.Equal(t, "0", res.Header.Get(middleware.RateLimitRemainingHeader))
+			assert.Equal(t, "60", res.Header.Get(middleware.RateLimitResetHeader))
+		}
+		if i == 2 {
+			assert.Equal(t, "60", res.Header.Get(fiber.HeaderRetryAfter))
+		}
+	}
+	otherSale, _ := app.Test(customerBuy("2", "customer-1"))
+	otherCustomer, _ := app.Test(customerBuy("1", "customer-2"))
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, statuses)
+	assert.Equal(t, http.StatusOK, otherSale.StatusCode)
+	assert.Equal(t, http.StatusOK, otherCustomer.StatusCode)
+}
+
+func Test_when_clientsShareIP_expect_ipLimitShared(t *testing.T) {
+	app, server := newRateLimitedApp(t, []ratelimit.Rule{{By: []string{ratelimit.ByIP}, Limit: 1, Window: time.Second}})
+
+	first, _ := app.Test(customerBuy("1", "customer-1"))
+	second, _ := app.Test(customerBuy("1", "customer-2"))
+
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, second.StatusCode)
+	assert.True(t, server.Exists("KEY_RATE_LIMIT:buy:ip=0.0.0.0"))
+}
+
+func Test_when_redisDown_expect_requestsLetThrough(t *testing.T) {
+	app, server := newRateLimitedApp(t, []ratelimit.Rule{{By: []string{ratelimit.ByIP}, Limit: 1, Window: time.Second}})
+	server.Close()
+
+	first, _ := app.Test(customerBuy("1", "customer-1"))
+	second, _ := app.Test(customerBuy("1", "customer-1"))
+
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+	assert.Equal(t, http.StatusOK, second.StatusCode)
+}
+
+func Test_when_routeHasNoRules_expect_noLimitHeaders(t *testing.T) {
+	limiter := &countingLimiter{}
+	rateLimits := middleware.NewRateLimits(limiter, nil)
+
+	app := fiber.New()
+	app.Post("/flash-sales/:id/queue", rateLimits.For("queue"), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodPost, "/flash-sales/1/queue", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get(middleware.RateLimitLimitHeader))
+	assert.Equal(t, 0, limiter.calls)
+}
+
+type countingLimiter struct {
+	calls int
+}
+
+func (l *countingLimiter) Allow(context.Context, []ratelimit.Check, time.Time) (*ratelimit.Decision, error) {
+	l.calls++
+	return &ratelimit.Decision{Allowed: true}, nil
+}
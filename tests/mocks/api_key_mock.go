@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type APIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *APIKeyRepository) Save(ctx context.Context, apiKey *entity.APIKey) repository.Result[*entity.APIKey] {
+	args := m.Called(apiKey)
+	return args.Get(0).(repository.Result[*entity.APIKey])
+}
+
+func (m *APIKeyRepository) FindAll(ctx context.Context) repository.Result[[]entity.APIKey] {
+	args := m.Called()
+	return args.Get(0).(repository.Result[[]entity.APIKey])
+}
+
+func (m *APIKeyRepository) FindOneById(ctx context.Context, id int) repository.Result[*entity.APIKey] {
+	args := m.Called(id)
+	return args.Get(0).(repository.Result[*entity.APIKey])
+}
+
+func (m *APIKeyRepository) FindOneByPrefix(ctx context.Context, prefix string) repository.Result[*entity.APIKey] {
+	args := m.Called(prefix)
+	return args.Get(0).(repository.Result[*entity.APIKey])
+}
+
+func (m *APIKeyRepository) Revoke(ctx context.Context, id int, now time.Time) error {
+	args := m.Called(id, now)
+	return args.Error(0)
+}
+
+func (m *APIKeyRepository) UpdateLastUsed(ctx context.Context, id int, now time.Time) error {
+	args := m.Called(id, now)
+	return args.Error(0)
+}
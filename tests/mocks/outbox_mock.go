@@ -0,0 +1,54 @@
+package mocks
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// OutboxRepository keeps the events saved in a transaction in Saved, so tests of the write paths
+// don't have to expect every event. The relay methods are regular mocks.
+type OutboxRepository struct {
+	mock.Mock
+	mutex sync.Mutex
+	Saved []entity.OutboxEvent
+}
+
+func (m *OutboxRepository) SaveInTx(tx *gorm.DB, event *entity.OutboxEvent) repository.Result[*entity.OutboxEvent] {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.Saved = append(m.Saved, *event)
+	return repository.Result[*entity.OutboxEvent]{Result: event}
+}
+
+// SavedTypes returns the types of the saved events in order.
+func (m *OutboxRepository) SavedTypes() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	types := make([]string, 0, len(m.Saved))
+	for _, event := range m.Saved {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func (m *OutboxRepository) ClaimPending(ctx context.Context, now time.Time, lease time.Duration, limit int) repository.Result[[]entity.OutboxEvent] {
+	args := m.Called(now, lease, limit)
+	return args.Get(0).(repository.Result[[]entity.OutboxEvent])
+}
+
+func (m *OutboxRepository) MarkPublished(ctx context.Context, id int, now time.Time) error {
+	args := m.Called(id, now)
+	return args.Error(0)
+}
+
+func (m *OutboxRepository) MarkFailed(ctx context.Context, id int, nextAttemptAt time.Time, reason string) error {
+	args := m.Called(id, nextAttemptAt, reason)
+	return args.Error(0)
+}
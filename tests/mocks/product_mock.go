@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"github.com/stretchr/testify/mock"
@@ -11,27 +12,42 @@ type ProductRepository struct {
 	mock.Mock
 }
 
-func (m *ProductRepository) FindOneById(id int) repository.Result {
+func (m *ProductRepository) FindAll(ctx context.Context) repository.Result[[]entity.Product] {
+	args := m.Called()
+	return args.Get(0).(repository.Result[[]entity.Product])
+}
+
+func (m *ProductRepository) FindOneById(ctx context.Context, id int) repository.Result[*entity.Product] {
 	args := m.Called(id)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Product])
 }
 
-func (m *ProductRepository) Save(product *entity.Product) repository.Result {
+func (m *ProductRepository) Save(ctx context.Context, product *entity.Product) repository.Result[*entity.Product] {
 	args := m.Called(product)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Product])
 }
 
-func (m *ProductRepository) Update(product *entity.Product) repository.Result {
+func (m *ProductRepository) Update(ctx context.Context, product *entity.Product) repository.Result[*entity.Product] {
 	args := m.Called(product)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Product])
 }
 
-func (m *ProductRepository) LockAndUpdateProduct(tx *gorm.DB, product *entity.Product) repository.Result {
+func (m *ProductRepository) DeleteOneById(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *ProductRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) repository.Result[*entity.Product] {
+	args := m.Called(tx, id)
+	return args.Get(0).(repository.Result[*entity.Product])
+}
+
+func (m *ProductRepository) UpdateInTx(tx *gorm.DB, product *entity.Product) repository.Result[*entity.Product] {
 	args := m.Called(tx, product)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Product])
 }
 
-func (m *ProductRepository) BeginTransaction() *gorm.DB {
-	args := m.Called()
-	return args.Get(0).(*gorm.DB)
+func (m *ProductRepository) UpdateColumnsInTx(tx *gorm.DB, product *entity.Product, columns ...string) repository.Result[*entity.Product] {
+	args := m.Called(tx, product, columns)
+	return args.Get(0).(repository.Result[*entity.Product])
 }
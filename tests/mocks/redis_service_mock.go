@@ -1,18 +1,29 @@
 package mocks
 
 import (
+	"context"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 type RedisService struct {
 	mock.Mock
 }
 
-func (rs *RedisService) Set(key string, value interface{}) error {
+func (rs *RedisService) Set(ctx context.Context, key string, value interface{}) error {
 	return nil
 }
 
-func (rs *RedisService) Get(key string) (string, error) {
+func (rs *RedisService) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return nil
+}
+
+func (rs *RedisService) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	args := rs.Called(key, value, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (rs *RedisService) Get(ctx context.Context, key string) (string, error) {
 	args := rs.Called(key)
 	var err error
 	if args.Get(1) != nil {
@@ -22,6 +33,30 @@ func (rs *RedisService) Get(key string) (string, error) {
 	return args.Get(0).(string), err
 }
 
-func (rs *RedisService) Delete(key string) error {
+func (rs *RedisService) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+func (rs *RedisService) InitStock(ctx context.Context, key string, stock int) error {
+	args := rs.Called(key, stock)
+	return args.Error(0)
+}
+
+func (rs *RedisService) ReserveStock(ctx context.Context, key string, quantity int) (bool, error) {
+	args := rs.Called(key, quantity)
+	return args.Bool(0), args.Error(1)
+}
+
+func (rs *RedisService) ReleaseStock(ctx context.Context, key string, quantity int) error {
+	args := rs.Called(key, quantity)
+	return args.Error(0)
+}
+
+func (rs *RedisService) AdjustStock(ctx context.Context, key string, delta int) error {
+	args := rs.Called(key, delta)
+	return args.Error(0)
+}
+
+func (rs *RedisService) Publish(ctx context.Context, channel string, message interface{}) error {
 	return nil
 }
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ReservationRepository struct {
+	mock.Mock
+}
+
+func (m *ReservationRepository) FindOneById(ctx context.Context, id int) repository.Result[*entity.Reservation] {
+	args := m.Called(id)
+	return args.Get(0).(repository.Result[*entity.Reservation])
+}
+
+func (m *ReservationRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) repository.Result[*entity.Reservation] {
+	args := m.Called(tx, id)
+	return args.Get(0).(repository.Result[*entity.Reservation])
+}
+
+func (m *ReservationRepository) FindOneByIdempotencyKey(ctx context.Context, key string) repository.Result[*entity.Reservation] {
+	args := m.Called(key)
+	return args.Get(0).(repository.Result[*entity.Reservation])
+}
+
+func (m *ReservationRepository) SaveInTx(tx *gorm.DB, reservation *entity.Reservation) repository.Result[*entity.Reservation] {
+	args := m.Called(tx, reservation)
+	return args.Get(0).(repository.Result[*entity.Reservation])
+}
+
+func (m *ReservationRepository) UpdateInTx(tx *gorm.DB, reservation *entity.Reservation) repository.Result[*entity.Reservation] {
+	args := m.Called(tx, reservation)
+	return args.Get(0).(repository.Result[*entity.Reservation])
+}
+
+func (m *ReservationRepository) FindExpired(ctx context.Context, now time.Time, limit int) repository.Result[[]entity.Reservation] {
+	args := m.Called(now, limit)
+	return args.Get(0).(repository.Result[[]entity.Reservation])
+}
@@ -1,16 +1,58 @@
 package mocks
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 type SaleLogRepository struct {
 	mock.Mock
 }
 
-func (m *SaleLogRepository) Save(saleLog *entity.SaleLog) repository.Result {
+func (m *SaleLogRepository) Save(ctx context.Context, saleLog *entity.SaleLog) repository.Result[*entity.SaleLog] {
 	args := m.Called(saleLog)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.SaleLog])
+}
+
+func (m *SaleLogRepository) SaveInTx(tx *gorm.DB, saleLog *entity.SaleLog) repository.Result[*entity.SaleLog] {
+	args := m.Called(tx, saleLog)
+	return args.Get(0).(repository.Result[*entity.SaleLog])
+}
+
+func (m *SaleLogRepository) FindOneByIdempotencyKey(ctx context.Context, key string) repository.Result[*entity.SaleLog] {
+	args := m.Called(key)
+	return args.Get(0).(repository.Result[*entity.SaleLog])
+}
+
+func (m *SaleLogRepository) FindOneById(ctx context.Context, id int) repository.Result[*entity.SaleLog] {
+	args := m.Called(id)
+	return args.Get(0).(repository.Result[*entity.SaleLog])
+}
+
+func (m *SaleLogRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) repository.Result[*entity.SaleLog] {
+	args := m.Called(tx, id)
+	return args.Get(0).(repository.Result[*entity.SaleLog])
+}
+
+func (m *SaleLogRepository) UpdateInTx(tx *gorm.DB, saleLog *entity.SaleLog) repository.Result[*entity.SaleLog] {
+	args := m.Called(tx, saleLog)
+	return args.Get(0).(repository.Result[*entity.SaleLog])
+}
+
+func (m *SaleLogRepository) FindAllByQuery(ctx context.Context, query repository.SaleLogQuery) repository.Result[[]entity.SaleLog] {
+	args := m.Called(query)
+	return args.Get(0).(repository.Result[[]entity.SaleLog])
+}
+
+func (m *SaleLogRepository) SumBySale(ctx context.Context, saleID int) repository.Result[*repository.SaleLogTotals] {
+	args := m.Called(saleID)
+	return args.Get(0).(repository.Result[*repository.SaleLogTotals])
+}
+
+func (m *SaleLogRepository) CountPerMinuteBySale(ctx context.Context, saleID int) repository.Result[[]repository.SaleLogMinute] {
+	args := m.Called(saleID)
+	return args.Get(0).(repository.Result[[]repository.SaleLogMinute])
 }
@@ -1,52 +1,114 @@
 package mocks
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/gorm"
+	"time"
 )
 
 type SaleRepository struct {
 	mock.Mock
 }
 
-func (m *SaleRepository) Save(sale *entity.Sale) repository.Result {
+func (m *SaleRepository) Save(ctx context.Context, sale *entity.Sale) repository.Result[*entity.Sale] {
 	args := m.Called(sale)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Sale])
 }
 
-func (m *SaleRepository) Update(sale *entity.Sale) repository.Result {
+func (m *SaleRepository) Update(ctx context.Context, sale *entity.Sale) repository.Result[*entity.Sale] {
 	args := m.Called(sale)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Sale])
 }
 
-func (m *SaleRepository) FindAll() repository.Result {
+func (m *SaleRepository) FindAll(ctx context.Context) repository.Result[[]entity.Sale] {
 	args := m.Called()
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[[]entity.Sale])
 }
 
-func (m *SaleRepository) FindOneById(id int) repository.Result {
-	args := m.Called(id)
-	return args.Get(0).(repository.Result)
+func (m *SaleRepository) FindAllActive(ctx context.Context, now time.Time) repository.Result[[]entity.Sale] {
+	args := m.Called(now)
+	return args.Get(0).(repository.Result[[]entity.Sale])
+}
+
+func (m *SaleRepository) FindAllByTimeWindow(ctx context.Context, from time.Time, to time.Time) repository.Result[[]entity.Sale] {
+	args := m.Called(from, to)
+	return args.Get(0).(repository.Result[[]entity.Sale])
+}
+
+func (m *SaleRepository) FindAllByProductInTx(tx *gorm.DB, productID int) repository.Result[[]entity.Sale] {
+	args := m.Called(tx, productID)
+	return args.Get(0).(repository.Result[[]entity.Sale])
+}
+
+func (m *SaleRepository) FindAllByQuery(ctx context.Context, query repository.SaleQuery) repository.Result[[]entity.Sale] {
+	args := m.Called(query)
+	return args.Get(0).(repository.Result[[]entity.Sale])
 }
 
-func (m *SaleRepository) FindOneByProduct(id int) repository.Result {
+func (m *SaleRepository) CountByQuery(ctx context.Context, query repository.SaleQuery) repository.Result[int64] {
+	args := m.Called(query)
+	return args.Get(0).(repository.Result[int64])
+}
+
+func (m *SaleRepository) FindOneById(ctx context.Context, id int) repository.Result[*entity.Sale] {
 	args := m.Called(id)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Sale])
 }
 
-func (m *SaleRepository) DeleteOneById(id int) repository.Result {
+func (m *SaleRepository) DeleteOneById(ctx context.Context, id int) error {
 	args := m.Called(id)
-	return args.Get(0).(repository.Result)
+	return args.Error(0)
+}
+
+func (m *SaleRepository) FindOneByIdForUpdate(tx *gorm.DB, id int) repository.Result[*entity.Sale] {
+	args := m.Called(tx, id)
+	return args.Get(0).(repository.Result[*entity.Sale])
 }
 
-func (m *SaleRepository) LockAndUpdateSale(tx *gorm.DB, sale *entity.Sale) repository.Result {
+func (m *SaleRepository) UpdateInTx(tx *gorm.DB, sale *entity.Sale) repository.Result[*entity.Sale] {
 	args := m.Called(tx, sale)
-	return args.Get(0).(repository.Result)
+	return args.Get(0).(repository.Result[*entity.Sale])
 }
 
-func (m *SaleRepository) BeginTransaction() *gorm.DB {
-	args := m.Called()
-	return args.Get(0).(*gorm.DB)
+func (m *SaleRepository) UpdateColumnsInTx(tx *gorm.DB, sale *entity.Sale, columns ...string) repository.Result[*entity.Sale] {
+	args := m.Called(tx, sale, columns)
+	return args.Get(0).(repository.Result[*entity.Sale])
+}
+
+func (m *SaleRepository) IncreaseCustomerPurchaseInTx(tx *gorm.DB, purchase *entity.CustomerPurchase, limit int) repository.Result[*entity.CustomerPurchase] {
+	args := m.Called(tx, purchase, limit)
+	return args.Get(0).(repository.Result[*entity.CustomerPurchase])
+}
+
+func (m *SaleRepository) DecreaseCustomerPurchaseInTx(tx *gorm.DB, purchase *entity.CustomerPurchase) repository.Result[*entity.CustomerPurchase] {
+	args := m.Called(tx, purchase)
+	return args.Get(0).(repository.Result[*entity.CustomerPurchase])
+}
+
+func (m *SaleRepository) ActivateDueSalesInTx(tx *gorm.DB, now time.Time) repository.Result[[]entity.Sale] {
+	args := m.Called(tx, now)
+	return args.Get(0).(repository.Result[[]entity.Sale])
+}
+
+func (m *SaleRepository) DeactivateFinishedSalesInTx(tx *gorm.DB, now time.Time) repository.Result[[]entity.Sale] {
+	args := m.Called(tx, now)
+	return args.Get(0).(repository.Result[[]entity.Sale])
+}
+
+func (m *SaleRepository) FindStartingSales(ctx context.Context, from time.Time, to time.Time) repository.Result[[]entity.Sale] {
+	args := m.Called(from, to)
+	return args.Get(0).(repository.Result[[]entity.Sale])
+}
+
+func (m *SaleRepository) SaveInTx(tx *gorm.DB, sale *entity.Sale) repository.Result[*entity.Sale] {
+	args := m.Called(tx, sale)
+	return args.Get(0).(repository.Result[*entity.Sale])
+}
+
+func (m *SaleRepository) DeleteOneByIdInTx(tx *gorm.DB, id int) error {
+	args := m.Called(tx, id)
+	return args.Error(0)
 }
@@ -0,0 +1,14 @@
+package mocks
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// UnitOfWork runs the callback without a real transaction, the repository mocks receive a nil tx.
+type UnitOfWork struct {
+}
+
+func (u *UnitOfWork) Execute(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return fn(nil)
+}
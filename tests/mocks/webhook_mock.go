@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type WebhookRepository struct {
+	mock.Mock
+}
+
+func (m *WebhookRepository) Save(ctx context.Context, subscription *entity.WebhookSubscription) repository.Result[*entity.WebhookSubscription] {
+	args := m.Called(subscription)
+	return args.Get(0).(repository.Result[*entity.WebhookSubscription])
+}
+
+func (m *WebhookRepository) FindAll(ctx context.Context) repository.Result[[]entity.WebhookSubscription] {
+	args := m.Called()
+	return args.Get(0).(repository.Result[[]entity.WebhookSubscription])
+}
+
+func (m *WebhookRepository) FindOneById(ctx context.Context, id int) repository.Result[*entity.WebhookSubscription] {
+	args := m.Called(id)
+	return args.Get(0).(repository.Result[*entity.WebhookSubscription])
+}
+
+func (m *WebhookRepository) DeleteOneById(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *WebhookRepository) SaveDeliveries(ctx context.Context, deliveries []entity.WebhookDelivery) repository.Result[[]entity.WebhookDelivery] {
+	args := m.Called(deliveries)
+	return args.Get(0).(repository.Result[[]entity.WebhookDelivery])
+}
+
+func (m *WebhookRepository) FindDeliveryById(ctx context.Context, id int) repository.Result[*entity.WebhookDelivery] {
+	args := m.Called(id)
+	return args.Get(0).(repository.Result[*entity.WebhookDelivery])
+}
+
+func (m *WebhookRepository) FindDeliveriesBySubscription(ctx context.Context, subscriptionID int, limit int) repository.Result[[]entity.WebhookDelivery] {
+	args := m.Called(subscriptionID, limit)
+	return args.Get(0).(repository.Result[[]entity.WebhookDelivery])
+}
+
+func (m *WebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) repository.Result[[]entity.WebhookDelivery] {
+	args := m.Called(now, lease, limit)
+	return args.Get(0).(repository.Result[[]entity.WebhookDelivery])
+}
+
+func (m *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *entity.WebhookDelivery) repository.Result[*entity.WebhookDelivery] {
+	args := m.Called(delivery)
+	return args.Get(0).(repository.Result[*entity.WebhookDelivery])
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"flash_sale_management/queue"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func stores(t *testing.T) map[string]queue.Store {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	return map[string]queue.Store{
+		"memory": queue.NewMemoryStore(),
+		"redis":  queue.NewRedisStore(client, time.Hour),
+	}
+}
+
+func Test_Join_when_severalCustomers_expect_sequenceInJoinOrder(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			first, err := store.Join(context.Background(), 1, "customer-1")
+			assert.Nil(t, err)
+			second, err := store.Join(context.Background(), 1, "customer-1")
+			assert.Nil(t, err)
+			otherSale, err := store.Join(context.Background(), 2, "customer-1")
+			assert.Nil(t, err)
+
+			assert.Equal(t, int64(1), first.Sequence)
+			assert.Equal(t, int64(2), second.Sequence)
+			assert.Equal(t, int64(1), otherSale.Sequence)
+			assert.NotEqual(t, first.Token, second.Token)
+
+			found, err := store.Find(context.Background(), 1, second.Token)
+			assert.Nil(t, err)
+			assert.Equal(t, second, found)
+		})
+	}
+}
+
+func Test_Find_when_unknownToken_expect_ticketNotFound(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ticket, err := store.Join(context.Background(), 1, "customer-1")
+			assert.Nil(t, err)
+
+			_, err = store.Find(context.Background(), 1, "unknown")
+			assert.ErrorIs(t, err, queue.ErrTicketNotFound)
+
+			_, err = store.Find(context.Background(), 2, ticket.Token)
+			assert.ErrorIs(t, err, queue.ErrTicketNotFound)
+		})
+	}
+}
+
+func Test_Consume_when_usedTwice_expect_onlyFirstSucceeds(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ticket, err := store.Join(context.Background(), 1, "customer-1")
+			assert.Nil(t, err)
+
+			consumed, err := store.Consume(context.Background(), 1, ticket.Token)
+			assert.Nil(t, err)
+			assert.True(t, consumed)
+
+			consumed, err = store.Consume(context.Background(), 1, ticket.Token)
+			assert.Nil(t, err)
+			assert.False(t, consumed)
+
+			assert.Nil(t, store.Release(context.Background(), 1, ticket.Token))
+
+			consumed, err = store.Consume(context.Background(), 1, ticket.Token)
+			assert.Nil(t, err)
+			assert.True(t, consumed)
+		})
+	}
+}
+
+func Test_Advance_when_secondsIdle_expect_lateJoinersOnlyGetCurrentBatch(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			// nothing is admitted before the start, the first second admits up to the rate
+			_, err := store.Join(context.Background(), 1, "customer-1")
+			assert.Nil(t, err)
+			admitted, err := store.Advance(context.Background(), 1, 2, -1)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(0), admitted)
+
+			admitted, err = store.Advance(context.Background(), 1, 2, 0)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), admitted)
+
+			// ten idle seconds later five customers join at once
+			for i := 0; i < 5; i++ {
+				_, err := store.Join(context.Background(), 1, "customer-2")
+				assert.Nil(t, err)
+			}
+
+			admitted, err = store.Advance(context.Background(), 1, 2, 10)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(3), admitted)
+
+			// seconds nobody asked about still admit the customers that were waiting
+			admitted, err = store.Advance(context.Background(), 1, 2, 12)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(6), admitted)
+		})
+	}
+}
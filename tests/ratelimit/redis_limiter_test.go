@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"flash_sale_management/ratelimit"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newLimiter(t *testing.T) *ratelimit.RedisLimiter {
+	server := miniredis.RunT(t)
+	return ratelimit.NewRedisLimiter(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+}
+
+func Test_when_limitReached_expect_deniedUntilWindowSlides(t *testing.T) {
+	limiter := newLimiter(t)
+	checks := []ratelimit.Check{{Key: "KEY_RATE_LIMIT:buy:ip=1.2.3.4", Limit: 2, Window: time.Second}}
+	start := time.Now()
+
+	first, err := limiter.Allow(context.Background(), checks, start)
+	assert.Nil(t, err)
+	second, err := limiter.Allow(context.Background(), checks, start.Add(400*time.Millisecond))
+	assert.Nil(t, err)
+	denied, err := limiter.Allow(context.Background(), checks, start.Add(600*time.Millisecond))
+	assert.Nil(t, err)
+	// the first request left the window, the second one is still in it
+	slid, err := limiter.Allow(context.Background(), checks, start.Add(1100*time.Millisecond))
+	assert.Nil(t, err)
+
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 1, first.Remaining)
+	assert.True(t, second.Allowed)
+	assert.Equal(t, 0, second.Remaining)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 400*time.Millisecond, denied.RetryAfter)
+	assert.True(t, slid.Allowed)
+	assert.Equal(t, 0, slid.Remaining)
+}
+
+func Test_when_oneCheckDenies_expect_othersNotCounted(t *testing.T) {
+	limiter := newLimiter(t)
+	customer := ratelimit.Check{Key: "KEY_RATE_LIMIT:buy:customer=c-1", Limit: 1, Window: time.Minute}
+	sale := ratelimit.Check{Key: "KEY_RATE_LIMIT:buy:sale=1", Limit: 3, Window: time.Minute}
+	now := time.Now()
+
+	allowed, err := limiter.Allow(context.Background(), []ratelimit.Check{customer, sale}, now)
+	assert.Nil(t, err)
+	denied, err := limiter.Allow(context.Background(), []ratelimit.Check{customer, sale}, now)
+	assert.Nil(t, err)
+	saleOnly, err := limiter.Allow(context.Background(), []ratelimit.Check{sale}, now)
+	assert.Nil(t, err)
+
+	assert.True(t, allowed.Allowed)
+	assert.Equal(t, 1, allowed.Limit, "the customer check is closest to its limit")
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, time.Minute, denied.RetryAfter)
+	assert.True(t, saleOnly.Allowed)
+	assert.Equal(t, 1, saleOnly.Remaining, "the denied request was not counted for the sale")
+}
+
+func Test_when_ruleInvalid_expect_validationError(t *testing.T) {
+	assert.Nil(t, ratelimit.Rule{By: []string{ratelimit.ByCustomer, ratelimit.BySale}, Limit: 5, Window: time.Second}.Validate())
+	assert.NotNil(t, ratelimit.Rule{By: []string{"country"}, Limit: 5, Window: time.Second}.Validate())
+	assert.NotNil(t, ratelimit.Rule{By: []string{ratelimit.ByIP}, Window: time.Second}.Validate())
+	assert.NotNil(t, ratelimit.Rule{Limit: 5, Window: time.Second}.Validate())
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_when_revokeAPIKey_expect_onlyUnrevokedKeyUpdated(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewAPIKeyRepository(db)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "api_keys" SET "revoked_at"=\$1 WHERE id = \$2 AND revoked_at IS NULL`).
+		WithArgs(now, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.Revoke(context.Background(), 3, now)
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
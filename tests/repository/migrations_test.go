@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_BackfillSaleLogSales_when_unlinkedLogs_expect_linkedByProductAndPeriod(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	mock.ExpectExec(`^UPDATE sale_logs SET\s+sale_id = sales.id,\s+discount = sales.discount,\s+original_price = (.+)FROM sales\s+WHERE sale_logs.sale_id IS NULL\s+AND sales.product_id = sale_logs.product_id\s+AND sale_logs.created_at >= sales.start_time\s+AND sale_logs.created_at <= sales.end_time`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	updated, err := repository.BackfillSaleLogSales(db)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), updated)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_BackfillSaleInitialStock_when_salesWithoutInitialStock_expect_stockPlusSoldAndHeldUnits(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	mock.ExpectExec(`^UPDATE sales SET initial_stock = sales.sale_stock\s+\+ COALESCE\(\(SELECT SUM\(sale_logs.quantity\) FROM sale_logs (.+)\s+\+ COALESCE\(\(SELECT SUM\(reservations.quantity\) FROM reservations (.+)\s+WHERE sales.initial_stock = 0`).
+		WithArgs(entity.OrderPlaced, entity.ReservationHeld).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	updated, err := repository.BackfillSaleInitialStock(db)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updated)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_when_claimPendingOutboxEvents_expect_dueEventsLeasedInOrder(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewOutboxRepository(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "type", "sale_id", "payload", "attempts"}).
+		AddRow(2, entity.SalePurchased, 1, `{}`, 1).
+		AddRow(1, entity.SaleCreated, 1, `{}`, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^UPDATE "outbox_events" SET "attempts"=attempts \+ 1,"next_attempt_at"=\$1 WHERE id IN \(SELECT "id" FROM "outbox_events" WHERE published_at IS NULL AND next_attempt_at <= \$2 ORDER BY id LIMIT \$3 FOR UPDATE SKIP LOCKED\) RETURNING \*`).
+		WithArgs(now.Add(time.Minute), now, 10).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	result := repo.ClaimPending(context.Background(), now, time.Minute, 10)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, 1, data[0].ID)
+	assert.Equal(t, 2, data[1].ID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_markOutboxEventFailed_expect_nextAttemptScheduled(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewOutboxRepository(db)
+	next := time.Now().Add(time.Second)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "outbox_events" SET "last_error"=\$1,"next_attempt_at"=\$2 WHERE "id" = \$3`).
+		WithArgs("broker down", next, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.MarkFailed(context.Background(), 4, next, "broker down")
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
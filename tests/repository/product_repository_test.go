@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -33,8 +34,8 @@ func Test_when_requestFindProduct_expect_returnOneProduct(t *testing.T) {
 		WithArgs(product.ID, 1).
 		WillReturnRows(rows)
 
-	productResult := productRepository.FindOneById(product.ID)
-	var data = productResult.Result.(*entity.Product)
+	productResult := productRepository.FindOneById(context.Background(), product.ID)
+	var data = productResult.Result
 
 	assert.NotEmpty(t, data)
 	assert.NoError(t, err)
@@ -58,8 +59,8 @@ func Test_when_saveProduct_expect_returnSuccess(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(product.ID))
 	mockProduct.ExpectCommit()
 
-	productResult := productRepository.Save(&product)
-	data := productResult.Result.(*entity.Product)
+	productResult := productRepository.Save(context.Background(), &product)
+	data := productResult.Result
 
 	assert.NotEmpty(t, data)
 	assert.NoError(t, productResult.Error)
@@ -83,8 +84,8 @@ func Test_when_updateProduct_expect_returnUpdatedProduct(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mockProduct.ExpectCommit()
 
-	productResult := productRepository.Update(&product)
-	data := productResult.Result.(*entity.Product)
+	productResult := productRepository.Update(context.Background(), &product)
+	data := productResult.Result
 
 	assert.NotEmpty(t, data)
 	assert.Equal(t, product.Name, data.Name)
@@ -94,3 +95,76 @@ func Test_when_updateProduct_expect_returnUpdatedProduct(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func Test_UpdateColumnsInTx_when_priceChanged_expect_stockNotWritten(t *testing.T) {
+	db, mockProduct, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	productRepository := repository.NewProductRepository(db)
+	updated := product
+	updated.Price = 8
+
+	mockProduct.ExpectBegin()
+	mockProduct.ExpectExec(`^UPDATE "products" SET "price"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(updated.Price, sqlmock.AnyArg(), updated.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockProduct.ExpectCommit()
+
+	result := productRepository.UpdateColumnsInTx(db, &updated, "price", "updated_at")
+
+	assert.NoError(t, result.Error)
+	if err := mockProduct.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_requestFindProducts_expect_returnAllProducts(t *testing.T) {
+	db, mockProduct, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	productRepository := repository.NewProductRepository(db)
+
+	rows := sqlmock.NewRows([]string{"id", "name", "price", "stock", "created_at", "updated_at"}).
+		AddRow(product.ID, product.Name, product.Price, product.Stock, product.CreatedAt, product.UpdatedAt).
+		AddRow(product.ID+1, product.Name, product.Price, product.Stock, product.CreatedAt, product.UpdatedAt)
+
+	mockProduct.ExpectQuery(`^SELECT \* FROM "products" ORDER BY id`).
+		WillReturnRows(rows)
+
+	productResult := productRepository.FindAll(context.Background())
+	var data = productResult.Result
+
+	assert.Len(t, data, 2)
+	assert.NoError(t, productResult.Error)
+
+	if err := mockProduct.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_deleteProductById_expect_success(t *testing.T) {
+	db, mockProduct, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	productRepository := repository.NewProductRepository(db)
+
+	mockProduct.ExpectBegin()
+	mockProduct.ExpectExec(`^DELETE FROM "products" WHERE "products"."id" = ?`).
+		WithArgs(product.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockProduct.ExpectCommit()
+
+	err = productRepository.DeleteOneById(context.Background(), product.ID)
+
+	assert.NoError(t, err)
+
+	if err := mockProduct.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_when_findExpiredReservations_expect_heldAndExpiredReturned(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewReservationRepository(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "sale_id", "customer_id", "quantity", "status", "expires_at"}).
+		AddRow(1, 1, "customer-1", 2, entity.ReservationHeld, now.Add(-time.Minute)).
+		AddRow(2, 1, "customer-2", 1, entity.ReservationHeld, now.Add(-time.Second))
+
+	mock.ExpectQuery(`^SELECT \* FROM "reservations" WHERE status = \$1 AND expires_at <= \$2 ORDER BY expires_at LIMIT \$3`).
+		WithArgs(entity.ReservationHeld, now, 100).
+		WillReturnRows(rows)
+
+	result := repo.FindExpired(context.Background(), now, 100)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 2)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_insertReservation_expect_saved(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewReservationRepository(db)
+	reservation := entity.Reservation{SaleID: 1, ProductID: 1, CustomerID: "customer-1", Quantity: 2,
+		Status: entity.ReservationHeld, ExpiresAt: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO "reservations"`).
+		WithArgs(reservation.SaleID, reservation.ProductID, reservation.CustomerID, reservation.Quantity,
+			reservation.Status, reservation.ExpiresAt, reservation.SaleLogID, reservation.IdempotencyKey, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	result := repo.SaveInTx(db, &reservation)
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, 1, reservation.ID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
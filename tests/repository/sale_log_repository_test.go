@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -11,10 +12,17 @@ import (
 
 var saleLog = entity.SaleLog{
 	ID:                    1,
+	SaleID:                &sale.ID,
 	ProductID:             2,
+	CustomerID:            "customer-1",
 	RemainingSaleStock:    10,
 	RemainingProductStock: 10,
+	Quantity:              2,
+	OriginalPrice:         125,
+	Discount:              20,
 	Price:                 100,
+	TotalPrice:            200,
+	Status:                entity.OrderPlaced,
 	CreatedAt:             time.Now(),
 }
 
@@ -28,12 +36,12 @@ func Test_Save_when_expect_success(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(`^INSERT INTO "sale_logs" (.+) VALUES (.+) RETURNING "id"`).
-		WithArgs(saleLog.ProductID, saleLog.RemainingSaleStock, saleLog.RemainingProductStock, saleLog.Price, sqlmock.AnyArg(), saleLog.ID).
+		WithArgs(saleLog.SaleID, saleLog.ProductID, saleLog.CustomerID, saleLog.RemainingSaleStock, saleLog.RemainingProductStock, saleLog.Quantity, saleLog.OriginalPrice, saleLog.Discount, saleLog.Price, saleLog.TotalPrice, saleLog.IdempotencyKey, saleLog.Status, sqlmock.AnyArg(), sqlmock.AnyArg(), saleLog.ID).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(sale.ID))
 	mock.ExpectCommit()
 
-	result := repo.Save(&saleLog)
-	data := result.Result.(*entity.SaleLog)
+	result := repo.Save(context.Background(), &saleLog)
+	data := result.Result
 
 	assert.NoError(t, result.Error)
 	assert.Equal(t, data, result.Result)
@@ -41,3 +49,120 @@ func Test_Save_when_expect_success(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func Test_FindAllByQuery_when_filtersAndCursor_expect_keysetQuery(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleLogRepository(db)
+	from := time.Now().Add(-time.Hour)
+	after := time.Now().Add(-time.Minute)
+
+	rows := sqlmock.NewRows([]string{"id", "product_id", "customer_id", "status", "created_at"}).
+		AddRow(4, 2, "customer-1", entity.OrderPlaced, after.Add(-time.Second)).
+		AddRow(3, 2, "customer-1", entity.OrderPlaced, after.Add(-2*time.Second))
+
+	mock.ExpectQuery(`^SELECT \* FROM "sale_logs" WHERE product_id = \$1 AND customer_id = \$2 AND status = \$3 AND created_at >= \$4 AND \(created_at, id\) < \(\$5, \$6\) ORDER BY created_at DESC, id DESC LIMIT \$7`).
+		WithArgs(2, "customer-1", entity.OrderPlaced, from, after, 5, 3).
+		WillReturnRows(rows)
+
+	result := repo.FindAllByQuery(context.Background(), repository.SaleLogQuery{
+		ProductID:  2,
+		CustomerID: "customer-1",
+		Status:     entity.OrderPlaced,
+		From:       &from,
+		SortColumn: "created_at",
+		Descending: true,
+		AfterValue: after,
+		AfterID:    5,
+		Limit:      3,
+	})
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 2)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_FindAllByQuery_when_unknownSortColumn_expect_createdAtOrder(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleLogRepository(db)
+
+	mock.ExpectQuery(`^SELECT \* FROM "sale_logs" ORDER BY created_at ASC, id ASC LIMIT \$1`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	result := repo.FindAllByQuery(context.Background(), repository.SaleLogQuery{SortColumn: "id; DROP TABLE sale_logs", Limit: 10})
+
+	assert.NoError(t, result.Error)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_SumBySale_when_placedOrders_expect_totals(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleLogRepository(db)
+	first := time.Now().Add(-time.Minute)
+	last := time.Now()
+
+	rows := sqlmock.NewRows([]string{"orders", "units_sold", "revenue", "discount_given", "unique_customers", "first_order_at", "last_order_at"}).
+		AddRow(4, 5, 400.0, 100.0, 3, first, last)
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) AS orders, .* FROM "sale_logs" WHERE sale_id = \$1 AND status = \$2`).
+		WithArgs(1, entity.OrderPlaced).
+		WillReturnRows(rows)
+
+	result := repo.SumBySale(context.Background(), 1)
+	totals := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, int64(5), totals.UnitsSold)
+	assert.Equal(t, float64(400), totals.Revenue)
+	assert.Equal(t, float64(100), totals.DiscountGiven)
+	assert.Equal(t, int64(3), totals.UniqueCustomers)
+	assert.Equal(t, last, *totals.LastOrderAt)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_CountPerMinuteBySale_when_placedOrders_expect_minutes(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleLogRepository(db)
+	minute := time.Now().Truncate(time.Minute)
+
+	rows := sqlmock.NewRows([]string{"minute", "purchases", "units"}).
+		AddRow(minute, 3, 4).
+		AddRow(minute.Add(time.Minute), 1, 1)
+
+	mock.ExpectQuery(`^SELECT date_trunc\('minute', created_at\) AS minute, COUNT\(\*\) AS purchases, SUM\(quantity\) AS units FROM "sale_logs" WHERE sale_id = \$1 AND status = \$2 GROUP BY "minute" ORDER BY minute`).
+		WithArgs(1, entity.OrderPlaced).
+		WillReturnRows(rows)
+
+	result := repo.CountPerMinuteBySale(context.Background(), 1)
+	minutes := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, minutes, 2)
+	assert.Equal(t, int64(4), minutes[0].Units)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
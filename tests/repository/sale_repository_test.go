@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -30,49 +31,156 @@ func Test_when_requestFindSales_expect_returnAllSales(t *testing.T) {
 	salesRepository := repository.NewSaleRepository(db)
 
 	rows := sqlmock.NewRows([]string{"id", "product_id", "sale_stock", "created_at", "start_time", "end_time", "active"}).
-		AddRow(sale.ID, sale.ProductID, sale.SaleStock, sale.CreatedAt, sale.StartTime, sale.EndTime, sale.Active)
+		AddRow(sale.ID, sale.ProductID, sale.SaleStock, sale.CreatedAt, sale.StartTime, sale.EndTime, sale.Active).
+		AddRow(2, 3, 15, sale.CreatedAt, sale.StartTime, sale.EndTime, true)
 
-	mock.ExpectQuery(`^SELECT \* FROM "sales"`).
+	mock.ExpectQuery(`^SELECT \* FROM "sales" ORDER BY id`).
 		WillReturnRows(rows)
 
-	sales := salesRepository.FindAll()
-	var data = sales.Result.(*entity.Sale)
+	sales := salesRepository.FindAll(context.Background())
+	var data = sales.Result
 
-	assert.NotEmpty(t, data)
-	assert.NoError(t, err)
+	assert.NoError(t, sales.Error)
+	assert.Len(t, data, 2)
+	assert.Equal(t, 1, data[0].ID)
+	assert.Equal(t, 2, data[1].ID)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
 
-func Test_when_requestFindSale_expect_returnOneSale(t *testing.T) {
+func Test_FindAllByQuery_when_activeSalesInWindow_expect_keysetQuery(t *testing.T) {
 	db, mock, err := CreateMock()
 	if err != nil {
 		t.Fatalf("failed to create mocks: %s", err)
 	}
 
 	salesRepository := repository.NewSaleRepository(db)
+	now := time.Now()
+	from := now.Add(-time.Hour)
+	to := now.Add(time.Hour)
 
-	rows := sqlmock.NewRows([]string{"id", "product_id", "sale_stock", "created_at", "start_time", "end_time", "active"}).
-		AddRow(sale.ID, sale.ProductID, sale.SaleStock, sale.CreatedAt, sale.StartTime, sale.EndTime, sale.Active)
+	rows := sqlmock.NewRows([]string{"id", "product_id", "discount"}).
+		AddRow(3, 2, 15.5).
+		AddRow(2, 2, 12)
 
-	mock.ExpectQuery(`^SELECT \* FROM "sales"`).
-		WithArgs(sale.ID, 1).
+	mock.ExpectQuery(`^SELECT \* FROM "sales" WHERE \(active = \$1 AND start_time <= \$2 AND end_time > \$3 AND sale_stock > 0\) AND product_id = \$4 AND end_time > \$5 AND start_time < \$6 AND \(discount, id\) < \(\$7, \$8\) ORDER BY discount DESC, id DESC LIMIT \$9`).
+		WithArgs(true, now, now, 2, from, to, 20.0, 4, 3).
 		WillReturnRows(rows)
 
-	sales := salesRepository.FindOneById(sale.ID)
-	var data = sales.Result.(*entity.Sale)
+	result := salesRepository.FindAllByQuery(context.Background(), repository.SaleQuery{
+		Status:     repository.SaleActive,
+		ProductID:  2,
+		From:       &from,
+		To:         &to,
+		Now:        now,
+		SortColumn: "discount",
+		Descending: true,
+		AfterValue: 20.0,
+		AfterID:    4,
+		Limit:      3,
+	})
+	data := result.Result
 
-	assert.NotEmpty(t, data)
-	assert.NoError(t, err)
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 2)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_CountByQuery_when_endedSales_expect_countWithoutPaging(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	salesRepository := repository.NewSaleRepository(db)
+	now := time.Now()
+
+	mock.ExpectQuery(`^SELECT count\(\*\) FROM "sales" WHERE end_time <= \$1$`).
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+
+	result := salesRepository.CountByQuery(context.Background(), repository.SaleQuery{Status: repository.SaleEnded, Now: now, AfterID: 4, Limit: 3})
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, int64(12), result.Result)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_FindAllActive_when_runningSales_expect_allReturned(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	salesRepository := repository.NewSaleRepository(db)
+	now := time.Now()
+
+	mock.ExpectQuery(`^SELECT \* FROM "sales" WHERE active = \$1 AND start_time <= \$2 AND end_time > \$3 AND sale_stock > 0 ORDER BY start_time, id`).
+		WithArgs(true, now, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "active"}).AddRow(1, true).AddRow(4, true).AddRow(7, true))
+
+	result := salesRepository.FindAllActive(context.Background(), now)
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, result.Result, 3)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_FindAllByTimeWindow_when_overlappingSales_expect_allReturned(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	salesRepository := repository.NewSaleRepository(db)
+	from := time.Now()
+	to := from.Add(24 * time.Hour)
+
+	mock.ExpectQuery(`^SELECT \* FROM "sales" WHERE end_time > \$1 AND start_time < \$2 ORDER BY start_time, id`).
+		WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3))
 
+	result := salesRepository.FindAllByTimeWindow(context.Background(), from, to)
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, result.Result, 2)
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
 
-func Test_when_requestFindSaleByProductID_expect_returnOneSale(t *testing.T) {
+func Test_FindAllByProductInTx_when_productHasSales_expect_allReturned(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	salesRepository := repository.NewSaleRepository(db)
+
+	mock.ExpectQuery(`^SELECT \* FROM "sales" WHERE product_id = \$1 ORDER BY start_time, id`).
+		WithArgs(sale.ProductID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}).AddRow(1, sale.ProductID).AddRow(5, sale.ProductID))
+
+	result := salesRepository.FindAllByProductInTx(db, sale.ProductID)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 2)
+	assert.Equal(t, 5, data[1].ID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_requestFindSale_expect_returnOneSale(t *testing.T) {
 	db, mock, err := CreateMock()
 	if err != nil {
 		t.Fatalf("failed to create mocks: %s", err)
@@ -84,11 +192,11 @@ func Test_when_requestFindSaleByProductID_expect_returnOneSale(t *testing.T) {
 		AddRow(sale.ID, sale.ProductID, sale.SaleStock, sale.CreatedAt, sale.StartTime, sale.EndTime, sale.Active)
 
 	mock.ExpectQuery(`^SELECT \* FROM "sales"`).
-		WithArgs(sale.ProductID, 1).
+		WithArgs(sale.ID, 1).
 		WillReturnRows(rows)
 
-	sales := salesRepository.FindOneByProduct(sale.ProductID)
-	var data = sales.Result.(*entity.Sale)
+	sales := salesRepository.FindOneById(context.Background(), sale.ID)
+	var data = sales.Result
 
 	assert.NotEmpty(t, data)
 	assert.NoError(t, err)
@@ -98,6 +206,30 @@ func Test_when_requestFindSaleByProductID_expect_returnOneSale(t *testing.T) {
 	}
 }
 
+func Test_when_requestMissingSale_expect_notFoundError(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	salesRepository := repository.NewSaleRepository(db)
+
+	mock.ExpectQuery(`^SELECT \* FROM "sales"`).
+		WithArgs(sale.ID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	result := salesRepository.FindOneById(context.Background(), sale.ID)
+
+	var notFoundError *repository.NotFoundError
+	assert.Nil(t, result.Result)
+	assert.ErrorIs(t, result.Error, repository.ErrNotFound)
+	assert.ErrorAs(t, result.Error, &notFoundError)
+	assert.Equal(t, "sale", notFoundError.Entity)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func Test_Save_when_validSale_expect_success(t *testing.T) {
 	db, mock, err := CreateMock()
 	if err != nil {
@@ -108,12 +240,12 @@ func Test_Save_when_validSale_expect_success(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(`^INSERT INTO "sales" (.+) VALUES (.+) RETURNING "id"`).
-		WithArgs(sale.ProductID, sale.SaleStock, sale.Discount, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sale.Active, sale.ID).
+		WithArgs(sale.ProductID, sale.SaleStock, sale.InitialStock, sale.Discount, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sale.Active, sale.MaxPerCustomer, sale.MaxPerOrder, sale.ActivatedAt, sale.WaitingRoom, sale.AdmissionRate, sale.ID).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(sale.ID))
 	mock.ExpectCommit()
 
-	result := repo.Save(&sale)
-	data := result.Result.(*entity.Sale)
+	result := repo.Save(context.Background(), &sale)
+	data := result.Result
 
 	assert.NoError(t, result.Error)
 	assert.Equal(t, data, result.Result)
@@ -132,12 +264,12 @@ func Test_update_when_validSale_expect_success(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectExec(`^UPDATE "sales" SET (.+) WHERE "id" = ?`).
-		WithArgs(sale.ProductID, sale.SaleStock, sale.Discount, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sale.Active, sale.ID).
+		WithArgs(sale.ProductID, sale.SaleStock, sale.InitialStock, sale.Discount, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sale.Active, sale.MaxPerCustomer, sale.MaxPerOrder, sale.ActivatedAt, sale.WaitingRoom, sale.AdmissionRate, sale.ID).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	result := repo.Update(&sale)
-	data := result.Result.(*entity.Sale)
+	result := repo.Update(context.Background(), &sale)
+	data := result.Result
 
 	assert.NoError(t, result.Error)
 	assert.Equal(t, data, result.Result)
@@ -146,6 +278,30 @@ func Test_update_when_validSale_expect_success(t *testing.T) {
 	}
 }
 
+func Test_UpdateColumnsInTx_when_discountChanged_expect_onlyDiscountWritten(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	updated := sale
+	updated.Discount = 25
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "sales" SET "discount"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(updated.Discount, sqlmock.AnyArg(), updated.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result := repo.UpdateColumnsInTx(db, &updated, "discount", "updated_at")
+
+	assert.NoError(t, result.Error)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func Test_when_deleteSaleById_expect_success(t *testing.T) {
 	db, mock, err := CreateMock()
 	if err != nil {
@@ -160,12 +316,164 @@ func Test_when_deleteSaleById_expect_success(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	deleteResult := saleRepository.DeleteOneById(sale.ID)
+	err = saleRepository.DeleteOneById(context.Background(), sale.ID)
 
-	assert.Nil(t, deleteResult.Result)
-	assert.NoError(t, deleteResult.Error)
+	assert.NoError(t, err)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func Test_when_increaseCustomerPurchaseWithinLimit_expect_success(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	purchase := entity.CustomerPurchase{SaleID: sale.ID, CustomerID: "customer-1", Quantity: 1}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "customer_purchases" (.+) VALUES (.+) ON CONFLICT \("sale_id","customer_id"\) DO UPDATE SET (.+) WHERE customer_purchases.quantity \+ EXCLUDED.quantity <= \$5`).
+		WithArgs(purchase.SaleID, purchase.CustomerID, purchase.Quantity, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result := repo.IncreaseCustomerPurchaseInTx(db, &purchase, 2)
+
+	assert.NoError(t, result.Error)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_increaseCustomerPurchaseOverLimit_expect_limitExceeded(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	purchase := entity.CustomerPurchase{SaleID: sale.ID, CustomerID: "customer-1", Quantity: 1}
+
+	// the conditional update did not match, so no row was written
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "customer_purchases"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	result := repo.IncreaseCustomerPurchaseInTx(db, &purchase, 1)
+
+	assert.ErrorIs(t, result.Error, repository.ErrPurchaseLimitExceeded)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_activateDueSales_expect_claimedSalesReturned(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "product_id", "sale_stock", "active"}).
+		AddRow(1, 1, 10, true).
+		AddRow(2, 2, 5, true)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^UPDATE "sales" SET "activated_at"=\$1,"active"=\$2,"updated_at"=\$3 WHERE active = \$4 AND activated_at IS NULL AND start_time <= \$5 AND end_time > \$6 AND sale_stock > 0 RETURNING \*`).
+		WithArgs(now, true, now, false, now, now).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	result := repo.ActivateDueSalesInTx(db, now)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 2)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_deactivateFinishedSales_expect_endedAndSoldOutSalesReturned(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "product_id", "sale_stock", "active"}).
+		AddRow(1, 1, 0, false)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^UPDATE "sales" SET "activated_at"=CASE WHEN end_time <= \$1 THEN activated_at END,"active"=\$2,"updated_at"=\$3 WHERE active = \$4 AND \(end_time <= \$5 OR \(sale_stock <= 0 AND NOT EXISTS \(SELECT 1 FROM "reservations" WHERE reservations.sale_id = sales.id AND reservations.status = \$6\)\)\) RETURNING \*`).
+		WithArgs(now, false, now, true, now, entity.ReservationHeld).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	result := repo.DeactivateFinishedSalesInTx(db, now)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 1)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_decreaseCustomerPurchase_expect_counterReduced(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	purchase := entity.CustomerPurchase{SaleID: sale.ID, CustomerID: "customer-1", Quantity: 2}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "customer_purchases" SET "quantity"=GREATEST\(quantity - \$1, 0\),"updated_at"=\$2 WHERE sale_id = \$3 AND customer_id = \$4`).
+		WithArgs(purchase.Quantity, sqlmock.AnyArg(), purchase.SaleID, purchase.CustomerID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result := repo.DecreaseCustomerPurchaseInTx(db, &purchase)
+
+	assert.NoError(t, result.Error)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_findStartingSales_expect_upcomingSalesInWindow(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewSaleRepository(db)
+	now := time.Now()
+	until := now.Add(time.Minute)
+
+	rows := sqlmock.NewRows([]string{"id", "product_id", "sale_stock", "active"}).
+		AddRow(1, 1, 10, false)
+
+	mock.ExpectQuery(`^SELECT \* FROM "sales" WHERE active = \$1 AND activated_at IS NULL AND start_time > \$2 AND start_time <= \$3`).
+		WithArgs(false, now, until).
+		WillReturnRows(rows)
+
+	result := repo.FindStartingSales(context.Background(), now, until)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Len(t, data, 1)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func Test_when_unitOfWorkSucceeds_expect_singleCommit(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	unitOfWork := repository.NewUnitOfWork(db)
+	saleRepository := repository.NewSaleRepository(db)
+	saleLogRepository := repository.NewSaleLogRepository(db)
+
+	rows := sqlmock.NewRows([]string{"id", "product_id", "sale_stock", "created_at", "start_time", "end_time", "active"}).
+		AddRow(sale.ID, sale.ProductID, sale.SaleStock, sale.CreatedAt, sale.StartTime, sale.EndTime, sale.Active)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT \* FROM "sales" WHERE id = \$1 LIMIT \$2 FOR UPDATE`).
+		WithArgs(sale.ID, 1).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`^INSERT INTO "sale_logs" (.+) VALUES (.+) RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	err = unitOfWork.Execute(context.Background(), func(tx *gorm.DB) error {
+		if result := saleRepository.FindOneByIdForUpdate(tx, sale.ID); result.Error != nil {
+			return result.Error
+		}
+
+		return saleLogRepository.SaveInTx(tx, &entity.SaleLog{ProductID: sale.ProductID}).Error
+	})
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_unitOfWorkFails_expect_rollback(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	unitOfWork := repository.NewUnitOfWork(db)
+	productRepository := repository.NewProductRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "products" SET (.+) WHERE "id" = ?`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	expected := errors.New("sale log insert failed")
+	err = unitOfWork.Execute(context.Background(), func(tx *gorm.DB) error {
+		if result := productRepository.UpdateInTx(tx, &product); result.Error != nil {
+			return result.Error
+		}
+
+		return expected
+	})
+
+	assert.Equal(t, expected, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_when_claimDueWebhookDeliveries_expect_pendingDeliveriesLeasedInOrder(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewWebhookRepository(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "subscription_id", "event_id", "status", "attempts"}).
+		AddRow(4, 1, 8, entity.WebhookDeliveryPending, 2).
+		AddRow(3, 1, 7, entity.WebhookDeliveryPending, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^UPDATE "webhook_deliveries" SET "attempts"=attempts \+ 1,"next_attempt_at"=\$1,"updated_at"=\$2 WHERE id IN \(SELECT "id" FROM "webhook_deliveries" WHERE status = \$3 AND next_attempt_at <= \$4 ORDER BY id LIMIT \$5 FOR UPDATE SKIP LOCKED\) RETURNING \*`).
+		WithArgs(now.Add(time.Minute), now, entity.WebhookDeliveryPending, now, 10).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	result := repo.ClaimDueDeliveries(context.Background(), now, time.Minute, 10)
+	data := result.Result
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, 3, data[0].ID)
+	assert.Equal(t, 4, data[1].ID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_when_saveWebhookDeliveries_expect_duplicatesSkipped(t *testing.T) {
+	db, mock, err := CreateMock()
+	if err != nil {
+		t.Fatalf("failed to create mocks: %s", err)
+	}
+
+	repo := repository.NewWebhookRepository(db)
+	deliveries := []entity.WebhookDelivery{{SubscriptionID: 1, EventID: 7, EventType: entity.SaleCreated, Body: `{}`, Status: entity.WebhookDeliveryPending, NextAttemptAt: time.Now()}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO "webhook_deliveries" .* ON CONFLICT \("subscription_id","event_id"\) DO NOTHING RETURNING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	result := repo.SaveDeliveries(context.Background(), deliveries)
+
+	assert.NoError(t, result.Error)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/auth"
+	"flash_sale_management/dto/request"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createAPIKey creates a key with the scopes and returns the stored key as the repository saw it.
+func createAPIKey(t *testing.T, apiKeyRepo *mocks.APIKeyRepository, scopes ...string) (*entity.APIKey, string) {
+	var saved *entity.APIKey
+	apiKeyRepo.On("Save", mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(0).(*entity.APIKey)
+	}).Return(repository.Result[*entity.APIKey]{}).Once()
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	_, key, err := apiKeyService.CreateAPIKey(context.Background(), request.CreateAPIKeyRequest{Name: "merchandising", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("creating api key: %v", err)
+	}
+
+	return saved, key
+}
+
+func Test_when_apiKeyCreated_expect_onlyHashStored(t *testing.T) {
+	apiKeyRepo := new(mocks.APIKeyRepository)
+
+	saved, key := createAPIKey(t, apiKeyRepo, auth.ScopeSalesRead, auth.ScopeSalesWrite)
+
+	assert.True(t, strings.HasPrefix(key, "fsk_"+saved.Prefix+"_"))
+	assert.Len(t, saved.Hash, 64)
+	assert.NotContains(t, saved.Hash, key[len("fsk_"+saved.Prefix+"_"):])
+	assert.Equal(t, "sales:read,sales:write", saved.Scopes)
+}
+
+func Test_when_apiKeyResolved_expect_integrationPrincipalAndUseRecorded(t *testing.T) {
+	apiKeyRepo := new(mocks.APIKeyRepository)
+	saved, key := createAPIKey(t, apiKeyRepo, auth.ScopeOrdersRead)
+	saved.ID = 4
+
+	apiKeyRepo.On("FindOneByPrefix", saved.Prefix).Return(repository.Result[*entity.APIKey]{Result: saved})
+	apiKeyRepo.On("UpdateLastUsed", 4, mock.Anything).Return(nil)
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	principal, err := apiKeyService.Resolve(context.Background(), key)
+
+	assert.Nil(t, err)
+	assert.Equal(t, auth.RoleIntegration, principal.Role)
+	assert.True(t, principal.HasScope(auth.ScopeOrdersRead))
+	assert.False(t, principal.HasScope(auth.ScopeSalesWrite))
+	apiKeyRepo.AssertExpectations(t)
+}
+
+func Test_when_apiKeyUsedRecently_expect_lastUsedNotUpdatedAgain(t *testing.T) {
+	apiKeyRepo := new(mocks.APIKeyRepository)
+	saved, key := createAPIKey(t, apiKeyRepo, auth.ScopeOrdersRead)
+	lastUsed := time.Now().Add(-time.Second)
+	saved.LastUsedAt = &lastUsed
+
+	apiKeyRepo.On("FindOneByPrefix", saved.Prefix).Return(repository.Result[*entity.APIKey]{Result: saved})
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	_, err := apiKeyService.Resolve(context.Background(), key)
+
+	assert.Nil(t, err)
+	apiKeyRepo.AssertNotCalled(t, "UpdateLastUsed", mock.Anything, mock.Anything)
+}
+
+func Test_when_apiKeyRevokedOrWrong_expect_error(t *testing.T) {
+	apiKeyRepo := new(mocks.APIKeyRepository)
+	saved, key := createAPIKey(t, apiKeyRepo, auth.ScopeSalesRead)
+	revoked, revokedKey := createAPIKey(t, apiKeyRepo, auth.ScopeSalesRead)
+	revokedAt := time.Now()
+	revoked.RevokedAt = &revokedAt
+
+	apiKeyRepo.On("FindOneByPrefix", saved.Prefix).Return(repository.Result[*entity.APIKey]{Result: saved})
+	apiKeyRepo.On("FindOneByPrefix", revoked.Prefix).Return(repository.Result[*entity.APIKey]{Result: revoked})
+	apiKeyRepo.On("FindOneByPrefix", "unknown").Return(repository.Result[*entity.APIKey]{Error: &repository.NotFoundError{Entity: "api key"}})
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	for _, wrong := range []string{revokedKey, key + "x", "fsk_unknown_secret", "not-a-key", ""} {
+		_, err := apiKeyService.Resolve(context.Background(), wrong)
+		assert.ErrorIs(t, err, auth.ErrInvalidAPIKey, wrong)
+	}
+	apiKeyRepo.AssertNotCalled(t, "UpdateLastUsed", mock.Anything, mock.Anything)
+}
+
+func Test_when_apiKeyLookupFails_expect_lookupError(t *testing.T) {
+	apiKeyRepo := new(mocks.APIKeyRepository)
+	lookupErr := errors.New("connection refused")
+	apiKeyRepo.On("FindOneByPrefix", "reader").Return(repository.Result[*entity.APIKey]{Error: lookupErr})
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	_, err := apiKeyService.Resolve(context.Background(), "fsk_reader_secret")
+
+	assert.ErrorIs(t, err, lookupErr)
+	assert.NotErrorIs(t, err, auth.ErrInvalidAPIKey)
+}
+
+func Test_when_createAPIKeyWithUnknownScope_expect_validationError(t *testing.T) {
+	apiKeyRepo := new(mocks.APIKeyRepository)
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	_, _, err := apiKeyService.CreateAPIKey(context.Background(), request.CreateAPIKeyRequest{Name: "merchandising", Scopes: []string{"orders:write"}})
+
+	assert.NotNil(t, err)
+	apiKeyRepo.AssertNotCalled(t, "Save", mock.Anything)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/entity"
+	"flash_sale_management/events"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+// failingPublisher fails the messages of the given ids and records the others.
+type failingPublisher struct {
+	events.MemoryPublisher
+	failing map[int]bool
+}
+
+func (p *failingPublisher) Publish(_ context.Context, message events.Message) error {
+	if p.failing[message.ID] {
+		return errors.New("broker down")
+	}
+	return p.MemoryPublisher.Publish(context.Background(), message)
+}
+
+func Test_when_relayRuns_expect_eventsPublishedAndMarked(t *testing.T) {
+	outboxRepo := new(mocks.OutboxRepository)
+	publisher := events.NewMemoryPublisher()
+
+	now := time.Now()
+	pending := []entity.OutboxEvent{
+		{ID: 1, Type: entity.SaleCreated, SaleID: 3, Payload: `{"id":3}`, Attempts: 1},
+		{ID: 2, Type: entity.SalePurchased, SaleID: 3, Payload: `{"orderId":7}`, Attempts: 1},
+	}
+	outboxRepo.On("ClaimPending", now, mock.Anything, 10).Return(repository.Result[[]entity.OutboxEvent]{Result: pending})
+	outboxRepo.On("MarkPublished", 1, now).Return(nil)
+	outboxRepo.On("MarkPublished", 2, now).Return(nil)
+
+	service.NewOutboxRelay(outboxRepo, publisher, time.Second, 10).Run(context.Background(), now)
+
+	messages := publisher.Messages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, entity.SaleCreated, messages[0].Type)
+	assert.Equal(t, `{"orderId":7}`, string(messages[1].Payload))
+	outboxRepo.AssertExpectations(t)
+}
+
+func Test_when_publishFails_expect_retryWithBackoff(t *testing.T) {
+	outboxRepo := new(mocks.OutboxRepository)
+	publisher := &failingPublisher{failing: map[int]bool{1: true, 2: true, 3: true}}
+
+	now := time.Now()
+	pending := []entity.OutboxEvent{
+		{ID: 1, Type: entity.SaleUpdated, SaleID: 3, Payload: `{}`, Attempts: 1},
+		{ID: 2, Type: entity.SaleUpdated, SaleID: 3, Payload: `{}`, Attempts: 4},
+		{ID: 3, Type: entity.SaleUpdated, SaleID: 3, Payload: `{}`, Attempts: 20},
+	}
+	outboxRepo.On("ClaimPending", now, mock.Anything, 10).Return(repository.Result[[]entity.OutboxEvent]{Result: pending})
+	outboxRepo.On("MarkFailed", 1, now.Add(time.Second), "broker down").Return(nil)
+	outboxRepo.On("MarkFailed", 2, now.Add(8*time.Second), "broker down").Return(nil)
+	outboxRepo.On("MarkFailed", 3, now.Add(5*time.Minute), "broker down").Return(nil)
+
+	service.NewOutboxRelay(outboxRepo, publisher, time.Second, 10).Run(context.Background(), now)
+
+	assert.Empty(t, publisher.Messages())
+	outboxRepo.AssertExpectations(t)
+	outboxRepo.AssertNotCalled(t, "MarkPublished", mock.Anything, mock.Anything)
+}
+
+func Test_when_fullBatchPublished_expect_nextBatchClaimed(t *testing.T) {
+	outboxRepo := new(mocks.OutboxRepository)
+	publisher := events.NewMemoryPublisher()
+
+	now := time.Now()
+	first := []entity.OutboxEvent{{ID: 1, Type: entity.SaleCreated, Payload: `{}`}}
+	outboxRepo.On("ClaimPending", now, mock.Anything, 1).Return(repository.Result[[]entity.OutboxEvent]{Result: first}).Once()
+	outboxRepo.On("ClaimPending", now, mock.Anything, 1).Return(repository.Result[[]entity.OutboxEvent]{Result: []entity.OutboxEvent{}}).Once()
+	outboxRepo.On("MarkPublished", 1, now).Return(nil)
+
+	service.NewOutboxRelay(outboxRepo, publisher, time.Second, 1).Run(context.Background(), now)
+
+	assert.Len(t, publisher.Messages(), 1)
+	outboxRepo.AssertExpectations(t)
+}
+
+func Test_when_claimFails_expect_nothingPublished(t *testing.T) {
+	outboxRepo := new(mocks.OutboxRepository)
+	publisher := events.NewMemoryPublisher()
+
+	now := time.Now()
+	outboxRepo.On("ClaimPending", now, mock.Anything, 10).Return(repository.Result[[]entity.OutboxEvent]{Error: errors.New("db down")})
+
+	service.NewOutboxRelay(outboxRepo, publisher, time.Second, 10).Run(context.Background(), now)
+
+	assert.Empty(t, publisher.Messages())
+}
@@ -1,14 +1,18 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"flash_sale_management/config"
+	"flash_sale_management/dto/request"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"flash_sale_management/service"
 	"flash_sale_management/tests/mocks"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 	"testing"
 	"time"
 )
@@ -30,12 +34,13 @@ func Test_CreateProduct_when_expect_success(t *testing.T) {
 	repo := new(mocks.ProductRepository)
 	redisService := new(mocks.RedisService)
 
-	repo.On("Save", product).Return(repository.Result{Result: product})
+	repo.On("Save", product).Return(repository.Result[*entity.Product]{Result: product})
 
-	productService := service.NewProductService(repo, redisService)
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
 
-	result := productService.CreateProduct(*product)
+	result, err := productService.CreateProduct(context.Background(), *product)
 
+	assert.Nil(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, result.ID, result.ID)
 	repo.AssertExpectations(t)
@@ -45,12 +50,12 @@ func Test_GetProduct_when_return_product(t *testing.T) {
 	repo := new(mocks.ProductRepository)
 	redisService := new(mocks.RedisService)
 
-	repo.On("FindOneById", product.ID).Return(repository.Result{Result: product})
+	repo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: product})
 	redisService.On("Get", fmt.Sprintf(service.ProductKey, product.ID)).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(repo, redisService)
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
 
-	pr, err := productService.GetProduct(product.ID)
+	pr, err := productService.GetProduct(context.Background(), product.ID)
 	if err != nil {
 		return
 	}
@@ -59,3 +64,97 @@ func Test_GetProduct_when_return_product(t *testing.T) {
 	assert.Equal(t, pr.ID, product.ID)
 	repo.AssertExpectations(t)
 }
+
+func Test_SaveProduct_when_invalidRequest_expect_validationError(t *testing.T) {
+	repo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
+
+	_, err := productService.SaveProduct(context.Background(), request.CreateProductRequest{Name: "", Price: 0, Stock: -1})
+
+	assert.NotNil(t, err)
+	repo.AssertNotCalled(t, "Save", mock.Anything)
+}
+
+func Test_SaveProduct_when_validRequest_expect_success(t *testing.T) {
+	repo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	repo.On("Save", mock.AnythingOfType("*entity.Product")).Return(repository.Result[*entity.Product]{})
+
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
+
+	pr, err := productService.SaveProduct(context.Background(), request.CreateProductRequest{Name: "Test product", Price: 10, Stock: 5})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Test product", pr.Name)
+	assert.Equal(t, 5, pr.Stock)
+	repo.AssertExpectations(t)
+}
+
+func Test_FindProducts_when_expect_returnProducts(t *testing.T) {
+	repo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	repo.On("FindAll").Return(repository.Result[[]entity.Product]{Result: []entity.Product{*product}})
+
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
+
+	products, err := productService.FindProducts(context.Background())
+
+	assert.Nil(t, err)
+	assert.Len(t, *products, 1)
+	repo.AssertExpectations(t)
+}
+
+func Test_UpdateProductDetails_when_stockZero_expect_updatedProduct(t *testing.T) {
+	repo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	stored := *product
+	repo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &stored})
+	repo.On("UpdateColumnsInTx", mock.Anything, &stored, []string{"updated_at", "price", "stock"}).Return(repository.Result[*entity.Product]{Result: &stored})
+
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
+
+	stock := 0
+	pr, err := productService.UpdateProductDetails(context.Background(), request.UpdateProductRequest{ID: product.ID, Price: 25, Stock: &stock})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 25.0, pr.Price)
+	assert.Equal(t, 0, pr.Stock)
+	assert.Equal(t, product.Name, pr.Name)
+	repo.AssertExpectations(t)
+}
+
+func Test_DeleteProduct_when_notFound_expect_error(t *testing.T) {
+	repo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	repo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Error: &repository.NotFoundError{Entity: "product"}})
+	redisService.On("Get", fmt.Sprintf(service.ProductKey, product.ID)).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
+
+	err := productService.DeleteProduct(context.Background(), product.ID)
+
+	assert.NotNil(t, err)
+	repo.AssertNotCalled(t, "DeleteOneById", product.ID)
+}
+
+func Test_DeleteProduct_when_productHasSales_expect_conflict(t *testing.T) {
+	repo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	stored := *product
+	repo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &stored})
+	repo.On("DeleteOneById", product.ID).Return(gorm.ErrForeignKeyViolated)
+	redisService.On("Get", fmt.Sprintf(service.ProductKey, product.ID)).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(repo, redisService, new(mocks.UnitOfWork))
+
+	err := productService.DeleteProduct(context.Background(), product.ID)
+
+	assert.ErrorIs(t, err, service.ErrConflict)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"flash_sale_management/service"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestRedisService(t *testing.T) (*service.RedisService, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	redisService := service.NewRedisService(client)
+
+	return &redisService, server
+}
+
+func Test_ReserveStock_when_counterMissing_expect_notMirroredError(t *testing.T) {
+	redisService, _ := newTestRedisService(t)
+
+	reserved, err := redisService.ReserveStock(context.Background(), "KEY_SALE_STOCK:1", 1)
+
+	assert.False(t, reserved)
+	assert.ErrorIs(t, err, service.ErrStockNotMirrored)
+}
+
+func Test_ReserveStock_when_concurrentBuyers_expect_noOversell(t *testing.T) {
+	redisService, server := newTestRedisService(t)
+	assert.Nil(t, redisService.InitStock(context.Background(), "KEY_SALE_STOCK:1", 5))
+
+	var wg sync.WaitGroup
+	var reservedCount int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reserved, err := redisService.ReserveStock(context.Background(), "KEY_SALE_STOCK:1", 1); err == nil && reserved {
+				atomic.AddInt32(&reservedCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stock, _ := server.Get("KEY_SALE_STOCK:1")
+	assert.Equal(t, int32(5), reservedCount)
+	assert.Equal(t, "0", stock)
+}
+
+func Test_ReleaseStock_when_counterRemoved_expect_notRecreated(t *testing.T) {
+	redisService, server := newTestRedisService(t)
+	assert.Nil(t, redisService.InitStock(context.Background(), "KEY_SALE_STOCK:1", 1))
+
+	reserved, err := redisService.ReserveStock(context.Background(), "KEY_SALE_STOCK:1", 1)
+	assert.True(t, reserved)
+	assert.Nil(t, err)
+
+	assert.Nil(t, redisService.ReleaseStock(context.Background(), "KEY_SALE_STOCK:1", 1))
+	stock, _ := server.Get("KEY_SALE_STOCK:1")
+	assert.Equal(t, "1", stock)
+
+	server.Del("KEY_SALE_STOCK:1")
+	assert.Nil(t, redisService.ReleaseStock(context.Background(), "KEY_SALE_STOCK:1", 1))
+	assert.False(t, server.Exists("KEY_SALE_STOCK:1"))
+}
+
+func Test_AdjustStock_when_unitsReserved_expect_reservedUnitsKeptTaken(t *testing.T) {
+	redisService, server := newTestRedisService(t)
+	assert.Nil(t, redisService.InitStock(context.Background(), "KEY_SALE_STOCK:1", 10))
+
+	reserved, err := redisService.ReserveStock(context.Background(), "KEY_SALE_STOCK:1", 3)
+	assert.True(t, reserved)
+	assert.Nil(t, err)
+
+	assert.Nil(t, redisService.AdjustStock(context.Background(), "KEY_SALE_STOCK:1", -5))
+	stock, _ := server.Get("KEY_SALE_STOCK:1")
+	assert.Equal(t, "2", stock)
+
+	server.Del("KEY_SALE_STOCK:1")
+	assert.Nil(t, redisService.AdjustStock(context.Background(), "KEY_SALE_STOCK:1", 5))
+	assert.False(t, server.Exists("KEY_SALE_STOCK:1"))
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/dto/request"
+	"flash_sale_management/entity"
+	"flash_sale_management/queue"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func newTestReservationService(saleRepo *mocks.SaleRepository, productRepo *mocks.ProductRepository, saleLogRepo *mocks.SaleLogRepository,
+	redisService *mocks.RedisService, reservationRepo *mocks.ReservationRepository) service.ReservationService {
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	return service.NewReservationService(reservationRepo, saleService, 10*time.Minute)
+}
+
+func Test_when_reserve_expect_saleStockHeld(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.StartTime = time.Now().Add(-time.Minute)
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 5
+
+	lockedSale := sale
+	lockedProduct := product
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	saleRepo.On("UpdateInTx", mock.Anything, &lockedSale).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	saleRepo.On("IncreaseCustomerPurchaseInTx", mock.Anything, &entity.CustomerPurchase{SaleID: sale.ID, CustomerID: buyRequest.CustomerID, Quantity: 2}, sale.MaxPerCustomer).
+		Return(repository.Result[*entity.CustomerPurchase]{})
+	reservationRepo.On("SaveInTx", mock.Anything, mock.AnythingOfType("*entity.Reservation")).Return(repository.Result[*entity.Reservation]{})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 2).Return(true, nil)
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	reservation, err := reservationService.Reserve(context.Background(), sale.ID, request.BuyProductRequest{CustomerID: buyRequest.CustomerID, Quantity: 2})
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ReservationHeld, reservation.Status)
+	assert.Equal(t, 2, reservation.Quantity)
+	assert.True(t, reservation.ExpiresAt.After(time.Now()))
+	// only the sale stock is held, the product stock is taken on confirm
+	assert.Equal(t, 3, lockedSale.SaleStock)
+	assert.Equal(t, 5, lockedProduct.Stock)
+	productRepo.AssertNotCalled(t, "UpdateInTx", mock.Anything, mock.Anything)
+	saleRepo.AssertExpectations(t)
+	reservationRepo.AssertExpectations(t)
+}
+
+func Test_when_reserveRetriedWithIdempotencyKey_expect_existingReservationReturned(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	retryRequest := request.BuyProductRequest{CustomerID: buyRequest.CustomerID, IdempotencyKey: "key-1"}
+	existing := entity.Reservation{ID: 4, SaleID: saleEntity.ID, CustomerID: buyRequest.CustomerID, Quantity: 1, Status: entity.ReservationHeld}
+	reservationRepo.On("FindOneByIdempotencyKey", buyRequest.CustomerID+":key-1").Return(repository.Result[*entity.Reservation]{Result: &existing})
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	reservation, err := reservationService.Reserve(context.Background(), saleEntity.ID, retryRequest)
+
+	assert.Nil(t, err)
+	assert.Equal(t, existing.ID, reservation.ID)
+	saleRepo.AssertNotCalled(t, "FindOneById", mock.Anything)
+	redisService.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+	reservationRepo.AssertNotCalled(t, "SaveInTx", mock.Anything, mock.Anything)
+}
+
+func Test_when_confirmReservation_expect_orderCreated(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	sale := saleEntity
+	sale.SaleStock = 3
+	product := *saleProduct
+	product.Stock = 5
+	reservation := entity.Reservation{ID: 7, SaleID: sale.ID, ProductID: product.ID, CustomerID: buyRequest.CustomerID,
+		Quantity: 2, Status: entity.ReservationHeld, ExpiresAt: time.Now().Add(time.Minute)}
+
+	reservationRepo.On("FindOneByIdForUpdate", mock.Anything, reservation.ID).Return(repository.Result[*entity.Reservation]{Result: &reservation})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	productRepo.On("UpdateInTx", mock.Anything, &product).Return(repository.Result[*entity.Product]{Result: &product})
+	saleLogRepo.On("SaveInTx", mock.Anything, mock.AnythingOfType("*entity.SaleLog")).Return(repository.Result[*entity.SaleLog]{})
+	reservationRepo.On("UpdateInTx", mock.Anything, &reservation).Return(repository.Result[*entity.Reservation]{Result: &reservation})
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	saleLog, err := reservationService.ConfirmReservation(context.Background(), reservation.ID, request.ReservationRequest{CustomerID: buyRequest.CustomerID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, saleLog.Quantity)
+	assert.Equal(t, 3, saleLog.RemainingSaleStock)
+	assert.Equal(t, 3, saleLog.RemainingProductStock)
+	assert.Equal(t, float64(18), saleLog.TotalPrice)
+	assert.Equal(t, entity.ReservationConfirmed, reservation.Status)
+	assert.Equal(t, 3, sale.SaleStock)
+	saleRepo.AssertNotCalled(t, "UpdateInTx", mock.Anything, mock.Anything)
+	saleLogRepo.AssertExpectations(t)
+}
+
+func Test_when_confirmExpiredReservation_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	reservation := entity.Reservation{ID: 7, SaleID: saleEntity.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID,
+		Quantity: 1, Status: entity.ReservationHeld, ExpiresAt: time.Now().Add(-time.Second)}
+
+	reservationRepo.On("FindOneByIdForUpdate", mock.Anything, reservation.ID).Return(repository.Result[*entity.Reservation]{Result: &reservation})
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	_, err := reservationService.ConfirmReservation(context.Background(), reservation.ID, request.ReservationRequest{CustomerID: buyRequest.CustomerID})
+
+	assert.NotNil(t, err)
+	saleLogRepo.AssertNotCalled(t, "SaveInTx", mock.Anything, mock.Anything)
+}
+
+func Test_when_confirmReservationOfOtherCustomer_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	reservation := entity.Reservation{ID: 7, SaleID: saleEntity.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID,
+		Quantity: 1, Status: entity.ReservationHeld, ExpiresAt: time.Now().Add(time.Minute)}
+
+	reservationRepo.On("FindOneByIdForUpdate", mock.Anything, reservation.ID).Return(repository.Result[*entity.Reservation]{Result: &reservation})
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	_, err := reservationService.ConfirmReservation(context.Background(), reservation.ID, request.ReservationRequest{CustomerID: "customer-2"})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, entity.ReservationHeld, reservation.Status)
+}
+
+func Test_when_cancelReservation_expect_stockReturned(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	sale := saleEntity
+	sale.SaleStock = 3
+	reservation := entity.Reservation{ID: 7, SaleID: sale.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID,
+		Quantity: 2, Status: entity.ReservationHeld, ExpiresAt: time.Now().Add(time.Minute)}
+
+	reservationRepo.On("FindOneByIdForUpdate", mock.Anything, reservation.ID).Return(repository.Result[*entity.Reservation]{Result: &reservation})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("UpdateInTx", mock.Anything, &sale).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("DecreaseCustomerPurchaseInTx", mock.Anything, &entity.CustomerPurchase{SaleID: sale.ID, CustomerID: buyRequest.CustomerID, Quantity: 2}).
+		Return(repository.Result[*entity.CustomerPurchase]{})
+	reservationRepo.On("UpdateInTx", mock.Anything, &reservation).Return(repository.Result[*entity.Reservation]{Result: &reservation})
+	redisService.On("ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 2).Return(nil)
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	cancelled, err := reservationService.CancelReservation(context.Background(), reservation.ID, request.ReservationRequest{CustomerID: buyRequest.CustomerID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ReservationCancelled, cancelled.Status)
+	assert.Equal(t, 5, sale.SaleStock)
+	saleRepo.AssertExpectations(t)
+	redisService.AssertExpectations(t)
+}
+
+func Test_when_expireReservations_expect_onlyExpiredReleased(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+	reservationRepo := new(mocks.ReservationRepository)
+
+	now := time.Now()
+	sale := saleEntity
+	sale.SaleStock = 0
+	expired := entity.Reservation{ID: 7, SaleID: sale.ID, CustomerID: buyRequest.CustomerID, Quantity: 1,
+		Status: entity.ReservationHeld, ExpiresAt: now.Add(-time.Second)}
+	// confirmed by the customer after it was listed
+	confirmed := entity.Reservation{ID: 8, SaleID: sale.ID, CustomerID: "customer-2", Quantity: 1,
+		Status: entity.ReservationConfirmed, ExpiresAt: now.Add(-time.Second)}
+
+	reservationRepo.On("FindExpired", now, mock.Anything).Return(repository.Result[[]entity.Reservation]{Result: []entity.Reservation{expired, confirmed}})
+	reservationRepo.On("FindOneByIdForUpdate", mock.Anything, expired.ID).Return(repository.Result[*entity.Reservation]{Result: &expired})
+	reservationRepo.On("FindOneByIdForUpdate", mock.Anything, confirmed.ID).Return(repository.Result[*entity.Reservation]{Result: &confirmed})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("UpdateInTx", mock.Anything, &sale).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("DecreaseCustomerPurchaseInTx", mock.Anything, mock.Anything).Return(repository.Result[*entity.CustomerPurchase]{})
+	reservationRepo.On("UpdateInTx", mock.Anything, &expired).Return(repository.Result[*entity.Reservation]{Result: &expired})
+	redisService.On("ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(nil)
+
+	reservationService := newTestReservationService(saleRepo, productRepo, saleLogRepo, redisService, reservationRepo)
+
+	released, err := reservationService.ExpireReservations(context.Background(), now)
+
+	assert.Nil(t, err)
+	assert.Len(t, released, 1)
+	assert.Equal(t, entity.ReservationExpired, expired.Status)
+	assert.Equal(t, entity.ReservationConfirmed, confirmed.Status)
+	assert.Equal(t, 1, sale.SaleStock)
+	redisService.AssertNumberOfCalls(t, "ReleaseStock", 1)
+}
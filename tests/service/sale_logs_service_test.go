@@ -1,12 +1,16 @@
 package service
 
 import (
+	"context"
 	"flash_sale_management/config"
+	"flash_sale_management/dto/request"
 	"flash_sale_management/entity"
 	"flash_sale_management/repository"
 	"flash_sale_management/service"
 	"flash_sale_management/tests/mocks"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"testing"
 	"time"
 )
@@ -27,12 +31,268 @@ func init() {
 func Test_CreateSaleLog_when_expect_success(t *testing.T) {
 	repo := new(mocks.SaleLogRepository)
 
-	repo.On("Save", saleLog).Return(repository.Result{Result: saleLog})
+	repo.On("Save", saleLog).Return(repository.Result[*entity.SaleLog]{Result: saleLog})
 
-	saleLogService := service.NewSaleLogService(repo)
+	saleLogService := service.NewSaleLogService(repo, new(mocks.SaleRepository), service.ProductService{}, new(mocks.RedisService), new(mocks.UnitOfWork), new(mocks.OutboxRepository))
 
-	err := saleLogService.SaveSaleLog(saleLog)
+	err := saleLogService.SaveSaleLog(context.Background(), saleLog)
 
 	assert.Nil(t, err)
 	repo.AssertExpectations(t)
 }
+
+func Test_CancelOrder_when_saleRunning_expect_saleAndProductStockRestored(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	order := entity.SaleLog{ID: 3, SaleID: &saleEntity.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 2, Status: entity.OrderPlaced}
+	sale := saleEntity
+	sale.Active = true
+	sale.SaleStock = 1
+	sale.EndTime = time.Now().Add(time.Hour)
+	product := *saleProduct
+	product.Stock = 4
+
+	repo.On("FindOneByIdForUpdate", mock.Anything, order.ID).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	repo.On("UpdateInTx", mock.Anything, &order).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("UpdateInTx", mock.Anything, &sale).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("DecreaseCustomerPurchaseInTx", mock.Anything, &entity.CustomerPurchase{SaleID: sale.ID, CustomerID: order.CustomerID, Quantity: 2}).
+		Return(repository.Result[*entity.CustomerPurchase]{})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	productRepo.On("UpdateInTx", mock.Anything, &product).Return(repository.Result[*entity.Product]{Result: &product})
+	redisService.On("ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 2).Return(nil)
+
+	outboxRepo := new(mocks.OutboxRepository)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	saleLogService := service.NewSaleLogService(repo, saleRepo, productService, redisService, new(mocks.UnitOfWork), outboxRepo)
+
+	cancelled, err := saleLogService.CancelOrder(context.Background(), order.ID, request.CancelOrderRequest{CustomerID: order.CustomerID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.OrderCancelled, cancelled.Status)
+	assert.Equal(t, 3, sale.SaleStock)
+	assert.Equal(t, 6, product.Stock)
+	assert.Equal(t, []string{entity.OrderCancelledEvent}, outboxRepo.SavedTypes())
+	assert.Equal(t, sale.ID, outboxRepo.Saved[0].SaleID)
+	assert.Contains(t, outboxRepo.Saved[0].Payload, `"restocked":true`)
+	saleRepo.AssertExpectations(t)
+	redisService.AssertExpectations(t)
+}
+
+func Test_CancelOrder_when_saleSoldOutAndSwitchedOff_expect_saleStockRestored(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	order := entity.SaleLog{ID: 3, SaleID: &saleEntity.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 2, Status: entity.OrderPlaced}
+	// the scheduler switched the sale off when it sold out, its period is still running
+	sale := saleEntity
+	sale.Active = false
+	sale.SaleStock = 0
+	sale.EndTime = time.Now().Add(time.Hour)
+	product := *saleProduct
+	product.Stock = 4
+
+	repo.On("FindOneByIdForUpdate", mock.Anything, order.ID).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	repo.On("UpdateInTx", mock.Anything, &order).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("UpdateInTx", mock.Anything, &sale).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("DecreaseCustomerPurchaseInTx", mock.Anything, mock.Anything).Return(repository.Result[*entity.CustomerPurchase]{})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	productRepo.On("UpdateInTx", mock.Anything, &product).Return(repository.Result[*entity.Product]{Result: &product})
+	redisService.On("ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 2).Return(nil)
+
+	outboxRepo := new(mocks.OutboxRepository)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	saleLogService := service.NewSaleLogService(repo, saleRepo, productService, redisService, new(mocks.UnitOfWork), outboxRepo)
+
+	cancelled, err := saleLogService.CancelOrder(context.Background(), order.ID, request.CancelOrderRequest{CustomerID: order.CustomerID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.OrderCancelled, cancelled.Status)
+	assert.Equal(t, 2, sale.SaleStock)
+	assert.Contains(t, outboxRepo.Saved[0].Payload, `"restocked":true`)
+	saleRepo.AssertExpectations(t)
+	redisService.AssertExpectations(t)
+}
+
+func Test_RefundOrder_when_saleEnded_expect_onlyProductStockRestored(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	order := entity.SaleLog{ID: 3, SaleID: &saleEntity.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 2, Status: entity.OrderPlaced}
+	sale := saleEntity
+	sale.Active = false
+	sale.SaleStock = 0
+	sale.EndTime = time.Now().Add(-time.Hour)
+	product := *saleProduct
+	product.Stock = 4
+
+	repo.On("FindOneByIdForUpdate", mock.Anything, order.ID).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	repo.On("UpdateInTx", mock.Anything, &order).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("DecreaseCustomerPurchaseInTx", mock.Anything, mock.Anything).Return(repository.Result[*entity.CustomerPurchase]{})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	productRepo.On("UpdateInTx", mock.Anything, &product).Return(repository.Result[*entity.Product]{Result: &product})
+
+	outboxRepo := new(mocks.OutboxRepository)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	saleLogService := service.NewSaleLogService(repo, saleRepo, productService, redisService, new(mocks.UnitOfWork), outboxRepo)
+
+	refunded, err := saleLogService.RefundOrder(context.Background(), order.ID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.OrderRefunded, refunded.Status)
+	assert.Equal(t, []string{entity.OrderRefundedEvent}, outboxRepo.SavedTypes())
+	assert.Contains(t, outboxRepo.Saved[0].Payload, `"restocked":false`)
+	assert.Equal(t, 0, sale.SaleStock)
+	assert.Equal(t, 6, product.Stock)
+	saleRepo.AssertNotCalled(t, "UpdateInTx", mock.Anything, mock.Anything)
+	redisService.AssertNotCalled(t, "ReleaseStock", mock.Anything, mock.Anything)
+}
+
+func Test_CancelOrder_when_saleDeleted_expect_productStockRestored(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	order := entity.SaleLog{ID: 3, SaleID: &saleEntity.ID, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 1, Status: entity.OrderPlaced}
+	product := *saleProduct
+	product.Stock = 4
+
+	repo.On("FindOneByIdForUpdate", mock.Anything, order.ID).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	repo.On("UpdateInTx", mock.Anything, &order).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, saleEntity.ID).Return(repository.Result[*entity.Sale]{Error: &repository.NotFoundError{Entity: "sale"}})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	productRepo.On("UpdateInTx", mock.Anything, &product).Return(repository.Result[*entity.Product]{Result: &product})
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	saleLogService := service.NewSaleLogService(repo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+
+	cancelled, err := saleLogService.CancelOrder(context.Background(), order.ID, request.CancelOrderRequest{CustomerID: order.CustomerID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.OrderCancelled, cancelled.Status)
+	assert.Equal(t, 5, product.Stock)
+}
+
+func Test_CancelOrder_when_alreadyCancelledOrOtherCustomer_expect_error(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	cancelled := entity.SaleLog{ID: 3, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 1, Status: entity.OrderCancelled}
+	placed := entity.SaleLog{ID: 4, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 1, Status: entity.OrderPlaced}
+
+	repo.On("FindOneByIdForUpdate", mock.Anything, cancelled.ID).Return(repository.Result[*entity.SaleLog]{Result: &cancelled})
+	repo.On("FindOneByIdForUpdate", mock.Anything, placed.ID).Return(repository.Result[*entity.SaleLog]{Result: &placed})
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	saleLogService := service.NewSaleLogService(repo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+
+	_, err := saleLogService.CancelOrder(context.Background(), cancelled.ID, request.CancelOrderRequest{CustomerID: cancelled.CustomerID})
+	assert.NotNil(t, err)
+
+	_, err = saleLogService.CancelOrder(context.Background(), placed.ID, request.CancelOrderRequest{CustomerID: "customer-2"})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, entity.OrderPlaced, placed.Status)
+	productRepo.AssertNotCalled(t, "UpdateInTx", mock.Anything, mock.Anything)
+}
+
+func Test_FindOrders_when_morePagesExist_expect_nextCursor(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+
+	now := time.Now()
+	orders := []entity.SaleLog{
+		{ID: 9, TotalPrice: 30, CreatedAt: now},
+		{ID: 8, TotalPrice: 20, CreatedAt: now.Add(-time.Second)},
+		{ID: 7, TotalPrice: 10, CreatedAt: now.Add(-2 * time.Second)},
+	}
+
+	repo.On("FindAllByQuery", repository.SaleLogQuery{SortColumn: "created_at", Descending: true, Limit: 3}).
+		Return(repository.Result[[]entity.SaleLog]{Result: orders})
+
+	saleLogService := service.NewSaleLogService(repo, new(mocks.SaleRepository), service.ProductService{}, new(mocks.RedisService), new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+
+	page, nextCursor, err := saleLogService.FindOrders(context.Background(), request.OrderQuery{Limit: 2})
+
+	assert.Nil(t, err)
+	assert.Len(t, *page, 2)
+	assert.NotEmpty(t, nextCursor)
+
+	// the next page starts after the last returned order
+	repo.On("FindAllByQuery", mock.MatchedBy(func(query repository.SaleLogQuery) bool {
+		return query.AfterID == 8 && query.AfterValue.(time.Time).Equal(orders[1].CreatedAt)
+	})).Return(repository.Result[[]entity.SaleLog]{Result: []entity.SaleLog{orders[2]}})
+
+	page, nextCursor, err = saleLogService.FindOrders(context.Background(), request.OrderQuery{Limit: 2, Cursor: nextCursor})
+
+	assert.Nil(t, err)
+	assert.Len(t, *page, 1)
+	assert.Empty(t, nextCursor)
+}
+
+func Test_FindOrders_when_saleAndTimeFilter_expect_passedToQuery(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+
+	repo.On("FindAllByQuery", mock.MatchedBy(func(query repository.SaleLogQuery) bool {
+		return query.SaleID == saleEntity.ID && query.From == nil &&
+			query.To.Equal(time.Date(2024, 9, 20, 0, 0, 0, 0, time.UTC)) && query.SortColumn == "total_price" && !query.Descending
+	})).Return(repository.Result[[]entity.SaleLog]{Result: []entity.SaleLog{}})
+
+	saleLogService := service.NewSaleLogService(repo, new(mocks.SaleRepository), service.ProductService{}, new(mocks.RedisService), new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+
+	page, _, err := saleLogService.FindOrders(context.Background(), request.OrderQuery{SaleID: saleEntity.ID, To: "2024-09-20T00:00", Sort: "totalPrice"})
+
+	assert.Nil(t, err)
+	assert.Empty(t, *page)
+	repo.AssertExpectations(t)
+}
+
+func Test_CancelOrder_when_orderNotLinkedToSale_expect_productStockRestored(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+
+	order := entity.SaleLog{ID: 3, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 1, Status: entity.OrderPlaced}
+	product := *saleProduct
+	product.Stock = 4
+
+	repo.On("FindOneByIdForUpdate", mock.Anything, order.ID).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	repo.On("UpdateInTx", mock.Anything, &order).Return(repository.Result[*entity.SaleLog]{Result: &order})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	productRepo.On("UpdateInTx", mock.Anything, &product).Return(repository.Result[*entity.Product]{Result: &product})
+
+	outboxRepo := new(mocks.OutboxRepository)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	saleLogService := service.NewSaleLogService(repo, saleRepo, productService, redisService, new(mocks.UnitOfWork), outboxRepo)
+
+	cancelled, err := saleLogService.CancelOrder(context.Background(), order.ID, request.CancelOrderRequest{CustomerID: order.CustomerID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.OrderCancelled, cancelled.Status)
+	assert.Equal(t, 5, product.Stock)
+	assert.Equal(t, 0, outboxRepo.Saved[0].SaleID)
+	saleRepo.AssertNotCalled(t, "FindOneByIdForUpdate", mock.Anything, mock.Anything)
+}
+
+func Test_FindOrders_when_invalidCursor_expect_error(t *testing.T) {
+	repo := new(mocks.SaleLogRepository)
+
+	saleLogService := service.NewSaleLogService(repo, new(mocks.SaleRepository), service.ProductService{}, new(mocks.RedisService), new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+
+	_, _, err := saleLogService.FindOrders(context.Background(), request.OrderQuery{Cursor: "not-a-cursor"})
+
+	assert.NotNil(t, err)
+	repo.AssertNotCalled(t, "FindAllByQuery", mock.Anything)
+}
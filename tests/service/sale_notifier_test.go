@@ -0,0 +1,48 @@
+package service
+
+import (
+	"flash_sale_management/hub"
+	"flash_sale_management/service"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func notificationsOf(event service.SaleEvent) []string {
+	saleHub := hub.NewHub(8)
+	client := saleHub.Register()
+	saleHub.Subscribe(client, event.SaleID)
+
+	notifier := service.NewSaleNotifier(saleHub, 5)
+	notifier.Notify(event)
+	saleHub.Unregister(client)
+
+	notifications := make([]string, 0)
+	for event := range client.Events() {
+		notifications = append(notifications, event.Type)
+	}
+
+	return notifications
+}
+
+func Test_SaleNotifier_when_saleChanges_expect_lifecycleNotifications(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    service.SaleEvent
+		expected []string
+	}{
+		{"starting", service.SaleEvent{SaleID: 1, SaleStock: 10, Starting: true, PreviousStock: 10}, []string{hub.SaleStarting}},
+		{"activated", service.SaleEvent{SaleID: 1, SaleStock: 10, Active: true, PreviousStock: 10}, []string{hub.SaleStarted}},
+		{"stock drops to low", service.SaleEvent{SaleID: 1, SaleStock: 5, Active: true, PreviousStock: 7, WasActive: true}, []string{hub.SaleLowStock}},
+		{"stock already low", service.SaleEvent{SaleID: 1, SaleStock: 3, Active: true, PreviousStock: 4, WasActive: true}, []string{}},
+		{"sold out", service.SaleEvent{SaleID: 1, SaleStock: 0, Active: true, PreviousStock: 2, WasActive: true}, []string{hub.SaleSoldOut}},
+		{"sold out sale deactivated", service.SaleEvent{SaleID: 1, SaleStock: 0, WasActive: true}, []string{}},
+		{"ended with stock left", service.SaleEvent{SaleID: 1, SaleStock: 4, PreviousStock: 4, WasActive: true}, []string{hub.SaleEnded}},
+		{"deleted", service.SaleEvent{SaleID: 1, Deleted: true, PreviousStock: 4, WasActive: true}, []string{hub.SaleEnded}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, notificationsOf(test.event))
+		})
+	}
+}
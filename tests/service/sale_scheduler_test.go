@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flash_sale_management/entity"
+	"flash_sale_management/queue"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func Test_when_schedulerRuns_expect_salesActivatedAndDeactivated(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	now := time.Now()
+	activated := []entity.Sale{{ID: 1, ProductID: 1, SaleStock: 10, Active: true}}
+	deactivated := []entity.Sale{{ID: 2, ProductID: 2, SaleStock: 0, Active: false}}
+
+	saleRepo.On("ActivateDueSalesInTx", mock.Anything, now).Return(repository.Result[[]entity.Sale]{Result: activated})
+	saleRepo.On("DeactivateFinishedSalesInTx", mock.Anything, now).Return(repository.Result[[]entity.Sale]{Result: deactivated})
+	outboxRepo := new(mocks.OutboxRepository)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
+
+	service.NewSaleScheduler(saleService, time.Second, 0).Run(context.Background(), now)
+
+	saleRepo.AssertExpectations(t)
+	// the state changes are published like any other sale change
+	assert.Equal(t, []string{entity.SaleUpdated, entity.SaleUpdated}, outboxRepo.SavedTypes())
+	assert.Equal(t, activated[0].ID, outboxRepo.Saved[0].SaleID)
+	assert.Equal(t, deactivated[0].ID, outboxRepo.Saved[1].SaleID)
+}
+
+func Test_when_schedulerActivationFails_expect_deactivationStillRuns(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	now := time.Now()
+	saleRepo.On("ActivateDueSalesInTx", mock.Anything, now).Return(repository.Result[[]entity.Sale]{Error: errors.New("db down")})
+	saleRepo.On("DeactivateFinishedSalesInTx", mock.Anything, now).Return(repository.Result[[]entity.Sale]{Result: []entity.Sale{}})
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	sales, err := saleService.ActivateDueSales(context.Background(), now)
+	assert.Nil(t, sales)
+	assert.NotNil(t, err)
+
+	service.NewSaleScheduler(saleService, time.Second, 0).Run(context.Background(), now)
+
+	saleRepo.AssertExpectations(t)
+}
+
+func Test_when_schedulerRunsWithStartingLead_expect_startingSalesAnnouncedOnce(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	now := time.Now()
+	startTime := now.Add(30 * time.Second)
+	starting := []entity.Sale{{ID: 1, StartTime: startTime}, {ID: 2, StartTime: startTime}}
+
+	saleRepo.On("FindStartingSales", now, now.Add(time.Minute)).Return(repository.Result[[]entity.Sale]{Result: starting})
+	redisService.On("SetNX", fmt.Sprintf(service.SaleStartingKey, 1, startTime.Unix()), startTime, 90*time.Second).Return(true, nil)
+	redisService.On("SetNX", fmt.Sprintf(service.SaleStartingKey, 2, startTime.Unix()), startTime, 90*time.Second).Return(false, nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	announced, err := saleService.AnnounceStartingSales(context.Background(), now, time.Minute)
+
+	assert.NoError(t, err)
+	assert.Len(t, announced, 1)
+	assert.Equal(t, 1, announced[0].ID)
+	redisService.AssertExpectations(t)
+}
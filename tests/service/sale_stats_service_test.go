@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_GetSaleStats_when_soldOut_expect_sellThroughAndTimeToSellOut(t *testing.T) {
+	saleLogRepo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+	statsService := service.NewSaleStatsService(saleLogRepo, saleRepo, redisService, 10*time.Second)
+
+	startTime := time.Now().Add(-time.Hour)
+	lastOrderAt := startTime.Add(90 * time.Second)
+	minutes := []repository.SaleLogMinute{
+		{Minute: startTime.Truncate(time.Minute), Purchases: 3, Units: 4},
+		{Minute: startTime.Truncate(time.Minute).Add(time.Minute), Purchases: 1, Units: 1},
+	}
+
+	redisService.On("Get", fmt.Sprintf(service.SaleStatsKey, 1)).Return("", errors.New("cache miss"))
+	saleRepo.On("FindOneById", 1).Return(repository.Result[*entity.Sale]{Result: &entity.Sale{ID: 1, SaleStock: 0, InitialStock: 5, StartTime: startTime}})
+	saleLogRepo.On("SumBySale", 1).Return(repository.Result[*repository.SaleLogTotals]{Result: &repository.SaleLogTotals{
+		Orders:          4,
+		UnitsSold:       5,
+		Revenue:         400,
+		DiscountGiven:   100,
+		UniqueCustomers: 3,
+		FirstOrderAt:    &startTime,
+		LastOrderAt:     &lastOrderAt,
+	}})
+	saleLogRepo.On("CountPerMinuteBySale", 1).Return(repository.Result[[]repository.SaleLogMinute]{Result: minutes})
+
+	stats, err := statsService.GetSaleStats(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stats.UnitsSold)
+	assert.Equal(t, float64(400), stats.Revenue)
+	assert.Equal(t, float64(100), stats.DiscountGiven)
+	assert.Equal(t, float64(100), stats.SellThrough)
+	assert.Equal(t, int64(3), stats.UniqueCustomers)
+	assert.Equal(t, 90*time.Second, *stats.TimeToSellOut)
+	assert.Len(t, stats.PerMinute, 2)
+}
+
+func Test_GetSaleStats_when_stockLeft_expect_noTimeToSellOut(t *testing.T) {
+	saleLogRepo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+	statsService := service.NewSaleStatsService(saleLogRepo, saleRepo, redisService, 10*time.Second)
+
+	lastOrderAt := time.Now()
+	minutes := []repository.SaleLogMinute{}
+
+	redisService.On("Get", fmt.Sprintf(service.SaleStatsKey, 1)).Return("", errors.New("cache miss"))
+	saleRepo.On("FindOneById", 1).Return(repository.Result[*entity.Sale]{Result: &entity.Sale{ID: 1, SaleStock: 2, InitialStock: 3, StartTime: time.Now()}})
+	saleLogRepo.On("SumBySale", 1).Return(repository.Result[*repository.SaleLogTotals]{Result: &repository.SaleLogTotals{UnitsSold: 1, LastOrderAt: &lastOrderAt}})
+	saleLogRepo.On("CountPerMinuteBySale", 1).Return(repository.Result[[]repository.SaleLogMinute]{Result: minutes})
+
+	stats, err := statsService.GetSaleStats(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 33.33, stats.SellThrough)
+	assert.Nil(t, stats.TimeToSellOut)
+}
+
+func Test_GetSaleStats_when_stockHeldByReservations_expect_noTimeToSellOut(t *testing.T) {
+	saleLogRepo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+	statsService := service.NewSaleStatsService(saleLogRepo, saleRepo, redisService, 10*time.Second)
+
+	lastOrderAt := time.Now()
+	minutes := []repository.SaleLogMinute{}
+
+	redisService.On("Get", fmt.Sprintf(service.SaleStatsKey, 1)).Return("", errors.New("cache miss"))
+	saleRepo.On("FindOneById", 1).Return(repository.Result[*entity.Sale]{Result: &entity.Sale{ID: 1, SaleStock: 0, InitialStock: 4, StartTime: time.Now()}})
+	saleLogRepo.On("SumBySale", 1).Return(repository.Result[*repository.SaleLogTotals]{Result: &repository.SaleLogTotals{UnitsSold: 1, LastOrderAt: &lastOrderAt}})
+	saleLogRepo.On("CountPerMinuteBySale", 1).Return(repository.Result[[]repository.SaleLogMinute]{Result: minutes})
+
+	stats, err := statsService.GetSaleStats(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, float64(25), stats.SellThrough)
+	assert.Nil(t, stats.TimeToSellOut)
+}
+
+func Test_GetSaleStats_when_cached_expect_noQuery(t *testing.T) {
+	saleLogRepo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+	statsService := service.NewSaleStatsService(saleLogRepo, saleRepo, redisService, 10*time.Second)
+
+	cached, _ := json.Marshal(service.SaleStats{SaleID: 1, UnitsSold: 7, Revenue: 70})
+	redisService.On("Get", fmt.Sprintf(service.SaleStatsKey, 1)).Return(string(cached), nil)
+
+	stats, err := statsService.GetSaleStats(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), stats.UnitsSold)
+	saleRepo.AssertNotCalled(t, "FindOneById", 1)
+	saleLogRepo.AssertNotCalled(t, "SumBySale", 1)
+}
+
+func Test_GetSaleStats_when_saleNotFound_expect_error(t *testing.T) {
+	saleLogRepo := new(mocks.SaleLogRepository)
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+	statsService := service.NewSaleStatsService(saleLogRepo, saleRepo, redisService, 10*time.Second)
+
+	redisService.On("Get", fmt.Sprintf(service.SaleStatsKey, 1)).Return("", errors.New("cache miss"))
+	saleRepo.On("FindOneById", 1).Return(repository.Result[*entity.Sale]{Error: &repository.NotFoundError{Entity: "sale"}})
+
+	stats, err := statsService.GetSaleStats(context.Background(), 1)
+
+	assert.Error(t, err)
+	assert.Nil(t, stats)
+	saleLogRepo.AssertNotCalled(t, "SumBySale", 1)
+}
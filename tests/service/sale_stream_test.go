@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"flash_sale_management/service"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_SaleStream_when_eventPublished_expect_subscriberReceivesIt(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	redisService := service.NewRedisService(client)
+	stream := service.NewSaleStream(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go stream.Start(ctx)
+
+	events, unsubscribe := stream.Subscribe(1)
+	defer unsubscribe()
+
+	// the stream subscribes in the background, publish until it listens
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, redisService.Publish(context.Background(), service.SaleEventsChannel, service.SaleEvent{SaleID: 1, SaleStock: 4, Active: true}))
+		select {
+		case event := <-events:
+			return event.SaleStock == 4 && event.Active
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func Test_SaleStream_when_otherSale_expect_noEvent(t *testing.T) {
+	stream := service.NewSaleStream(nil)
+
+	events, unsubscribe := stream.Subscribe(1)
+	defer unsubscribe()
+
+	stream.Broadcast(service.SaleEvent{SaleID: 2, SaleStock: 4})
+
+	select {
+	case <-events:
+		t.Fatal("received the event of another sale")
+	default:
+	}
+}
+
+func Test_SaleStream_when_slowSubscriber_expect_latestEventWithoutBlocking(t *testing.T) {
+	stream := service.NewSaleStream(nil)
+
+	events, unsubscribe := stream.Subscribe(1)
+	defer unsubscribe()
+
+	stream.Broadcast(service.SaleEvent{SaleID: 1, SaleStock: 3})
+	stream.Broadcast(service.SaleEvent{SaleID: 1, SaleStock: 2})
+	stream.Broadcast(service.SaleEvent{SaleID: 1, SaleStock: 1})
+
+	assert.Equal(t, 1, (<-events).SaleStock)
+	select {
+	case <-events:
+		t.Fatal("stale event was kept")
+	default:
+	}
+}
+
+func Test_SaleStream_when_unsubscribed_expect_channelClosed(t *testing.T) {
+	stream := service.NewSaleStream(nil)
+
+	events, unsubscribe := stream.Subscribe(1)
+	unsubscribe()
+	unsubscribe()
+
+	stream.Broadcast(service.SaleEvent{SaleID: 1, SaleStock: 3})
+
+	_, ok := <-events
+	assert.False(t, ok)
+}
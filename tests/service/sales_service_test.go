@@ -1,15 +1,20 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"flash_sale_management/config"
 	"flash_sale_management/dto/request"
 	"flash_sale_management/entity"
+	"flash_sale_management/queue"
 	"flash_sale_management/repository"
 	"flash_sale_management/service"
 	"flash_sale_management/tests/mocks"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,6 +35,8 @@ var saleEntity = entity.Sale{
 	Active:    true,
 }
 
+var buyRequest = request.BuyProductRequest{CustomerID: "customer-1"}
+
 var saleProduct = &entity.Product{
 	ID:        2,
 	Name:      "Test product sale",
@@ -39,44 +46,81 @@ var saleProduct = &entity.Product{
 	UpdatedAt: time.Now(),
 }
 
-func Test_when_getFlashSales_expect_returnSales(t *testing.T) {
+func Test_when_getFlashSalePage_expect_nextCursorAndTotal(t *testing.T) {
 	saleRepo := new(mocks.SaleRepository)
-	productRepo := new(mocks.ProductRepository)
-	saleLogRepo := new(mocks.SaleLogRepository)
 	redisService := new(mocks.RedisService)
 
-	saleRepo.On("FindAll").Return(repository.Result{Result: &saleEntity})
-	redisService.On("Get", service.SalesKey).Return(nil, errors.New("error"))
+	now := time.Now()
+	sales := []entity.Sale{
+		{ID: 4, StartTime: now},
+		{ID: 6, StartTime: now.Add(time.Minute)},
+		{ID: 5, StartTime: now.Add(2 * time.Minute)},
+	}
+	total := int64(7)
+
+	saleRepo.On("FindAllByQuery", mock.MatchedBy(func(query repository.SaleQuery) bool {
+		return query.Status == repository.SaleUpcoming && query.ProductID == saleProduct.ID &&
+			query.SortColumn == "start_time" && !query.Descending && query.Limit == 3 && query.AfterValue == nil
+	})).Return(repository.Result[[]entity.Sale]{Result: sales})
+	saleRepo.On("CountByQuery", mock.Anything).Return(repository.Result[int64]{Result: total})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(new(mocks.ProductRepository), redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
-	sale, err := saleService.FindSales()
+	page, err := saleService.FindSalePage(context.Background(), request.SaleQuery{Status: repository.SaleUpcoming, ProductID: saleProduct.ID, Limit: 2})
 
 	assert.Nil(t, err)
-	assert.NotNil(t, sale)
-	saleRepo.AssertExpectations(t)
+	assert.Len(t, page.Sales, 2)
+	assert.Equal(t, total, page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// the next page starts after the last returned sale
+	saleRepo.On("FindAllByQuery", mock.MatchedBy(func(query repository.SaleQuery) bool {
+		return query.AfterID == 6 && query.AfterValue.(time.Time).Equal(sales[1].StartTime)
+	})).Return(repository.Result[[]entity.Sale]{Result: []entity.Sale{sales[2]}})
+
+	page, err = saleService.FindSalePage(context.Background(), request.SaleQuery{Status: repository.SaleUpcoming, ProductID: saleProduct.ID, Limit: 2, Cursor: page.NextCursor})
+
+	assert.Nil(t, err)
+	assert.Len(t, page.Sales, 1)
+	assert.Empty(t, page.NextCursor)
 }
 
-func Test_when_getFlashSalesArray_expect_returnSales(t *testing.T) {
+func Test_when_getCachedFlashSalePage_expect_noDatabaseQuery(t *testing.T) {
 	saleRepo := new(mocks.SaleRepository)
-	productRepo := new(mocks.ProductRepository)
-	saleLogRepo := new(mocks.SaleLogRepository)
 	redisService := new(mocks.RedisService)
 
-	saleRepo.On("FindAll").Return(repository.Result{Result: &[]entity.Sale{saleEntity}})
-	redisService.On("Get", service.SalesKey).Return(nil, errors.New("error"))
+	redisService.On("Get", service.SalesVersionKey).Return("42", nil)
+	redisService.On("Get", mock.MatchedBy(func(key string) bool {
+		return strings.HasPrefix(key, "KEY_SALES:42:")
+	})).Return(`{"sales":[{"ID":3}],"nextCursor":"","total":1}`, nil)
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(new(mocks.ProductRepository), redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
-	sale, err := saleService.FindSales()
+	page, err := saleService.FindSalePage(context.Background(), request.SaleQuery{Status: repository.SaleActive})
 
 	assert.Nil(t, err)
-	assert.NotNil(t, sale)
-	saleRepo.AssertExpectations(t)
+	assert.Equal(t, int64(1), page.Total)
+	assert.Equal(t, 3, page.Sales[0].ID)
+	saleRepo.AssertNotCalled(t, "FindAllByQuery", mock.Anything)
+}
+
+func Test_when_getFlashSalePageWithUnknownStatus_expect_validationError(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+
+	productService := service.NewProductService(new(mocks.ProductRepository), redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.FindSalePage(context.Background(), request.SaleQuery{Status: "paused"})
+
+	assert.ErrorIs(t, err, service.ErrValidation)
+	saleRepo.AssertNotCalled(t, "FindAllByQuery", mock.Anything)
 }
 
 func Test_when_getFlashSale_expect_returnSale(t *testing.T) {
@@ -85,14 +129,14 @@ func Test_when_getFlashSale_expect_returnSale(t *testing.T) {
 	saleLogRepo := new(mocks.SaleLogRepository)
 	redisService := new(mocks.RedisService)
 
-	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result{Result: &saleEntity})
+	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
-	sale, err := saleService.FindSale(saleEntity.ID)
+	sale, err := saleService.FindSale(context.Background(), saleEntity.ID)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, sale)
@@ -100,19 +144,39 @@ func Test_when_getFlashSale_expect_returnSale(t *testing.T) {
 	saleRepo.AssertExpectations(t)
 }
 
-func Test_when_updateFlashSale_expect_returnSale(t *testing.T) {
+func Test_when_getMissingFlashSale_expect_notFoundError(t *testing.T) {
 	saleRepo := new(mocks.SaleRepository)
 	productRepo := new(mocks.ProductRepository)
 	saleLogRepo := new(mocks.SaleLogRepository)
 	redisService := new(mocks.RedisService)
 
-	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result{Result: &saleEntity})
-	saleRepo.On("Update", &saleEntity).Return(repository.Result{Result: saleEntity})
+	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result[*entity.Sale]{Error: &repository.NotFoundError{Entity: "sale"}})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.FindSale(context.Background(), saleEntity.ID)
+
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Equal(t, fmt.Sprintf("flash sale not found. id: %d", saleEntity.ID), err.Error())
+}
+
+func Test_when_updateFlashSale_expect_returnSale(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, saleEntity.ID).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
+	saleRepo.On("UpdateColumnsInTx", mock.Anything, &saleEntity, mock.Anything).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
+	outboxRepo := new(mocks.OutboxRepository)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
 
 	saleEntity.Active = false
 
@@ -122,14 +186,66 @@ func Test_when_updateFlashSale_expect_returnSale(t *testing.T) {
 		SaleStock: 50,
 		StartTime: "2024-09-16T11:04",
 		EndTime:   "2024-09-16T10:04",
-		Active:    false,
 	}
 
-	sale, err := saleService.UpdateSale(request)
+	sale, err := saleService.UpdateSale(context.Background(), request)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, sale)
+	assert.Equal(t, []string{entity.SaleUpdated}, outboxRepo.SavedTypes())
+	saleRepo.AssertExpectations(t)
+}
+
+func Test_UpdateSale_when_onlyDiscountChanged_expect_stockAndStateLeftAlone(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+
+	activatedAt := time.Now()
+	sale := saleEntity
+	sale.Active = true
+	sale.ActivatedAt = &activatedAt
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("UpdateColumnsInTx", mock.Anything, &sale, []string{"updated_at", "discount"}).Return(repository.Result[*entity.Sale]{Result: &sale})
+
+	productService := service.NewProductService(new(mocks.ProductRepository), redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	updated, err := saleService.UpdateSale(context.Background(), request.UpdateSaleRequest{ID: sale.ID, Discount: 35})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 35.0, updated.Discount)
+	assert.True(t, updated.Active)
+	assert.Equal(t, saleEntity.SaleStock, updated.SaleStock)
+	saleRepo.AssertExpectations(t)
+	redisService.AssertNotCalled(t, "AdjustStock", mock.Anything, mock.Anything)
+}
+
+func Test_UpdateSale_when_stockRaisedOnActiveSale_expect_counterMovedByDifference(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	redisService := new(mocks.RedisService)
+
+	activatedAt := time.Now()
+	sale := saleEntity
+	sale.Active = true
+	sale.ActivatedAt = &activatedAt
+	sale.SaleStock = 20
+	sale.InitialStock = 25
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("UpdateColumnsInTx", mock.Anything, &sale, []string{"updated_at", "sale_stock", "initial_stock"}).Return(repository.Result[*entity.Sale]{Result: &sale})
+	redisService.On("AdjustStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 30).Return(nil)
+
+	productService := service.NewProductService(new(mocks.ProductRepository), redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	updated, err := saleService.UpdateSale(context.Background(), request.UpdateSaleRequest{ID: sale.ID, SaleStock: 50})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 50, updated.SaleStock)
+	assert.Equal(t, 55, updated.InitialStock)
 	saleRepo.AssertExpectations(t)
+	redisService.AssertExpectations(t)
 }
 
 func Test_when_createFlashSale_expect_returnErrorNoStock(t *testing.T) {
@@ -139,12 +255,12 @@ func Test_when_createFlashSale_expect_returnErrorNoStock(t *testing.T) {
 	redisService := new(mocks.RedisService)
 
 	saleProduct.Stock = 0
-	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result{Result: saleProduct})
+	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result[*entity.Product]{Result: saleProduct})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
 	createSaleRequest := request.CreateSaleRequest{
 		ProductID: saleProduct.ID,
@@ -154,7 +270,7 @@ func Test_when_createFlashSale_expect_returnErrorNoStock(t *testing.T) {
 		EndTime:   "2024-09-16T12:04",
 	}
 
-	_, err := saleService.CreateSale(createSaleRequest)
+	_, err := saleService.CreateSale(context.Background(), createSaleRequest)
 
 	assert.NotNil(t, err)
 	saleRepo.AssertExpectations(t)
@@ -163,29 +279,57 @@ func Test_when_createFlashSale_expect_returnErrorNoStock(t *testing.T) {
 func Test_when_createFlashSale_expect_returnAlreadyExist(t *testing.T) {
 	saleRepo := new(mocks.SaleRepository)
 	productRepo := new(mocks.ProductRepository)
-	saleLogRepo := new(mocks.SaleLogRepository)
 	redisService := new(mocks.RedisService)
+	outboxRepo := new(mocks.OutboxRepository)
+
+	running := saleEntity
+	running.Active = true
+	product := *saleProduct
+	product.Stock = 10
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindAllByProductInTx", mock.Anything, product.ID).Return(repository.Result[[]entity.Sale]{Result: []entity.Sale{running}})
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), outboxRepo)
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
+
+	sale := entity.Sale{ProductID: product.ID, SaleStock: 20, Discount: 30, StartTime: time.Now().Add(time.Hour), EndTime: time.Now().Add(2 * time.Hour)}
+	_, err := saleService.SaveSale(context.Background(), &sale)
+
+	assert.ErrorIs(t, err, service.ErrConflict)
+	productRepo.AssertExpectations(t)
+	saleRepo.AssertNotCalled(t, "SaveInTx", mock.Anything, mock.Anything)
+	assert.Empty(t, outboxRepo.Saved)
+}
 
-	saleProduct.Stock = 10
-	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result{Result: saleProduct})
-	saleRepo.On("FindOneByProduct", saleProduct.ID).Return(repository.Result{Result: saleEntity})
-	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
-
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
-
-	createSaleRequest := request.CreateSaleRequest{
-		ProductID: saleProduct.ID,
-		SaleStock: 20,
-		Discount:  30,
-		StartTime: "2024-09-16T11:04",
-		EndTime:   "2024-09-16T12:04",
-	}
-
-	_, err := saleService.CreateSale(createSaleRequest)
+func Test_SaveSale_when_productSaleEnded_expect_newSaleAllowed(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	redisService := new(mocks.RedisService)
+	outboxRepo := new(mocks.OutboxRepository)
+
+	ended := saleEntity
+	ended.Active = false
+	ended.StartTime = time.Now().Add(-48 * time.Hour)
+	ended.EndTime = time.Now().Add(-24 * time.Hour)
+	product := *saleProduct
+	product.Stock = 10
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindAllByProductInTx", mock.Anything, product.ID).Return(repository.Result[[]entity.Sale]{Result: []entity.Sale{ended}})
+	saleRepo.On("SaveInTx", mock.Anything, mock.Anything).Return(repository.Result[*entity.Sale]{})
+	redisService.On("Set", mock.Anything, mock.Anything).Return(nil)
+	redisService.On("Delete", mock.Anything).Return(nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(new(mocks.SaleLogRepository), saleRepo, productService, redisService, new(mocks.UnitOfWork), outboxRepo)
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
+
+	sale := entity.Sale{ProductID: product.ID, SaleStock: 5, Discount: 30, StartTime: time.Now().Add(time.Hour), EndTime: time.Now().Add(2 * time.Hour)}
+	saved, err := saleService.SaveSale(context.Background(), &sale)
 
-	assert.NotNil(t, err)
+	assert.Nil(t, err)
+	assert.Equal(t, product.ID, saved.ProductID)
+	assert.Equal(t, []string{entity.SaleCreated}, outboxRepo.SavedTypes())
 	saleRepo.AssertExpectations(t)
 }
 
@@ -196,13 +340,12 @@ func Test_when_createFlashSale_expect_returnWrongTime(t *testing.T) {
 	redisService := new(mocks.RedisService)
 
 	saleProduct.Stock = 10
-	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result{Result: saleProduct})
-	saleRepo.On("FindOneByProduct", saleProduct.ID).Return(repository.Result{Result: nil})
+	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result[*entity.Product]{Result: saleProduct})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
 	createSaleRequest := request.CreateSaleRequest{
 		ProductID: saleProduct.ID,
@@ -212,7 +355,7 @@ func Test_when_createFlashSale_expect_returnWrongTime(t *testing.T) {
 		EndTime:   "2024-09-16T10:04",
 	}
 
-	_, err := saleService.CreateSale(createSaleRequest)
+	_, err := saleService.CreateSale(context.Background(), createSaleRequest)
 
 	assert.NotNil(t, err)
 	saleRepo.AssertExpectations(t)
@@ -226,15 +369,15 @@ func Test_when_buyFlashSale_expect_returnProductNoStock(t *testing.T) {
 
 	saleProduct.Stock = 0
 
-	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result{Result: saleProduct})
-	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result{Result: &saleEntity})
+	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result[*entity.Product]{Result: saleProduct})
+	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
-	_, err := saleService.Buy(saleEntity.ID, 0)
+	_, err := saleService.Buy(context.Background(), saleEntity.ID, buyRequest)
 
 	assert.NotNil(t, err)
 
@@ -250,15 +393,15 @@ func Test_when_buyFlashSale_expect_returnSaleNoStock(t *testing.T) {
 	saleProduct.Stock = 1
 	saleEntity.SaleStock = 0
 
-	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result{Result: saleProduct})
-	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result{Result: &saleEntity})
+	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result[*entity.Product]{Result: saleProduct})
+	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
-	_, err := saleService.Buy(saleEntity.ID, 0)
+	_, err := saleService.Buy(context.Background(), saleEntity.ID, buyRequest)
 
 	assert.NotNil(t, err)
 
@@ -275,17 +418,468 @@ func Test_when_buyFlashSale_expect_returnIncorrectTime(t *testing.T) {
 	saleEntity.SaleStock = 1
 	saleEntity.EndTime = time.Now().Add(-10 * time.Minute)
 
-	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result{Result: saleProduct})
-	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result{Result: &saleEntity})
+	productRepo.On("FindOneById", saleProduct.ID).Return(repository.Result[*entity.Product]{Result: saleProduct})
+	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), saleEntity.ID, buyRequest)
+
+	assert.NotNil(t, err)
+
+	saleRepo.AssertExpectations(t)
+}
+
+func Test_when_buyFlashSale_expect_stockDecrementedInOneTransaction(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.Active = true
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 3
+
+	lockedSale := sale
+	lockedProduct := product
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	productRepo.On("UpdateInTx", mock.Anything, &lockedProduct).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	saleRepo.On("UpdateInTx", mock.Anything, &lockedSale).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	saleRepo.On("IncreaseCustomerPurchaseInTx", mock.Anything, &entity.CustomerPurchase{SaleID: sale.ID, CustomerID: buyRequest.CustomerID, Quantity: 1}, sale.MaxPerCustomer).
+		Return(repository.Result[*entity.CustomerPurchase]{})
+	saleLogRepo.On("SaveInTx", mock.Anything, mock.AnythingOfType("*entity.SaleLog")).Return(repository.Result[*entity.SaleLog]{})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(true, nil)
+	outboxRepo := new(mocks.OutboxRepository)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
+
+	saleLog, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{entity.SalePurchased}, outboxRepo.SavedTypes())
+	assert.Equal(t, sale.ID, outboxRepo.Saved[0].SaleID)
+	assert.Contains(t, outboxRepo.Saved[0].Payload, `"customerId":"`+buyRequest.CustomerID+`"`)
+	assert.Equal(t, 4, saleLog.RemainingSaleStock)
+	assert.Equal(t, 2, saleLog.RemainingProductStock)
+	assert.Equal(t, product.Price*(1-sale.Discount/100), saleLog.Price)
+	assert.Equal(t, buyRequest.CustomerID, saleLog.CustomerID)
+	assert.Equal(t, sale.ID, *saleLog.SaleID)
+	assert.Equal(t, sale.Discount, saleLog.Discount)
+	assert.Equal(t, product.Price, saleLog.OriginalPrice)
+	saleRepo.AssertExpectations(t)
+	productRepo.AssertExpectations(t)
+	saleLogRepo.AssertExpectations(t)
+}
+
+func Test_when_buyFlashSaleLockedSaleSoldOut_expect_noWrites(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 1
+	sale.Active = true
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 3
+
+	// another buyer took the last unit between the cached read and the row lock
+	lockedSale := sale
+	lockedSale.SaleStock = 0
+	lockedProduct := product
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(true, nil)
+	redisService.On("ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+
+	assert.NotNil(t, err)
+	productRepo.AssertNotCalled(t, "UpdateInTx", mock.Anything, mock.Anything)
+	saleRepo.AssertNotCalled(t, "UpdateInTx", mock.Anything, mock.Anything)
+	saleLogRepo.AssertNotCalled(t, "SaveInTx", mock.Anything, mock.Anything)
+	redisService.AssertCalled(t, "ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1)
+}
+
+func Test_when_buyFlashSaleReservationFails_expect_noDatabaseWrite(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 1
+	sale.Active = true
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 3
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(false, nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+
+	assert.NotNil(t, err)
+	saleRepo.AssertNotCalled(t, "FindOneByIdForUpdate", mock.Anything, mock.Anything)
+	saleLogRepo.AssertNotCalled(t, "SaveInTx", mock.Anything, mock.Anything)
+}
+
+func Test_when_buyFlashSaleCounterMissing_expect_counterSeededFromDatabase(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 2
+	sale.Active = true
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 3
+
+	key := fmt.Sprintf(service.SaleStockKey, sale.ID)
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
 	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", key, 1).Return(false, service.ErrStockNotMirrored).Once()
+	redisService.On("InitStock", key, sale.SaleStock).Return(nil)
+	redisService.On("ReserveStock", key, 1).Return(false, nil).Once()
 
-	productService := service.NewProductService(productRepo, redisService)
-	logService := service.NewSaleLogService(saleLogRepo)
-	saleService := service.NewSalesService(saleRepo, productService, logService, redisService)
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
 
-	_, err := saleService.Buy(saleEntity.ID, 0)
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
 
 	assert.NotNil(t, err)
+	redisService.AssertExpectations(t)
+}
+
+func Test_when_buyFlashSaleWithoutCustomer_expect_validationError(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), saleEntity.ID, request.BuyProductRequest{})
+
+	assert.ErrorIs(t, err, service.ErrValidation)
+	saleRepo.AssertNotCalled(t, "FindOneById", mock.Anything)
+}
+
+func Test_when_buyFlashSaleOverCustomerLimit_expect_reservationReleased(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.Active = true
+	sale.MaxPerCustomer = 1
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 3
+
+	lockedSale := sale
+	lockedProduct := product
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	productRepo.On("UpdateInTx", mock.Anything, &lockedProduct).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	saleRepo.On("UpdateInTx", mock.Anything, &lockedSale).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	saleRepo.On("IncreaseCustomerPurchaseInTx", mock.Anything, mock.AnythingOfType("*entity.CustomerPurchase"), 1).
+		Return(repository.Result[*entity.CustomerPurchase]{Error: repository.ErrPurchaseLimitExceeded})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(true, nil)
+	redisService.On("ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+
+	assert.ErrorIs(t, err, repository.ErrPurchaseLimitExceeded)
+	saleLogRepo.AssertNotCalled(t, "SaveInTx", mock.Anything, mock.Anything)
+	redisService.AssertCalled(t, "ReleaseStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1)
+}
+
+func Test_when_buyFlashSaleWithQuantity_expect_stockDecrementedByQuantity(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.Active = true
+	sale.MaxPerOrder = 3
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 4
+
+	lockedSale := sale
+	lockedProduct := product
+	quantityRequest := request.BuyProductRequest{CustomerID: buyRequest.CustomerID, Quantity: 3}
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	productRepo.On("UpdateInTx", mock.Anything, &lockedProduct).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	saleRepo.On("UpdateInTx", mock.Anything, &lockedSale).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	saleRepo.On("IncreaseCustomerPurchaseInTx", mock.Anything, &entity.CustomerPurchase{SaleID: sale.ID, CustomerID: buyRequest.CustomerID, Quantity: 3}, sale.MaxPerCustomer).
+		Return(repository.Result[*entity.CustomerPurchase]{})
+	saleLogRepo.On("SaveInTx", mock.Anything, mock.AnythingOfType("*entity.SaleLog")).Return(repository.Result[*entity.SaleLog]{})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 3).Return(true, nil)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	saleLog, err := saleService.Buy(context.Background(), sale.ID, quantityRequest)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, saleLog.Quantity)
+	assert.Equal(t, 2, saleLog.RemainingSaleStock)
+	assert.Equal(t, 1, saleLog.RemainingProductStock)
+	assert.Equal(t, saleLog.Price*3, saleLog.TotalPrice)
+	saleLogRepo.AssertExpectations(t)
+}
+
+func Test_when_buyFlashSaleOverOrderMaximum_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.Active = true
+	sale.MaxPerOrder = 2
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 10
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, request.BuyProductRequest{CustomerID: buyRequest.CustomerID, Quantity: 3})
+
+	assert.ErrorIs(t, err, service.ErrLimitExceeded)
+	redisService.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func Test_when_buyFlashSaleQuantityOverSaleStock_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 2
+	sale.Active = true
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 10
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, request.BuyProductRequest{CustomerID: buyRequest.CustomerID, Quantity: 3})
 
+	assert.ErrorIs(t, err, service.ErrSoldOut)
+	redisService.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func Test_when_buyFlashSaleBeforeStart_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.Active = true
+	sale.StartTime = time.Now().Add(10 * time.Minute)
+	sale.EndTime = time.Now().Add(20 * time.Minute)
+	product := *saleProduct
+	product.Stock = 10
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+
+	assert.ErrorIs(t, err, service.ErrSaleNotStarted)
+	redisService.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func Test_when_buyFlashSaleRetriedWithIdempotencyKey_expect_existingOrderReturned(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	retryRequest := request.BuyProductRequest{CustomerID: buyRequest.CustomerID, IdempotencyKey: "key-1"}
+	existing := entity.SaleLog{ID: 7, ProductID: saleProduct.ID, CustomerID: buyRequest.CustomerID, Quantity: 1}
+	saleLogRepo.On("FindOneByIdempotencyKey", buyRequest.CustomerID+":key-1").Return(repository.Result[*entity.SaleLog]{Result: &existing})
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	saleLog, err := saleService.Buy(context.Background(), saleEntity.ID, retryRequest)
+
+	assert.Nil(t, err)
+	assert.Equal(t, existing.ID, saleLog.ID)
+	saleRepo.AssertNotCalled(t, "FindOneById", mock.Anything)
+	redisService.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func Test_when_buyWaitingRoomSale_withoutAdmission_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 5
+	sale.StartTime = time.Now().Add(-time.Minute)
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	sale.WaitingRoom = true
+	sale.AdmissionRate = 1
+	product := *saleProduct
+	product.Stock = 5
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), new(mocks.OutboxRepository))
+
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+	assert.NotNil(t, err)
+
+	withUnknownToken := buyRequest
+	withUnknownToken.AdmissionToken = "unknown"
+	_, err = saleService.Buy(context.Background(), sale.ID, withUnknownToken)
+	assert.NotNil(t, err)
+
+	redisService.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func Test_when_deleteSaleWithOrders_expect_error(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	saleRepo.On("FindOneById", saleEntity.ID).Return(repository.Result[*entity.Sale]{Result: &saleEntity})
+	saleRepo.On("DeleteOneByIdInTx", mock.Anything, saleEntity.ID).Return(gorm.ErrForeignKeyViolated)
+	outboxRepo := new(mocks.OutboxRepository)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
+
+	err := saleService.DeleteSale(context.Background(), saleEntity.ID)
+
+	assert.ErrorIs(t, err, service.ErrConflict)
+	assert.Contains(t, err.Error(), "has orders")
+	assert.Empty(t, outboxRepo.Saved)
 	saleRepo.AssertExpectations(t)
 }
+
+func Test_when_buyLastUnits_expect_purchasedAndSoldOutEvents(t *testing.T) {
+	saleRepo := new(mocks.SaleRepository)
+	productRepo := new(mocks.ProductRepository)
+	saleLogRepo := new(mocks.SaleLogRepository)
+	redisService := new(mocks.RedisService)
+
+	sale := saleEntity
+	sale.SaleStock = 1
+	sale.Active = true
+	sale.StartTime = time.Now().Add(-time.Minute)
+	sale.EndTime = time.Now().Add(10 * time.Minute)
+	product := *saleProduct
+	product.Stock = 3
+
+	lockedSale := sale
+	lockedProduct := product
+
+	productRepo.On("FindOneById", product.ID).Return(repository.Result[*entity.Product]{Result: &product})
+	saleRepo.On("FindOneById", sale.ID).Return(repository.Result[*entity.Sale]{Result: &sale})
+	saleRepo.On("FindOneByIdForUpdate", mock.Anything, sale.ID).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	productRepo.On("FindOneByIdForUpdate", mock.Anything, product.ID).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	productRepo.On("UpdateInTx", mock.Anything, &lockedProduct).Return(repository.Result[*entity.Product]{Result: &lockedProduct})
+	saleRepo.On("UpdateInTx", mock.Anything, &lockedSale).Return(repository.Result[*entity.Sale]{Result: &lockedSale})
+	saleRepo.On("IncreaseCustomerPurchaseInTx", mock.Anything, mock.Anything, sale.MaxPerCustomer).Return(repository.Result[*entity.CustomerPurchase]{})
+	saleLogRepo.On("SaveInTx", mock.Anything, mock.AnythingOfType("*entity.SaleLog")).Return(repository.Result[*entity.SaleLog]{})
+	redisService.On("Get", mock.Anything).Return(nil, errors.New("error"))
+	redisService.On("ReserveStock", fmt.Sprintf(service.SaleStockKey, sale.ID), 1).Return(true, nil)
+	outboxRepo := new(mocks.OutboxRepository)
+
+	productService := service.NewProductService(productRepo, redisService, new(mocks.UnitOfWork))
+	logService := service.NewSaleLogService(saleLogRepo, saleRepo, productService, redisService, new(mocks.UnitOfWork), new(mocks.OutboxRepository))
+	saleService := service.NewSalesService(saleRepo, productService, logService, redisService, new(mocks.UnitOfWork), service.NewWaitingRoom(queue.NewMemoryStore()), outboxRepo)
+
+	_, err := saleService.Buy(context.Background(), sale.ID, buyRequest)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{entity.SalePurchased, entity.SaleSoldOut}, outboxRepo.SavedTypes())
+}
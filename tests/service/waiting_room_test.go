@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/queue"
+	"flash_sale_management/service"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func waitingRoomSale(start time.Time) *entity.Sale {
+	sale := saleEntity
+	sale.StartTime = start
+	sale.EndTime = start.Add(time.Hour)
+	sale.WaitingRoom = true
+	sale.AdmissionRate = 2
+
+	return &sale
+}
+
+func Test_WaitingRoom_when_saleNotStarted_expect_nobodyAdmitted(t *testing.T) {
+	now := time.Now()
+	sale := waitingRoomSale(now.Add(10 * time.Second))
+	waitingRoom := service.NewWaitingRoom(queue.NewMemoryStore())
+
+	status, err := waitingRoom.Join(context.Background(), sale, "customer-1", now)
+
+	assert.Nil(t, err)
+	assert.False(t, status.Admitted)
+	assert.Equal(t, int64(1), status.Position)
+	assert.Equal(t, 10*time.Second, status.EstimatedWait)
+	assert.NotNil(t, waitingRoom.Admit(context.Background(), sale, status.Token, "customer-1", now))
+}
+
+func Test_WaitingRoom_when_saleRunning_expect_admittedAtRate(t *testing.T) {
+	start := time.Now()
+	sale := waitingRoomSale(start)
+	waitingRoom := service.NewWaitingRoom(queue.NewMemoryStore())
+
+	var statuses []*queue.Status
+	for i := 0; i < 5; i++ {
+		status, err := waitingRoom.Join(context.Background(), sale, "customer-1", start)
+		assert.Nil(t, err)
+		statuses = append(statuses, status)
+	}
+
+	// the first second admits two tickets
+	assert.True(t, statuses[1].Admitted)
+	assert.False(t, statuses[2].Admitted)
+	assert.Equal(t, int64(1), statuses[2].Position)
+	assert.Equal(t, time.Second, statuses[2].EstimatedWait)
+	assert.Equal(t, 2*time.Second, statuses[4].EstimatedWait)
+
+	later, err := waitingRoom.Status(context.Background(), sale, statuses[3].Token, start.Add(1500*time.Millisecond))
+	assert.Nil(t, err)
+	assert.True(t, later.Admitted)
+}
+
+func Test_WaitingRoom_when_joinedAfterIdleSeconds_expect_admittedAtRate(t *testing.T) {
+	start := time.Now()
+	sale := waitingRoomSale(start)
+	waitingRoom := service.NewWaitingRoom(queue.NewMemoryStore())
+
+	// nobody queued in the first minute, its capacity is not handed to the customers joining now
+	now := start.Add(time.Minute)
+	var statuses []*queue.Status
+	for i := 0; i < 5; i++ {
+		status, err := waitingRoom.Join(context.Background(), sale, "customer-1", now)
+		assert.Nil(t, err)
+		statuses = append(statuses, status)
+	}
+
+	assert.True(t, statuses[1].Admitted)
+	assert.False(t, statuses[2].Admitted)
+	assert.Equal(t, int64(1), statuses[2].Position)
+}
+
+func Test_WaitingRoom_when_tokenOfOtherCustomer_expect_admissionDenied(t *testing.T) {
+	now := time.Now()
+	sale := waitingRoomSale(now)
+	waitingRoom := service.NewWaitingRoom(queue.NewMemoryStore())
+
+	status, err := waitingRoom.Join(context.Background(), sale, "customer-1", now)
+	assert.Nil(t, err)
+	assert.True(t, status.Admitted)
+
+	err = waitingRoom.Admit(context.Background(), sale, status.Token, "customer-2", now)
+
+	assert.ErrorIs(t, err, service.ErrAdmissionDenied)
+	assert.Nil(t, waitingRoom.Admit(context.Background(), sale, status.Token, "customer-1", now))
+}
+
+func Test_WaitingRoom_when_tokenUsed_expect_admittedOnce(t *testing.T) {
+	now := time.Now()
+	sale := waitingRoomSale(now)
+	waitingRoom := service.NewWaitingRoom(queue.NewMemoryStore())
+
+	status, err := waitingRoom.Join(context.Background(), sale, "customer-1", now)
+	assert.Nil(t, err)
+
+	assert.Nil(t, waitingRoom.Admit(context.Background(), sale, status.Token, "customer-1", now))
+	assert.NotNil(t, waitingRoom.Admit(context.Background(), sale, status.Token, "customer-1", now))
+
+	waitingRoom.Release(context.Background(), sale, status.Token)
+	assert.Nil(t, waitingRoom.Admit(context.Background(), sale, status.Token, "customer-1", now))
+}
+
+func Test_WaitingRoom_when_saleWithoutWaitingRoom_expect_joinError(t *testing.T) {
+	now := time.Now()
+	sale := waitingRoomSale(now)
+	sale.WaitingRoom = false
+	waitingRoom := service.NewWaitingRoom(queue.NewMemoryStore())
+
+	_, err := waitingRoom.Join(context.Background(), sale, "customer-1", now)
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"flash_sale_management/entity"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const webhookSecret = "0123456789abcdef"
+
+// webhookReceiver answers with status and keeps the verified bodies, the requests with a wrong signature get 401.
+func webhookReceiver(t *testing.T, status int, received *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading webhook body: %v", err)
+		}
+
+		signature := service.SignWebhook(webhookSecret, r.Header.Get(service.WebhookTimestampHeader), body)
+		if r.Header.Get(service.WebhookSignatureHeader) != signature {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		*received = append(*received, string(body))
+		w.WriteHeader(status)
+	}))
+}
+
+func Test_when_webhookAccepted_expect_signedBodyDelivered(t *testing.T) {
+	var received []string
+	receiver := webhookReceiver(t, http.StatusNoContent, &received)
+	defer receiver.Close()
+
+	webhookRepo := new(mocks.WebhookRepository)
+	now := time.Now()
+	subscription := entity.WebhookSubscription{ID: 2, URL: receiver.URL, Secret: webhookSecret, EventTypes: entity.SaleSoldOut}
+	due := []entity.WebhookDelivery{{ID: 5, SubscriptionID: 2, EventID: 9, EventType: entity.SaleSoldOut, Body: `{"id":9}`, Status: entity.WebhookDeliveryPending, Attempts: 1}}
+	var updated entity.WebhookDelivery
+	webhookRepo.On("ClaimDueDeliveries", now, mock.Anything, 10).Return(repository.Result[[]entity.WebhookDelivery]{Result: due})
+	webhookRepo.On("FindOneById", 2).Return(repository.Result[*entity.WebhookSubscription]{Result: &subscription})
+	webhookRepo.On("UpdateDelivery", mock.Anything).Run(func(args mock.Arguments) {
+		updated = *args.Get(0).(*entity.WebhookDelivery)
+	}).Return(repository.Result[*entity.WebhookDelivery]{})
+
+	service.NewWebhookDispatcher(webhookRepo, receiver.Client(), time.Second, 10, 3).Run(context.Background(), now)
+
+	assert.Equal(t, []string{`{"id":9}`}, received)
+	assert.Equal(t, entity.WebhookDeliveryDelivered, updated.Status)
+	assert.Equal(t, http.StatusNoContent, updated.ResponseStatus)
+	assert.Equal(t, now, *updated.DeliveredAt)
+}
+
+func Test_when_webhookRejected_expect_retryWithBackoffThenFailed(t *testing.T) {
+	var received []string
+	receiver := webhookReceiver(t, http.StatusInternalServerError, &received)
+	defer receiver.Close()
+
+	webhookRepo := new(mocks.WebhookRepository)
+	now := time.Now()
+	subscription := entity.WebhookSubscription{ID: 2, URL: receiver.URL, Secret: webhookSecret, EventTypes: entity.SaleSoldOut}
+	due := []entity.WebhookDelivery{
+		{ID: 5, SubscriptionID: 2, EventID: 9, EventType: entity.SaleSoldOut, Body: `{}`, Status: entity.WebhookDeliveryPending, Attempts: 1},
+		{ID: 6, SubscriptionID: 2, EventID: 10, EventType: entity.SaleSoldOut, Body: `{}`, Status: entity.WebhookDeliveryPending, Attempts: 3},
+	}
+	updated := make(map[int]entity.WebhookDelivery)
+	webhookRepo.On("ClaimDueDeliveries", now, mock.Anything, 10).Return(repository.Result[[]entity.WebhookDelivery]{Result: due})
+	webhookRepo.On("FindOneById", 2).Return(repository.Result[*entity.WebhookSubscription]{Result: &subscription}).Once()
+	webhookRepo.On("UpdateDelivery", mock.Anything).Run(func(args mock.Arguments) {
+		delivery := *args.Get(0).(*entity.WebhookDelivery)
+		updated[delivery.ID] = delivery
+	}).Return(repository.Result[*entity.WebhookDelivery]{})
+
+	service.NewWebhookDispatcher(webhookRepo, receiver.Client(), time.Second, 10, 3).Run(context.Background(), now)
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, entity.WebhookDeliveryPending, updated[5].Status)
+	assert.True(t, updated[5].NextAttemptAt.After(now))
+	assert.Equal(t, "unexpected response status 500", updated[5].LastError)
+	assert.Equal(t, entity.WebhookDeliveryFailed, updated[6].Status)
+	assert.Equal(t, http.StatusInternalServerError, updated[6].ResponseStatus)
+	webhookRepo.AssertExpectations(t)
+}
+
+func Test_when_webhookSigned_expect_signatureOfTimestampAndBody(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), 10)
+
+	signature := service.SignWebhook("secret", timestamp, []byte(`{}`))
+
+	assert.Equal(t, "sha256=", signature[:7])
+	assert.Len(t, signature, 7+64)
+	assert.Equal(t, signature, service.SignWebhook("secret", timestamp, []byte(`{}`)))
+	assert.NotEqual(t, signature, service.SignWebhook("other", timestamp, []byte(`{}`)))
+	assert.NotEqual(t, signature, service.SignWebhook("secret", timestamp+"1", []byte(`{}`)))
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"flash_sale_management/dto/request"
+	"flash_sale_management/entity"
+	"flash_sale_management/events"
+	"flash_sale_management/repository"
+	"flash_sale_management/service"
+	"flash_sale_management/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func Test_when_createWebhookWithUnknownEvent_expect_validationError(t *testing.T) {
+	webhookRepo := new(mocks.WebhookRepository)
+
+	webhookService := service.NewWebhookService(webhookRepo)
+	_, err := webhookService.CreateSubscription(context.Background(), request.CreateWebhookRequest{
+		URL:    "https://example.com/hooks",
+		Secret: "0123456789abcdef",
+		Events: []string{entity.SaleCreated, "SaleExploded"},
+	})
+
+	assert.NotNil(t, err)
+	webhookRepo.AssertNotCalled(t, "Save", mock.Anything)
+}
+
+func Test_when_eventPublished_expect_deliveriesForSubscribersOnly(t *testing.T) {
+	webhookRepo := new(mocks.WebhookRepository)
+
+	subscriptions := []entity.WebhookSubscription{
+		{ID: 1, URL: "https://a.example.com", EventTypes: entity.SaleSoldOut + "," + entity.OrderRefundedEvent},
+		{ID: 2, URL: "https://b.example.com", EventTypes: entity.SaleCreated},
+		{ID: 3, URL: "https://c.example.com", EventTypes: entity.OrderRefundedEvent},
+	}
+	var saved []entity.WebhookDelivery
+	webhookRepo.On("FindAll").Return(repository.Result[[]entity.WebhookSubscription]{Result: subscriptions})
+	webhookRepo.On("SaveDeliveries", mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(0).([]entity.WebhookDelivery)
+	}).Return(repository.Result[[]entity.WebhookDelivery]{})
+
+	message := events.Message{ID: 9, Type: entity.OrderRefundedEvent, SaleID: 4, Payload: json.RawMessage(`{"orderId":5}`), OccurredAt: time.Now()}
+	webhookService := service.NewWebhookService(webhookRepo)
+	err := webhookService.Publish(context.Background(), message)
+
+	assert.Nil(t, err)
+	assert.Len(t, saved, 2)
+	assert.Equal(t, 1, saved[0].SubscriptionID)
+	assert.Equal(t, 3, saved[1].SubscriptionID)
+	assert.Equal(t, 9, saved[0].EventID)
+	assert.Equal(t, entity.WebhookDeliveryPending, saved[0].Status)
+
+	var body events.Message
+	assert.Nil(t, json.Unmarshal([]byte(saved[0].Body), &body))
+	assert.Equal(t, message.ID, body.ID)
+	assert.JSONEq(t, `{"orderId":5}`, string(body.Payload))
+}
+
+func Test_when_redeliverFailedDelivery_expect_pendingWithFreshAttempts(t *testing.T) {
+	webhookRepo := new(mocks.WebhookRepository)
+
+	deliveredAt := time.Now().Add(-time.Hour)
+	delivery := entity.WebhookDelivery{ID: 7, SubscriptionID: 2, Status: entity.WebhookDeliveryFailed, Attempts: 8, DeliveredAt: &deliveredAt}
+	webhookRepo.On("FindDeliveryById", 7).Return(repository.Result[*entity.WebhookDelivery]{Result: &delivery})
+	webhookRepo.On("UpdateDelivery", &delivery).Return(repository.Result[*entity.WebhookDelivery]{Result: &delivery})
+
+	webhookService := service.NewWebhookService(webhookRepo)
+	redelivered, err := webhookService.Redeliver(context.Background(), 2, 7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, entity.WebhookDeliveryPending, redelivered.Status)
+	assert.Equal(t, 0, redelivered.Attempts)
+	assert.Nil(t, redelivered.DeliveredAt)
+	assert.WithinDuration(t, time.Now(), redelivered.NextAttemptAt, time.Second)
+}
+
+func Test_when_redeliverDeliveryOfOtherWebhook_expect_error(t *testing.T) {
+	webhookRepo := new(mocks.WebhookRepository)
+
+	delivery := entity.WebhookDelivery{ID: 7, SubscriptionID: 2, Status: entity.WebhookDeliveryFailed}
+	webhookRepo.On("FindDeliveryById", 7).Return(repository.Result[*entity.WebhookDelivery]{Result: &delivery})
+
+	webhookService := service.NewWebhookService(webhookRepo)
+	_, err := webhookService.Redeliver(context.Background(), 3, 7)
+
+	assert.NotNil(t, err)
+	webhookRepo.AssertNotCalled(t, "UpdateDelivery", mock.Anything)
+}